@@ -0,0 +1,311 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/rest"
+	"k8s.io/klog/v2"
+
+	"github.com/mwlng/k8s_resources_sync/pkg/backup"
+	"github.com/mwlng/k8s_resources_sync/pkg/helpers"
+	"github.com/mwlng/k8s_resources_sync/pkg/k8s_resources"
+	"github.com/mwlng/k8s_resources_sync/pkg/ledger"
+	"github.com/mwlng/k8s_resources_sync/pkg/utils"
+)
+
+// recordTimeout bounds the time spent recording a run in the ledger, which
+// happens even when the run itself was interrupted or timed out.
+const recordTimeout = 2 * time.Minute
+
+// recordRun hashes the objects touched by the run of b and saves run to the
+// ledger in runsDir.
+func recordRun(runsDir string, b *backup.Backup, run *ledger.Run, target *rest.Config, report helpers.Results) {
+	ctx, cancel := context.WithTimeout(context.Background(), recordTimeout)
+	defer cancel()
+
+	objects, err := helpers.LedgerObjects(ctx, target, b, report)
+	if err != nil {
+		klog.Errorf("Failed to record run %s in the ledger. Err was: %s", run.ID, err)
+		return
+	}
+	run.Objects = objects
+
+	err = ledger.Save(runsDir, run)
+	if err != nil {
+		klog.Errorf("Failed to record run %s in the ledger. Err was: %s", run.ID, err)
+		return
+	}
+	klog.Infof("Recorded run %s in %s", run.ID, runsDir)
+}
+
+// lockOptions tells where to take the run lock of the target cluster.
+type lockOptions struct {
+	namespace string
+	breakLock bool
+}
+
+// acquire takes the run lock of target for the run runID, see
+// helpers.AcquireLock.
+func (o lockOptions) acquire(ctx context.Context, target *rest.Config, runID string) (*helpers.RunLock, context.Context, error) {
+	klog.Infof("Locking %s for run %s ...", target.Host, runID)
+	lock, lockCtx, err := helpers.AcquireLock(ctx, target, o.namespace, runID, o.breakLock)
+	if _, held := err.(*helpers.LockHeldError); held {
+		return nil, nil, fmt.Errorf("%s. Wait for that run to finish, or use -break-lock if it died", err)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to lock the target cluster: %s", err)
+	}
+
+	return lock, lockCtx, nil
+}
+
+// openBackup opens the backup of run id, refusing a backup taken of another
+// cluster than target.
+func openBackup(target *rest.Config, runsDir, id string) (*backup.Backup, error) {
+	b, err := backup.Open(runsDir, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open backup: %s", err)
+	}
+
+	if !helpers.SameHost(target, &rest.Config{Host: b.Target()}) {
+		return nil, fmt.Errorf("backup %s was taken of %s, refusing to restore it to %s", id, b.Target(), target.Host)
+	}
+
+	return b, nil
+}
+
+// restore puts back the target objects saved in backup id and returns the
+// exit code.
+func restore(target *rest.Config, runsDir, id string, locking lockOptions, options k8s_resources.Options) int {
+	if len(id) == 0 {
+		klog.Errorln("No specified backup to restore, use -backup <id>")
+		Usage()
+		return 2
+	}
+
+	b, err := openBackup(target, runsDir, id)
+	if err != nil {
+		klog.Errorln(err)
+		return 1
+	}
+
+	ctx, cancel := utils.WithInterrupt(k8s_resources.WithOptions(context.Background(), options))
+	defer cancel()
+
+	lock, ctx, err := locking.acquire(ctx, target, "restore-"+id)
+	if err != nil {
+		klog.Errorln(err)
+		return 1
+	}
+	defer lock.Release()
+
+	klog.Infof("Restoring %d k8s resources of backup %s to %s ...", len(b.Entries()), id, target.Host)
+	results, err := helpers.RestoreBackup(ctx, target, b)
+	return finish(ctx, "Restore", results, err)
+}
+
+// rollback reverts the changes of run id and returns the exit code.
+func rollback(target *rest.Config, runsDir, id string, locking lockOptions, options k8s_resources.Options) int {
+	if len(id) == 0 {
+		klog.Errorln("No specified run to roll back, use rollback <run-id>")
+		Usage()
+		return 2
+	}
+
+	run, err := ledger.Load(runsDir, id)
+	if err != nil {
+		klog.Errorf("Failed to load run %s: %s", id, err)
+		return 1
+	}
+
+	b, err := openBackup(target, runsDir, id)
+	if err != nil {
+		klog.Errorln(err)
+		return 1
+	}
+
+	ctx, cancel := utils.WithInterrupt(k8s_resources.WithOptions(context.Background(), options))
+	defer cancel()
+
+	lock, ctx, err := locking.acquire(ctx, target, "rollback-"+id)
+	if err != nil {
+		klog.Errorln(err)
+		return 1
+	}
+	defer lock.Release()
+
+	klog.Infof("Rolling back run %s of %s ...", id, target.Host)
+	results, err := helpers.RollbackRun(ctx, target, b, run)
+	return finish(ctx, "Rollback", results, err)
+}
+
+// manifestMatcher matches the manifests of the kinds enabled in kinds, and
+// of the custom resources of customResources, which is nil unless they are
+// synced. If nothing is enabled, every manifest is matched.
+func manifestMatcher(kinds map[schema.GroupKind]bool, customResources helpers.CustomResourceKinds) func(gvk schema.GroupVersionKind) bool {
+	all := customResources == nil
+	for _, enabled := range kinds {
+		all = all && !enabled
+	}
+
+	return func(gvk schema.GroupVersionKind) bool {
+		return all || kinds[gvk.GroupKind()] || customResources.Has(gvk)
+	}
+}
+
+// customResourceKinds returns the kinds of the CRDs in rootDir and in the
+// cluster, or nil unless enabled.
+func customResourceKinds(cluster *rest.Config, rootDir string, enabled bool) helpers.CustomResourceKinds {
+	if !enabled {
+		return nil
+	}
+
+	kinds, err := helpers.LoadCustomResourceKinds(context.Background(), cluster, rootDir)
+	if err != nil {
+		klog.Exitf("Failed to load the kinds of custom resources: %s", err)
+	}
+
+	return kinds
+}
+
+// validate checks the manifests in rootDir matched by match against the
+// schema of target, and returns the exit code.
+func validate(target *rest.Config, rootDir string, match func(gvk schema.GroupVersionKind) bool, filter *helpers.Filter) int {
+	ctx, cancel := utils.WithInterrupt(context.Background())
+	defer cancel()
+
+	klog.Infof("Validating the manifests in %s against %s ...", rootDir, target.Host)
+	issues, err := helpers.ValidateManifests(ctx, target, rootDir, match, filter)
+	if err != nil {
+		klog.Errorf("Failed to validate the manifests: %s", err)
+		return 1
+	}
+
+	for _, issue := range issues {
+		fmt.Println(issue)
+	}
+	if len(issues) > 0 {
+		klog.Errorf("Found %d problems in the manifests", len(issues))
+		return 1
+	}
+	klog.Infoln("Done.")
+
+	return 0
+}
+
+// checkAccess reviews the permissions a run needs in both clusters, and
+// prints the missing ones.
+func checkAccess(ctx context.Context, source, target *rest.Config, rootDir string, match func(gvk schema.GroupVersionKind) bool, filter *helpers.Filter, opts helpers.AccessOptions) int {
+	klog.Infof("Checking the permissions on %s and %s ...", source.Host, target.Host)
+	src, dst, err := helpers.RequiredPermissions(source, target, rootDir, match, filter, opts)
+	if err != nil {
+		klog.Errorf("Failed to work out the required permissions: %s", err)
+		return 1
+	}
+
+	missing := 0
+	for _, cluster := range []struct {
+		name        string
+		kubeConfig  *rest.Config
+		permissions helpers.Permissions
+	}{
+		{"source", source, src},
+		{"target", target, dst},
+	} {
+		denied, reasons, err := helpers.CheckAccess(ctx, cluster.kubeConfig, cluster.permissions)
+		if err != nil {
+			klog.Errorf("Failed to check the permissions on the %s cluster %s: %s", cluster.name, cluster.kubeConfig.Host, err)
+			return 1
+		}
+		if len(denied) > 0 {
+			if missing == 0 {
+				fmt.Println()
+			}
+			helpers.PrintMissingPermissions(os.Stdout, cluster.name, denied, reasons)
+			missing += len(denied)
+		}
+	}
+
+	if missing > 0 {
+		klog.Errorf("Missing %d permissions", missing)
+		return 1
+	}
+
+	return 0
+}
+
+// verifyImages checks that the target cluster can pull the images of the
+// enabled workloads, and prints the ones it can't.
+func verifyImages(ctx context.Context, run *syncRun, deployments, statefulSets, cronJobs, jobs bool, opts helpers.ImageOptions) int {
+	klog.Infof("Verifying the images of the workloads for %s ...", run.target.Host)
+	uses, err := run.workloadImages(ctx, deployments, statefulSets, cronJobs, jobs)
+	if err != nil {
+		klog.Errorf("Failed to read the workloads from the source cluster: %s", err)
+		return 1
+	}
+
+	issues, err := helpers.VerifyImages(ctx, run.target, uses, opts)
+	if err != nil {
+		klog.Errorf("Failed to verify the images: %s", err)
+		return 1
+	}
+
+	if len(issues) > 0 {
+		fmt.Println()
+		helpers.PrintImageIssues(os.Stdout, issues)
+		klog.Errorf("Found %d images the target cluster can't pull", len(issues))
+		return 1
+	}
+	klog.Infof("The images of all %d containers are available.", len(uses))
+
+	return 0
+}
+
+// printImageRewrites prints the images of the workloads rewritten by images,
+// if any.
+func printImageRewrites(images *helpers.ImageRewriter) {
+	rewrites := images.Rewrites()
+	if len(rewrites) == 0 {
+		return
+	}
+
+	fmt.Println()
+	fmt.Printf("Rewrote %d images:\n", len(rewrites))
+	helpers.PrintImageRewrites(os.Stdout, rewrites)
+}
+
+func finish(ctx context.Context, name string, results helpers.Results, err error) int {
+	fmt.Println()
+	results.PrintSummary(os.Stdout)
+	if err != nil || results.Failed() || utils.Interrupted(ctx) {
+		klog.Errorf("%s incomplete, err was: %v", name, err)
+		return 1
+	}
+
+	return 0
+}
+
+// history lists the runs recorded in runsDir and returns the exit code.
+func history(w io.Writer, runsDir string) int {
+	runs, err := ledger.List(runsDir)
+	if err != nil {
+		klog.Errorf("Failed to read the run ledger: %s", err)
+		return 1
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "RUN\tSTARTED\tDURATION\tSOURCE\tTARGET\tOBJECTS\tOUTCOME")
+	for _, run := range runs {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%d\t%s\n", run.ID, run.Started.Local().Format(time.RFC3339),
+			run.Finished.Sub(run.Started).Round(time.Second), run.Source, run.Target, len(run.Objects), run.Outcome)
+	}
+	tw.Flush()
+
+	return 0
+}
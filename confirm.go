@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/klog/v2"
+
+	"github.com/mwlng/k8s_resources_sync/pkg/helpers"
+	"github.com/mwlng/k8s_resources_sync/pkg/k8s_resources"
+	"github.com/mwlng/k8s_resources_sync/pkg/utils"
+)
+
+const prodEnviron = "prod"
+
+// plan runs the enabled steps without changing the target cluster, and
+// returns what they would do to it.
+func (r *syncRun) plan(ctx context.Context, steps []syncStep) (helpers.Results, error) {
+	report := r.report
+	defer func() {
+		r.report = report
+	}()
+
+	r.report = nil
+	planCtx := k8s_resources.WithDryRun(ctx)
+	for _, step := range steps {
+		if !step.enabled {
+			continue
+		}
+
+		if utils.Interrupted(ctx) {
+			return r.report, fmt.Errorf("interrupted")
+		}
+
+		err := step.sync(planCtx)
+		if err != nil {
+			return r.report, err
+		}
+	}
+
+	return r.report, nil
+}
+
+// confirmTarget asks the operator to type the name of the target cluster,
+// and reports whether they did.
+func confirmTarget(name string) bool {
+	answer, err := utils.Prompt(fmt.Sprintf("-> Type the name of the target cluster (%s) to apply these changes: ", name))
+	if err != nil {
+		klog.Errorf("Failed to read confirmation, use -yes to apply without it. Err was: %s", err)
+		return false
+	}
+
+	return answer == name
+}
+
+// objectGate is a k8s_resources.Snapshotter asking the operator before each
+// change to the target cluster. Approved changes are passed on to next, which
+// may be nil. The operator is asked once per object, retries of a change get
+// the same answer.
+type objectGate struct {
+	next k8s_resources.Snapshotter
+
+	lock    sync.Mutex
+	all     bool
+	quit    bool
+	answers map[string]bool
+}
+
+func (g *objectGate) Snapshot(gvk schema.GroupVersionKind, namespace, name string, current runtime.Object) error {
+	if !g.approve(gvk, namespace, name, current == nil) {
+		return k8s_resources.ErrDeclined
+	}
+
+	if g.next == nil {
+		return nil
+	}
+
+	return g.next.Snapshot(gvk, namespace, name, current)
+}
+
+func (g *objectGate) approve(gvk schema.GroupVersionKind, namespace, name string, create bool) bool {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	if g.all || g.quit {
+		return g.all
+	}
+
+	key := gvk.GroupKind().String() + "/" + namespace + "/" + name
+	if approved, ok := g.answers[key]; ok {
+		return approved
+	}
+	if g.answers == nil {
+		g.answers = map[string]bool{}
+	}
+
+	op := "Update"
+	if create {
+		op = "Create"
+	}
+	if len(namespace) > 0 {
+		name = namespace + "/" + name
+	}
+
+	for {
+		answer, err := utils.Prompt(fmt.Sprintf("-> %s %s %s? [y]es, [n]o, [a]ll, [q]uit: ", op, gvk.Kind, name))
+		if err != nil {
+			klog.Errorf("Failed to read answer, declining the remaining changes. Err was: %s", err)
+			g.quit = true
+			return false
+		}
+
+		switch strings.ToLower(answer) {
+		case "y", "yes":
+			g.answers[key] = true
+			return true
+		case "n", "no":
+			g.answers[key] = false
+			return false
+		case "a", "all":
+			g.all = true
+			return true
+		case "q", "quit":
+			g.quit = true
+			return false
+		}
+		fmt.Fprintln(os.Stderr, "Please answer y, n, a or q.")
+	}
+}
@@ -1,12 +1,16 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
-	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/rest"
 	"k8s.io/client-go/util/homedir"
 	"k8s.io/klog/v2"
 
@@ -20,7 +24,12 @@ import (
 	// _ "k8s.io/client-go/plugin/pkg/client/auth/oidc"
 	// _ "k8s.io/client-go/plugin/pkg/client/auth/openstack"
 
+	"github.com/mwlng/k8s_resources_sync/pkg/backup"
+	"github.com/mwlng/k8s_resources_sync/pkg/eks_auth"
 	"github.com/mwlng/k8s_resources_sync/pkg/helpers"
+	"github.com/mwlng/k8s_resources_sync/pkg/k8s_resources"
+	"github.com/mwlng/k8s_resources_sync/pkg/ledger"
+	"github.com/mwlng/k8s_resources_sync/pkg/registry"
 	"github.com/mwlng/k8s_resources_sync/pkg/utils"
 )
 
@@ -50,110 +59,528 @@ func main() {
 
 	var kubeconfig *string
 	if home := homedir.HomeDir(); home != "" {
-		kubeconfig = flag.String("kubeconfig", filepath.Join(home, ".kube", "config"), "(optional) absolute path to the kubeconfig file")
+		kubeconfig = flag.String("kubeconfig", filepath.Join(home, ".kube", "config"), "(optional) absolute path to the kubeconfig file, used for both clusters unless overridden")
 	} else {
-		kubeconfig = flag.String("kubeconfig", "", "absolute path to the kubeconfig file")
+		kubeconfig = flag.String("kubeconfig", "", "absolute path to the kubeconfig file, used for both clusters unless overridden")
 	}
+	sourceKubeconfig := flag.String("source-kubeconfig", "", "(optional) path to the kubeconfig file of the source cluster, defaults to -kubeconfig")
+	sourceContext := flag.String("source-context", "", "Context of the source cluster in its kubeconfig file, required to sync: the current-context of a kubeconfig file is never used")
+	targetKubeconfig := flag.String("target-kubeconfig", "", "(optional) path to the kubeconfig file of the target cluster, defaults to -kubeconfig")
+	targetContext := flag.String("target-context", "", "Context of the target cluster in its kubeconfig file, required by every command but history: the current-context of a kubeconfig file is never used")
+
+	sourceEksCluster := flag.String("source-eks-cluster", "", "(optional) authenticate to the source cluster with natively generated tokens for this EKS cluster name")
+	targetEksCluster := flag.String("target-eks-cluster", "", "(optional) authenticate to the target cluster with natively generated tokens for this EKS cluster name")
+	sourceTokenFile := flag.String("source-token-file", "", "(optional) authenticate to the source cluster with the bearer token in this file")
+	targetTokenFile := flag.String("target-token-file", "", "(optional) authenticate to the target cluster with the bearer token in this file")
+	sourceToken := flag.String("source-token", "", "(optional) authenticate to the source cluster with this bearer token")
+	targetToken := flag.String("target-token", "", "(optional) authenticate to the target cluster with this bearer token")
+	awsProfile := flag.String("aws-profile", "", "(optional) AWS profile signing the EKS tokens, with static credentials or a role_arn, defaults to the AWS_* environment variables, AWS_PROFILE or the EC2 instance role")
+	awsRegion := flag.String("aws-region", "", "(optional) AWS region of the STS endpoint signing the EKS tokens, defaults to AWS_REGION")
+	stsEndpoint := flag.String("sts-endpoint", "", "(optional) STS endpoint the EKS tokens are signed for and roles are assumed with, defaults to the regional endpoint")
 
 	environ := flag.String("e", defaultEnviron, "Target environment")
-	srcEksClusterName := flag.String("source_cluster_name", "", "Source k8s cluster name")
+	srcEksClusterName := flag.String("source_cluster_name", "", "Source k8s cluster name, same as -source-context")
 	rootPath := flag.String("rootpath", "", "Specified root path of k8s resource manifest files")
 
 	deploymentFlag := flag.Bool("deployment", false, "Sync k8s deployment resources")
+	statefulSetFlag := flag.Bool("statefulset", false, "Sync k8s stateful set resources")
 	serviceFlag := flag.Bool("service", false, "Sync k8s service resources")
 	cronFlag := flag.Bool("cronjob", false, "Sync k8s cron job resources")
 	saFlag := flag.Bool("serviceaccount", false, "Sync k8s service account resources")
 	crFlag := flag.Bool("clusterrole", false, "Sync k8s cluster role resources")
 	crbFlag := flag.Bool("clusterrolebinding", false, "Sync k8s cluster role binding resources")
+	roleFlag := flag.Bool("role", false, "Sync k8s role resources")
+	rbFlag := flag.Bool("rolebinding", false, "Sync k8s role binding resources")
+	npFlag := flag.Bool("networkpolicy", false, "Sync k8s network policy resources")
+	jobFlag := flag.Bool("job", false, "Sync k8s job resources")
+	crdFlag := flag.Bool("crd", false, "Sync k8s custom resource definitions")
+	customResourceFlag := flag.Bool("customresource", false, "Sync the custom resources of the CRDs defined in the manifests or in the source cluster")
+	scFlag := flag.Bool("storageclass", false, "Sync k8s storage class resources")
+	pvcFlag := flag.Bool("pvc", false, "Sync k8s persistent volume claim resources")
+
+	jobMode := flag.String("job-mode", helpers.JobModeRecreate, "How to apply jobs whose template is immutable: recreate or suffix")
+	jobWait := flag.Bool("job-wait", false, "Wait for each job to complete before continuing")
+	jobLogs := flag.Bool("job-logs", false, "Stream the pod logs of each job while waiting for it, requires -job-wait")
+	jobTimeout := flag.Duration("job-timeout", 30*time.Minute, "Maximum time to wait for a job to complete")
+	policyPath := flag.String("policy", "", "(optional) path to a YAML file listing the protected objects a run must never change, see helpers.LoadPolicy, defaults to helpers.DefaultPolicy. Protected objects are skipped with a warning unless the file sets mode: fail")
+	crdMergeRulesPath := flag.String("crd-merge-rules", "", "(optional) path to a YAML file with per-kind merge rules for custom resources")
+	storageClassMapping := flag.String("storage-class-map", "", "Comma separated source=target storage class mappings for persistent volume claims, e.g. gp2=gp3")
+	pvcCopyHook := flag.String("pvc-copy-hook", "", "(optional) shell command copying the data of each newly created persistent volume claim, see helpers.CommandDataCopyHook")
+	timeout := flag.Duration("timeout", 0, "(optional) maximum duration of the whole sync run, e.g. 30m")
+	crdTimeout := flag.Duration("crd-timeout", 2*time.Minute, "Maximum time to wait for a custom resource definition to be established")
+
+	retryAttempts := flag.Int("retry-attempts", k8s_resources.DefaultRetryBackoff.Steps, "Maximum number of attempts to apply a k8s resource on conflicts and transient API errors")
+	retryDelay := flag.Duration("retry-delay", k8s_resources.DefaultRetryBackoff.Duration, "Initial delay between attempts, doubled after each retry")
+
+	concurrency := flag.Int("concurrency", 1, "Number of k8s resources of one kind applied in parallel")
+	qps := flag.Float64("qps", 20, "Maximum queries per second to each k8s cluster")
+	burst := flag.Int("burst", 40, "Maximum burst of queries to each k8s cluster")
+
+	selector := flag.String("selector", "", "(optional) label selector the manifests and source objects must match, e.g. team=payments,tier!=batch")
+	var names, excludes utils.StringList
+	flag.Var(&names, "name", "(optional, repeatable) only sync objects whose name or namespace/name matches this glob, or /regexp/")
+	flag.Var(&excludes, "exclude", "(optional, repeatable) skip objects whose name or namespace/name matches this glob, or /regexp/")
+
+	namespaceMapping := flag.String("namespace-map", "", "Comma separated source=target namespace mappings, e.g. default=apps")
+	cidrMapping := flag.String("cidr-map", "", "Comma separated source=target CIDR mappings for network policy ipBlocks, e.g. 10.0.0.0/16=10.1.0.0/16")
+
+	runsDir := flag.String("runs-dir", filepath.Join(homeDir, ".k8s_resources_sync", "runs"), "Directory of the run ledger, holding the record and the backup of the target objects of every run")
+	noBackup := flag.Bool("no-backup", false, "Neither record the run nor back up the target objects before changing them")
+	backupID := flag.String("backup", "", "ID of the run whose backup to put back, for the restore command")
+	lockNamespace := flag.String("lock-namespace", "kube-system", "Namespace of the Lease locking the target cluster for the duration of a run")
+	breakLock := flag.Bool("break-lock", false, "Take the lock of the target cluster even if another run holds it, e.g. when that run died")
+
+	noValidate := flag.Bool("no-validate", false, "Don't validate the manifests against the OpenAPI schema of the target cluster before a run")
+	pinDigests := flag.Bool("pin-digests", false, "Pin the images of synced deployments, stateful sets and cron jobs to the digests the source cluster runs, recording the original images in an annotation")
+	registryMapping := flag.String("registry-map", "", "Comma separated source=target registry mappings for the images of synced workloads, e.g. 1111.dkr.ecr.us-east-1=2222.dkr.ecr.us-west-2")
+	verifyImagesFlag := flag.Bool("verify-images", false, "Check that the target cluster can pull the images of the synced workloads before a run, with the Docker Registry v2 API")
+	dockerConfig := flag.String("docker-config", filepath.Join(homeDir, ".docker", "config.json"), "(optional) docker config file with registry credentials or credential helpers for -verify-images and -pin-digests, used when the image pull secrets have none")
+	insecureRegistries := flag.String("insecure-registries", "", "(optional) comma separated registry hosts reached over plain HTTP by -verify-images and -pin-digests, e.g. registry.local:5000")
+	noAccessCheck := flag.Bool("no-access-check", false, "Don't check the permissions a run needs in both clusters before it")
+	yes := flag.Bool("yes", false, "Apply to the prod environment without showing the planned changes and asking for confirmation")
+	interactive := flag.Bool("interactive", false, "Ask before each change to the target cluster")
 
 	flag.Set("v", "2")
-	flag.Parse()
 
-	if len(*srcEksClusterName) == 0 {
-		klog.Infoln("No specified source k8s cluster name, nothing to sync exit !")
-		Usage()
-		os.Exit(0)
+	// The first argument may name a command, anything else is a sync run.
+	command := "sync"
+	args := os.Args[1:]
+	if len(args) > 0 && (args[0] == "restore" || args[0] == "history" || args[0] == "rollback" || args[0] == "validate") {
+		command, args = args[0], args[1:]
+	}
+	// The flag parser stops at the first positional argument, so the run ID
+	// of rollback is taken out before the flags are parsed.
+	rollbackID := ""
+	if command == "rollback" && len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		rollbackID, args = args[0], args[1:]
+	}
+	flag.CommandLine.Parse(args)
+	extra := flag.Args()
+	if command == "rollback" && len(rollbackID) == 0 && len(extra) > 0 {
+		rollbackID, extra = extra[0], extra[1:]
+	}
+	if len(extra) > 0 {
+		exitUsage("Unexpected arguments: %s", strings.Join(extra, " "))
+	}
+	if *jobLogs && !*jobWait {
+		exitUsage("-job-logs streams the logs of the jobs while waiting for them, it requires -job-wait")
+	}
+
+	if command == "history" {
+		code := history(os.Stdout, utils.NormalizePath(*runsDir))
+		klog.Flush()
+		os.Exit(code)
+	}
+
+	if len(*sourceContext) == 0 {
+		sourceContext = srcEksClusterName
+	}
+	if len(*targetContext) == 0 {
+		exitUsage("No specified target k8s cluster context, -target-context is required")
+	}
+	if command == "sync" && len(*sourceContext) == 0 {
+		exitUsage("No specified source k8s cluster context, -source-context is required")
+	}
+	if len(*sourceKubeconfig) == 0 {
+		sourceKubeconfig = kubeconfig
+	}
+	if len(*targetKubeconfig) == 0 {
+		targetKubeconfig = kubeconfig
+	}
+
+	namespaceMap, err := utils.ParseMapping(*namespaceMapping)
+	if err != nil {
+		klog.Exitf("Invalid namespace mapping: %s", err)
+	}
+
+	registryMap, err := utils.ParseMapping(*registryMapping)
+	if err != nil {
+		klog.Exitf("Invalid registry mapping: %s", err)
+	}
+
+	cidrMap, err := utils.ParseMapping(*cidrMapping)
+	if err != nil {
+		klog.Exitf("Invalid CIDR mapping: %s", err)
+	}
+
+	cidrTranslator, err := helpers.NewCIDRTranslator(cidrMap)
+	if err != nil {
+		klog.Exitf("Invalid CIDR mapping: %s", err)
 	}
 
+	if *jobMode != helpers.JobModeRecreate && *jobMode != helpers.JobModeSuffix {
+		klog.Exitf("Invalid job mode: %s, expected %s or %s", *jobMode, helpers.JobModeRecreate, helpers.JobModeSuffix)
+	}
+
+	if *retryAttempts < 1 {
+		klog.Exitf("Invalid number of retry attempts: %d, expected at least 1", *retryAttempts)
+	}
+	options := k8s_resources.Options{RetryBackoff: k8s_resources.DefaultRetryBackoff}
+	options.RetryBackoff.Steps = *retryAttempts
+	options.RetryBackoff.Duration = *retryDelay
+
+	if *concurrency < 1 {
+		klog.Exitf("Invalid concurrency: %d, expected at least 1", *concurrency)
+	}
+	options.Concurrency = *concurrency
+	if *interactive && *concurrency > 1 {
+		klog.Warningln("Interactive mode asks about one object at a time, ignoring -concurrency")
+		options.Concurrency = 1
+	}
+
+	storageClassMap, err := utils.ParseMapping(*storageClassMapping)
+	if err != nil {
+		klog.Exitf("Invalid storage class mapping: %s", err)
+	}
+
+	filter, err := helpers.NewFilter(*selector, names, excludes)
+	if err != nil {
+		klog.Exitf("Invalid filter: %s", err)
+	}
+
+	mergeRules, err := helpers.LoadMergeRules(*crdMergeRulesPath)
+	if err != nil {
+		klog.Exitf("Failed to load merge rules: %s", err)
+	}
+
+	policy, err := helpers.LoadPolicy(utils.NormalizePath(*policyPath))
+	if err != nil {
+		klog.Exitf("Failed to load policy: %s", err)
+	}
+	options.Guards = policy
+
 	eksFilesRootPath := eksPaths[*environ]
 	if len(*rootPath) > 0 {
 		eksFilesRootPath = utils.NormalizePath(*rootPath)
 	}
 
 	klog.Infoln("Loading client kubeconfig ...")
-	targetKubeConfig, err := clientcmd.BuildConfigFromFlags("", *kubeconfig)
+	targetKubeConfig, err := loadKubeConfig(*targetKubeconfig, *targetContext, eks_auth.Options{
+		ClusterName: *targetEksCluster,
+		Profile:     *awsProfile,
+		Region:      *awsRegion,
+		STSEndpoint: *stsEndpoint,
+		TokenFile:   utils.NormalizePath(*targetTokenFile),
+		Token:       *targetToken,
+	})
 	if err != nil {
-		panic(err)
+		klog.Exitf("Failed to load target kubeconfig: %s", err)
+	}
+	helpers.SetRateLimit(targetKubeConfig, float32(*qps), *burst)
+
+	kinds := map[schema.GroupKind]bool{
+		{Group: "apiextensions.k8s.io", Kind: "CustomResourceDefinition"}: *crdFlag,
+		{Group: "rbac.authorization.k8s.io", Kind: "ClusterRole"}:         *crFlag,
+		{Group: "rbac.authorization.k8s.io", Kind: "ClusterRoleBinding"}:  *crbFlag,
+		{Kind: "ServiceAccount"}:                                  *saFlag,
+		{Group: "rbac.authorization.k8s.io", Kind: "Role"}:        *roleFlag,
+		{Group: "rbac.authorization.k8s.io", Kind: "RoleBinding"}: *rbFlag,
+		{Group: "networking.k8s.io", Kind: "NetworkPolicy"}:       *npFlag,
+		{Kind: "Service"}: *serviceFlag,
+		{Group: "storage.k8s.io", Kind: "StorageClass"}: *scFlag,
+		{Kind: "PersistentVolumeClaim"}:                 *pvcFlag,
+		{Group: "batch", Kind: "Job"}:                   *jobFlag,
+		{Group: "batch", Kind: "CronJob"}:               *cronFlag,
+		{Group: "apps", Kind: "Deployment"}:             *deploymentFlag,
+		{Group: "apps", Kind: "StatefulSet"}:            *statefulSetFlag,
 	}
 
-	sourceKubeConfig, err := helpers.GetKubeConfig(*srcEksClusterName, *kubeconfig)
+	locking := lockOptions{namespace: *lockNamespace, breakLock: *breakLock}
+	switch command {
+	case "restore":
+		code := restore(targetKubeConfig, utils.NormalizePath(*runsDir), *backupID, locking, options)
+		klog.Flush()
+		os.Exit(code)
+	case "validate":
+		match := manifestMatcher(kinds, customResourceKinds(targetKubeConfig, eksFilesRootPath, *customResourceFlag))
+		code := validate(targetKubeConfig, eksFilesRootPath, match, filter)
+		klog.Flush()
+		os.Exit(code)
+	case "rollback":
+		code := rollback(targetKubeConfig, utils.NormalizePath(*runsDir), rollbackID, locking, options)
+		klog.Flush()
+		os.Exit(code)
+	}
+
+	sourceKubeConfig, err := loadKubeConfig(*sourceKubeconfig, *sourceContext, eks_auth.Options{
+		ClusterName: *sourceEksCluster,
+		Profile:     *awsProfile,
+		Region:      *awsRegion,
+		STSEndpoint: *stsEndpoint,
+		TokenFile:   utils.NormalizePath(*sourceTokenFile),
+		Token:       *sourceToken,
+	})
 	if err != nil {
-		panic(err)
+		klog.Exitf("Failed to load source kubeconfig: %s", err)
 	}
+	helpers.SetRateLimit(sourceKubeConfig, float32(*qps), *burst)
 
-	klog.Infof("Starting to sync k8s resources from %s in %s ...", sourceKubeConfig.Host, *environ)
-	if *deploymentFlag {
-		klog.Infof("Syncing k8s deployment resources to %s ...", targetKubeConfig.Host)
-		deployments := helpers.LoadDeploymentYamlFiles(eksFilesRootPath)
-		for _, d := range deployments {
-			klog.Infof("* Deployment: %s\n", d.ObjectMeta.Name)
-		}
-		deployments = helpers.SyncDeployments(sourceKubeConfig, deployments)
-		//PrintDeployments(deployments)
-		helpers.ApplyDeployments(targetKubeConfig, deployments)
-	} else if *serviceFlag {
-		klog.Infof("Syncing k8s service resources to %s ...", targetKubeConfig.Host)
-		services := helpers.LoadServiceYamlFiles(eksFilesRootPath)
-		for _, s := range services {
-			klog.Infof("* Service: %s\n", s.ObjectMeta.Name)
-		}
-		services = helpers.SyncServices(sourceKubeConfig, services, *environ)
-		//PrintServices(services)
-		helpers.ApplyServices(targetKubeConfig, services)
-	} else if *cronFlag {
-		klog.Infof("Syncing k8s cron jobs to %s ...", targetKubeConfig.Host)
-		cronJobs := helpers.LoadCronJobYamlFiles(eksFilesRootPath)
-		for _, job := range cronJobs {
-			klog.Infof("* cron job: %s\n", job.ObjectMeta.Name)
-		}
-		cronJobs = helpers.SyncCronJobs(sourceKubeConfig, cronJobs)
-		//PrintCronJobs(cronJobs)
-		helpers.ApplyCronJobs(targetKubeConfig, cronJobs)
-	} else if *saFlag {
-		klog.Infof("Syncing k8s service accounts to %s ...", targetKubeConfig.Host)
-		serviceAccounts := helpers.LoadServiceAccountYamlFiles(eksFilesRootPath)
-		for _, account := range serviceAccounts {
-			klog.Infof("* service account: %s\n", account.ObjectMeta.Name)
-		}
-		serviceAccounts = helpers.SyncServiceAccounts(sourceKubeConfig, serviceAccounts)
-		//PrintCronJobs(cronJobs)
-		helpers.ApplyServiceAccounts(targetKubeConfig, serviceAccounts)
-	} else if *crFlag {
-		klog.Infof("Syncing k8s cluster roles to %s ...", targetKubeConfig.Host)
-		clusterRoles := helpers.LoadClusterRoleYamlFiles(eksFilesRootPath)
-		for _, role := range clusterRoles {
-			klog.Infof("* cluster role: %s\n", role.ObjectMeta.Name)
-		}
-		clusterRoles = helpers.SyncClusterRoles(sourceKubeConfig, clusterRoles)
-		//PrintClusterRoles(clusterRoles)
-		helpers.ApplyClusterRoles(targetKubeConfig, clusterRoles)
-	} else if *crbFlag {
-		klog.Infof("Syncing k8s cluster role bindings to %s ...", targetKubeConfig.Host)
-		clusterRoleBindings := helpers.LoadClusterRoleBindingYamlFiles(eksFilesRootPath)
-		for _, roleBinding := range clusterRoleBindings {
-			klog.Infof("* cluster role binding: %s\n", roleBinding.ObjectMeta.Name)
-		}
-		clusterRoleBindings = helpers.SyncClusterRoleBindings(sourceKubeConfig, clusterRoleBindings)
-		//PrintClusterRoleBindings(clusterRoleBindings)
-		helpers.ApplyClusterRoleBindings(targetKubeConfig, clusterRoleBindings)
-	} else {
+	if helpers.SameHost(sourceKubeConfig, targetKubeConfig) {
+		klog.Exitf("Source and target clusters resolve to the same API server: %s, refusing to sync", targetKubeConfig.Host)
+	}
+
+	customResources := customResourceKinds(sourceKubeConfig, eksFilesRootPath, *customResourceFlag)
+	match := manifestMatcher(kinds, customResources)
+
+	imageOptions := helpers.ImageOptions{
+		DockerConfig: utils.NormalizePath(*dockerConfig),
+		Insecure:     map[string]bool{},
+	}
+	for _, host := range strings.Split(*insecureRegistries, ",") {
+		if host = strings.TrimSpace(host); len(host) > 0 {
+			imageOptions.Insecure[host] = true
+		}
+	}
+
+	run := &syncRun{
+		source:          sourceKubeConfig,
+		target:          targetKubeConfig,
+		rootPath:        eksFilesRootPath,
+		environ:         *environ,
+		namespaceMap:    namespaceMap,
+		storageClassMap: storageClassMap,
+		cidrTranslator:  cidrTranslator,
+		mergeRules:      mergeRules,
+		filter:          filter,
+		customResources: customResources,
+		jobOptions: helpers.JobOptions{
+			Mode:    *jobMode,
+			Suffix:  time.Now().Format("20060102150405"),
+			Wait:    *jobWait,
+			Logs:    *jobLogs,
+			Timeout: *jobTimeout,
+		},
+		crdTimeout: *crdTimeout,
+	}
+	if *pinDigests || len(registryMap) > 0 {
+		run.images, err = helpers.NewImageRewriter(sourceKubeConfig, imageOptions)
+		if err != nil {
+			klog.Exitf("Failed to set up image rewriting: %s", err)
+		}
+		run.images.PinDigests = *pinDigests
+		run.images.Registries = registry.Mapping(registryMap)
+	}
+	if len(*pvcCopyHook) > 0 {
+		run.pvcCopyHook = &helpers.CommandDataCopyHook{
+			Command:    *pvcCopyHook,
+			SourceHost: sourceKubeConfig.Host,
+			TargetHost: targetKubeConfig.Host,
+		}
+	}
+
+	// Kinds are synced in dependency order: CRDs, RBAC and service accounts
+	// first, then networking, storage and custom resources, and finally the
+	// workloads, where one-shot jobs (e.g. DB migrations) run before cron jobs,
+	// stateful sets and deployments.
+	steps := []syncStep{
+		{*crdFlag, run.syncCustomResourceDefinitions},
+		{*crFlag, run.syncClusterRoles},
+		{*crbFlag, run.syncClusterRoleBindings},
+		{*saFlag, run.syncServiceAccounts},
+		{*roleFlag, run.syncRoles},
+		{*rbFlag, run.syncRoleBindings},
+		{*npFlag, run.syncNetworkPolicies},
+		{*serviceFlag, run.syncServices},
+		{*scFlag, run.syncStorageClasses},
+		{*pvcFlag, run.syncPersistentVolumeClaims},
+		{*customResourceFlag, run.syncCustomResources},
+		{*jobFlag, run.syncJobs},
+		{*cronFlag, run.syncCronJobs},
+		{*statefulSetFlag, run.syncStatefulSets},
+		{*deploymentFlag, run.syncDeployments},
+	}
+
+	enabled := false
+	for _, step := range steps {
+		enabled = enabled || step.enabled
+	}
+	if !enabled {
 		klog.Infoln("No specified k8s resources to sync, exit !")
 		Usage()
+		os.Exit(0)
+	}
+
+	ctx, cancel := utils.WithInterrupt(k8s_resources.WithOptions(context.Background(), options))
+	defer cancel()
+	if *timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+
+	if !*noValidate {
+		if validate(targetKubeConfig, eksFilesRootPath, match, filter) != 0 {
+			klog.Exitln("Invalid manifests, nothing changed. Fix them, or skip the validation with -no-validate.")
+		}
+	}
+
+	if !*noAccessCheck {
+		accessOptions := helpers.AccessOptions{
+			NamespaceMap:    namespaceMap,
+			Jobs:            run.jobOptions,
+			LockNamespace:   locking.namespace,
+			PullSecrets:     *verifyImagesFlag,
+			PinDigests:      *pinDigests && (*deploymentFlag || *statefulSetFlag || *cronFlag),
+			DataCopy:        *pvcFlag && run.pvcCopyHook != nil,
+			CustomResources: customResources,
+		}
+		if checkAccess(ctx, sourceKubeConfig, targetKubeConfig, eksFilesRootPath, match, filter, accessOptions) != 0 {
+			klog.Exitln("Missing permissions, nothing changed. Grant them, or skip the check with -no-access-check.")
+		}
+	}
+
+	if *verifyImagesFlag && (*deploymentFlag || *statefulSetFlag || *cronFlag || *jobFlag) {
+		if verifyImages(ctx, run, *deploymentFlag, *statefulSetFlag, *cronFlag, *jobFlag, imageOptions) != 0 {
+			klog.Exitln("Images missing in the target registries, nothing changed.")
+		}
+	}
+
+	var b *backup.Backup
+	started := time.Now()
+	runID := started.Format("20060102-150405")
+	if !*noBackup {
+		b, err = backup.New(utils.NormalizePath(*runsDir), targetKubeConfig.Host)
+		if err != nil {
+			klog.Exitf("Failed to create backup: %s", err)
+		}
+		runID = b.ID()
+	}
+
+	runLock, ctx, err := locking.acquire(ctx, targetKubeConfig, runID)
+	if err != nil {
+		if b != nil {
+			os.RemoveAll(b.Dir)
+		}
+		klog.Exitln(err)
+	}
+
+	// Prod runs are planned and confirmed first, and so are runs whose
+	// policy must fail before anything is applied.
+	confirm := *environ == prodEnviron && !*yes
+	if confirm || policy.Mode == helpers.PolicyModeFail {
+		klog.Infof("Planning the changes to %s ...", targetKubeConfig.Host)
+		plan, err := run.plan(ctx, steps)
+		fmt.Println()
+		plan.PrintPlan(os.Stdout)
+		printImageRewrites(run.images)
+
+		targetName := *targetEksCluster
+		if len(targetName) == 0 {
+			targetName = *targetContext
+		}
+		if len(targetName) == 0 {
+			targetName = targetKubeConfig.Host
+		}
+
+		refused := ""
+		switch {
+		case err != nil:
+			refused = fmt.Sprintf("Failed to plan the changes: %s", err)
+		case plan.Count(helpers.ResultDenied) > 0:
+			refused = fmt.Sprintf("The run would change %d objects protected by the policy, nothing changed.", plan.Count(helpers.ResultDenied))
+		case confirm && !confirmTarget(targetName):
+			refused = "Not confirmed, nothing changed."
+		}
+		if len(refused) > 0 {
+			klog.Errorln(refused)
+			runLock.Release()
+			if b != nil {
+				os.RemoveAll(b.Dir)
+			}
+			klog.Flush()
+			os.Exit(1)
+		}
+	}
+
+	if b != nil {
+		options.Snapshots = b
+		klog.Infof("Backing up the target objects to %s, roll the run back with: %s rollback %s", b.Dir, os.Args[0], b.ID())
+	}
+	if *interactive {
+		gate := &objectGate{}
+		if b != nil {
+			gate.next = b
+		}
+		options.Snapshots = gate
+	}
+	ctx = k8s_resources.WithOptions(ctx, options)
+
+	klog.Infof("Starting to sync k8s resources from %s in %s ...", sourceKubeConfig.Host, *environ)
+	for _, step := range steps {
+		if !step.enabled {
+			continue
+		}
+
+		if utils.Interrupted(ctx) {
+			klog.Warningln("Sync interrupted, skipping the remaining k8s resources.")
+			break
+		}
+
+		err = step.sync(ctx)
+		if err != nil {
+			klog.Errorf("Stopping sync, err was: %s", err)
+			break
+		}
+	}
+
+	fmt.Println()
+	run.report.PrintSummary(os.Stdout)
+	printImageRewrites(run.images)
+
+	outcome := ledger.OutcomeSucceeded
+	switch {
+	case utils.Interrupted(ctx):
+		outcome = ledger.OutcomeInterrupted
+	case err != nil || run.report.Failed():
+		outcome = ledger.OutcomeFailed
+	}
+
+	runLock.Release()
+
+	if b != nil {
+		recordRun(utils.NormalizePath(*runsDir), b, &ledger.Run{
+			ID:       b.ID(),
+			Started:  started,
+			Finished: time.Now(),
+			Args:     ledger.RedactArgs(os.Args[1:]),
+			Source:   sourceKubeConfig.Host,
+			Target:   targetKubeConfig.Host,
+			Outcome:  outcome,
+		}, targetKubeConfig, run.report)
+	}
+
+	if outcome != ledger.OutcomeSucceeded {
+		klog.Flush()
+		os.Exit(1)
 	}
 }
 
+// loadKubeConfig loads a context of a kubeconfig file, replacing its
+// authentication according to auth.
+func loadKubeConfig(path, context string, auth eks_auth.Options) (*rest.Config, error) {
+	config, err := helpers.GetKubeConfig(context, utils.NormalizePath(path))
+	if err != nil {
+		return nil, err
+	}
+
+	err = eks_auth.Configure(config, auth)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure authentication: %s", err)
+	}
+
+	return config, nil
+}
+
 func Usage() {
 	fmt.Println()
-	fmt.Printf("Usage of %s:\n", os.Args[0])
+	fmt.Printf("Usage of %s [validate | restore -backup <run-id> | history | rollback <run-id>] [flags]:\n", os.Args[0])
 	flag.PrintDefaults()
 }
+
+// exitUsage logs an invalid use of the command line and exits with the usage
+// and code 2, like the flag parser does.
+func exitUsage(format string, args ...interface{}) {
+	klog.Errorf(format, args...)
+	Usage()
+	klog.Flush()
+	os.Exit(2)
+}
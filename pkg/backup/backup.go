@@ -0,0 +1,232 @@
+package backup
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v2"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/mwlng/k8s_resources_sync/pkg/dyna_client"
+)
+
+const (
+	indexFile = "index.yaml"
+
+	// idFormat names the backup directories, so that they sort by time.
+	idFormat = "20060102-150405"
+	// maxIDAttempts is the number of backups that can be created in the
+	// same second in one directory. The ones after the first get a counter
+	// suffix, e.g. 20060102-150405-2.
+	maxIDAttempts = 100
+)
+
+// Entry is an object touched by a sync run. Objects that existed before
+// are saved to File, objects that were created have no file.
+type Entry struct {
+	APIVersion string `yaml:"apiVersion"`
+	Kind       string `yaml:"kind"`
+	Namespace  string `yaml:"namespace,omitempty"`
+	Name       string `yaml:"name"`
+	Existed    bool   `yaml:"existed"`
+	File       string `yaml:"file,omitempty"`
+}
+
+func (e Entry) GroupVersionKind() schema.GroupVersionKind {
+	return schema.FromAPIVersionAndKind(e.APIVersion, e.Kind)
+}
+
+func (e Entry) String() string {
+	if len(e.Namespace) > 0 {
+		return fmt.Sprintf("%s %s/%s", e.Kind, e.Namespace, e.Name)
+	}
+	return fmt.Sprintf("%s %s", e.Kind, e.Name)
+}
+
+// Index is the manifest of a backup, with its entries in the order the
+// objects were touched.
+type Index struct {
+	ID      string    `yaml:"id"`
+	Created time.Time `yaml:"created"`
+	Target  string    `yaml:"target"`
+	Entries []Entry   `yaml:"entries"`
+}
+
+// Backup is a directory holding the prior state of every object a sync run
+// touched, together with an index.yaml manifest. It implements
+// k8s_resources.Snapshotter.
+type Backup struct {
+	Dir string
+
+	lock  sync.Mutex
+	index Index
+	// seen holds the index of the entry of each snapshotted object.
+	seen map[string]int
+}
+
+// New creates an empty, timestamped backup in rootDir for the target
+// cluster host. Its ID is unique in rootDir, even when other runs create
+// backups there in the same second.
+func New(rootDir, target string) (*Backup, error) {
+	now := time.Now()
+	if err := os.MkdirAll(rootDir, 0700); err != nil {
+		return nil, err
+	}
+
+	var id, dir string
+	for attempt := 1; ; attempt++ {
+		id = now.Format(idFormat)
+		if attempt > 1 {
+			id = fmt.Sprintf("%s-%d", id, attempt)
+		}
+		dir = filepath.Join(rootDir, id)
+
+		err := os.Mkdir(dir, 0700)
+		if err == nil {
+			break
+		}
+		if !os.IsExist(err) || attempt >= maxIDAttempts {
+			return nil, err
+		}
+	}
+
+	b := &Backup{
+		Dir:   dir,
+		index: Index{ID: id, Created: now, Target: target},
+		seen:  map[string]int{},
+	}
+
+	return b, b.writeIndex()
+}
+
+// Open loads the backup id from rootDir.
+func Open(rootDir, id string) (*Backup, error) {
+	dir := filepath.Join(rootDir, id)
+	data, err := ioutil.ReadFile(filepath.Join(dir, indexFile))
+	if err != nil {
+		return nil, err
+	}
+
+	b := &Backup{Dir: dir, seen: map[string]int{}}
+	if err := yaml.Unmarshal(data, &b.index); err != nil {
+		return nil, fmt.Errorf("invalid backup index %s: %s", filepath.Join(dir, indexFile), err)
+	}
+
+	return b, nil
+}
+
+func (b *Backup) ID() string {
+	return b.index.ID
+}
+
+func (b *Backup) Target() string {
+	return b.index.Target
+}
+
+// Entries returns the touched objects in the order they were touched.
+func (b *Backup) Entries() []Entry {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	return append([]Entry{}, b.index.Entries...)
+}
+
+// Snapshot saves current, the state of an object before the sync run
+// changes it. Only the first snapshot of each object is kept, since later
+// ones may already see the changes of the run, unless the first one was
+// taken before a create that found the object already there, e.g. made by
+// another writer, and was retried as an update: the object wasn't created
+// by the run and is saved as it was found.
+func (b *Backup) Snapshot(gvk schema.GroupVersionKind, namespace, name string, current runtime.Object) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	key := gvk.GroupKind().String() + "/" + namespace + "/" + name
+	i, seen := b.seen[key]
+	if seen && (b.index.Entries[i].Existed || current == nil) {
+		return nil
+	}
+
+	apiVersion, kind := gvk.ToAPIVersionAndKind()
+	entry := Entry{APIVersion: apiVersion, Kind: kind, Namespace: namespace, Name: name}
+	if current != nil {
+		obj, err := toUnstructured(current)
+		if err != nil {
+			return err
+		}
+		obj.SetAPIVersion(apiVersion)
+		obj.SetKind(kind)
+		obj.SetManagedFields(nil)
+
+		data, err := yaml.Marshal(obj.Object)
+		if err != nil {
+			return err
+		}
+
+		entry.Existed = true
+		entry.File = filepath.Join(gvk.Group, kind, namespace, name+".yaml")
+		path := filepath.Join(b.Dir, entry.File)
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(path, data, 0600); err != nil {
+			return err
+		}
+	}
+
+	if seen {
+		b.index.Entries[i] = entry
+	} else {
+		b.seen[key] = len(b.index.Entries)
+		b.index.Entries = append(b.index.Entries, entry)
+	}
+
+	return b.writeIndex()
+}
+
+// Load reads the saved state of an object that existed before the run.
+func (b *Backup) Load(entry Entry) (*unstructured.Unstructured, error) {
+	data, err := ioutil.ReadFile(filepath.Join(b.Dir, entry.File))
+	if err != nil {
+		return nil, err
+	}
+
+	obj, _, err := dyna_client.UnstructuredDecode(data)
+	return obj, err
+}
+
+// writeIndex rewrites the index after every entry, so that a backup is
+// usable even if the run dies halfway.
+func (b *Backup) writeIndex() error {
+	data, err := yaml.Marshal(&b.index)
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(b.Dir, indexFile)
+	if err := ioutil.WriteFile(path+".tmp", data, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(path+".tmp", path)
+}
+
+func toUnstructured(obj runtime.Object) (*unstructured.Unstructured, error) {
+	if u, ok := obj.(*unstructured.Unstructured); ok {
+		return u.DeepCopy(), nil
+	}
+
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	return &unstructured.Unstructured{Object: content}, nil
+}
@@ -0,0 +1,29 @@
+package backup
+
+import (
+	"testing"
+)
+
+func TestNewUniqueID(t *testing.T) {
+	dir := t.TempDir()
+
+	ids := map[string]bool{}
+	for i := 0; i < 3; i++ {
+		b, err := New(dir, "https://target")
+		if err != nil {
+			t.Fatalf("New() #%d failed: %s", i+1, err)
+		}
+		if ids[b.ID()] {
+			t.Errorf("New() #%d reused ID %s", i+1, b.ID())
+		}
+		ids[b.ID()] = true
+
+		opened, err := Open(dir, b.ID())
+		if err != nil {
+			t.Fatalf("Open(%s) failed: %s", b.ID(), err)
+		}
+		if opened.ID() != b.ID() {
+			t.Errorf("Open(%s).ID() = %s", b.ID(), opened.ID())
+		}
+	}
+}
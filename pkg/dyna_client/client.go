@@ -8,7 +8,6 @@ import (
 
 	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
-	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/runtime/serializer/yaml"
 	"k8s.io/apimachinery/pkg/types"
@@ -19,10 +18,11 @@ import (
 	"k8s.io/client-go/restmapper"
 )
 
+var unstructuredDEC = yaml.NewDecodingSerializer(unstructured.UnstructuredJSONScheme)
+
 type DynaClient struct {
-	client          dynamic.Interface
-	mapper          *restmapper.DeferredDiscoveryRESTMapper
-	unstructuredDEC runtime.Serializer
+	client dynamic.Interface
+	mapper *restmapper.DeferredDiscoveryRESTMapper
 }
 
 func NewDynaClient(config *rest.Config) (*DynaClient, error) {
@@ -30,24 +30,30 @@ func NewDynaClient(config *rest.Config) (*DynaClient, error) {
 	if err != nil {
 		return nil, err
 	}
-	mapper := restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(dc))
 
 	dyn, err := dynamic.NewForConfig(config)
 	if err != nil {
 		return nil, err
 	}
 
+	return NewDynaClientWith(dyn, memory.NewMemCacheClient(dc)), nil
+}
+
+// NewDynaClientWith builds a DynaClient from existing clients, sharing the
+// discovery cache with whoever else uses it.
+func NewDynaClientWith(client dynamic.Interface, cached discovery.CachedDiscoveryInterface) *DynaClient {
 	return &DynaClient{
-		client:          dyn,
-		mapper:          mapper,
-		unstructuredDEC: yaml.NewDecodingSerializer(unstructured.UnstructuredJSONScheme),
-	}, nil
+		client: client,
+		mapper: restmapper.NewDeferredDiscoveryRESTMapper(cached),
+	}
 }
 
-func (d *DynaClient) UnstructuredDecode(yaml []byte) (*unstructured.Unstructured, *schema.GroupVersionKind, error) {
+// UnstructuredDecode decodes a YAML or JSON manifest of any kind into an
+// unstructured object.
+func UnstructuredDecode(yaml []byte) (*unstructured.Unstructured, *schema.GroupVersionKind, error) {
 	obj := &unstructured.Unstructured{}
 
-	_, gvk, err := d.unstructuredDEC.Decode(yaml, nil, obj)
+	_, gvk, err := unstructuredDEC.Decode(yaml, nil, obj)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -55,24 +61,58 @@ func (d *DynaClient) UnstructuredDecode(yaml []byte) (*unstructured.Unstructured
 	return obj, gvk, err
 }
 
-func (d *DynaClient) Apply(yaml []byte, fieldManager string) error {
-	obj, gvk, err := d.UnstructuredDecode(yaml)
+func (d *DynaClient) UnstructuredDecode(yaml []byte) (*unstructured.Unstructured, *schema.GroupVersionKind, error) {
+	return UnstructuredDecode(yaml)
+}
+
+func (d *DynaClient) Apply(ctx context.Context, yaml []byte, fieldManager string) error {
+	obj, _, err := d.UnstructuredDecode(yaml)
 	if err != nil {
 		return err
 	}
 
+	return d.ApplyObject(ctx, obj, fieldManager, false)
+}
+
+// ResourceFor returns the dynamic resource client for the kind and
+// namespace of obj, resolved through the RESTMapper.
+func (d *DynaClient) ResourceFor(obj *unstructured.Unstructured) (dynamic.ResourceInterface, error) {
+	gvk := obj.GroupVersionKind()
 	mapping, err := d.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	var dr dynamic.ResourceInterface
 	if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
 		// namespaced resources should specify the namespace
-		dr = d.client.Resource(mapping.Resource).Namespace(obj.GetNamespace())
-	} else {
-		// for cluster-wide resources
-		dr = d.client.Resource(mapping.Resource)
+		namespace := obj.GetNamespace()
+		if len(namespace) == 0 {
+			namespace = metav1.NamespaceDefault
+		}
+		return d.client.Resource(mapping.Resource).Namespace(namespace), nil
+	}
+
+	// for cluster-wide resources
+	return d.client.Resource(mapping.Resource), nil
+}
+
+// Get fetches the live state of the object identified by the kind,
+// namespace and name of obj.
+func (d *DynaClient) Get(ctx context.Context, obj *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	dr, err := d.ResourceFor(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	return dr.Get(ctx, obj.GetName(), metav1.GetOptions{})
+}
+
+// ApplyObject server-side applies obj. With force set, fields owned by other
+// field managers are taken over instead of reported as conflicts.
+func (d *DynaClient) ApplyObject(ctx context.Context, obj *unstructured.Unstructured, fieldManager string, force bool) error {
+	dr, err := d.ResourceFor(obj)
+	if err != nil {
+		return err
 	}
 
 	data, err := json.Marshal(obj)
@@ -80,8 +120,9 @@ func (d *DynaClient) Apply(yaml []byte, fieldManager string) error {
 		return err
 	}
 
-	_, err = dr.Patch(context.TODO(), obj.GetName(), types.ApplyPatchType, data, metav1.PatchOptions{
+	_, err = dr.Patch(ctx, obj.GetName(), types.ApplyPatchType, data, metav1.PatchOptions{
 		FieldManager: fieldManager,
+		Force:        &force,
 	})
 
 	if err != nil {
@@ -90,3 +131,85 @@ func (d *DynaClient) Apply(yaml []byte, fieldManager string) error {
 
 	return nil
 }
+
+// DryRunApplyObject server-side applies obj without persisting it, and
+// returns the object the API server would have stored.
+func (d *DynaClient) DryRunApplyObject(ctx context.Context, obj *unstructured.Unstructured, fieldManager string, force bool) (*unstructured.Unstructured, error) {
+	dr, err := d.ResourceFor(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	return dr.Patch(ctx, obj.GetName(), types.ApplyPatchType, data, metav1.PatchOptions{
+		DryRun:       []string{metav1.DryRunAll},
+		FieldManager: fieldManager,
+		Force:        &force,
+	})
+}
+
+// List lists the objects of the kind of obj, in the namespace of obj if the
+// kind is namespaced, in pages of limit objects.
+func (d *DynaClient) List(ctx context.Context, obj *unstructured.Unstructured, limit int64) ([]unstructured.Unstructured, error) {
+	dr, err := d.ResourceFor(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	items := []unstructured.Unstructured{}
+	opts := metav1.ListOptions{Limit: limit}
+	for {
+		list, err := dr.List(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+
+		items = append(items, list.Items...)
+		if len(list.GetContinue()) == 0 {
+			return items, nil
+		}
+		opts.Continue = list.GetContinue()
+	}
+}
+
+// ResetMapper invalidates the cached discovery information, e.g. after new
+// CustomResourceDefinitions have been established.
+func (d *DynaClient) ResetMapper() {
+	d.mapper.Reset()
+}
+
+func (d *DynaClient) Create(ctx context.Context, obj *unstructured.Unstructured) error {
+	dr, err := d.ResourceFor(obj)
+	if err != nil {
+		return err
+	}
+
+	_, err = dr.Create(ctx, obj, metav1.CreateOptions{})
+	return err
+}
+
+func (d *DynaClient) Update(ctx context.Context, obj *unstructured.Unstructured) error {
+	dr, err := d.ResourceFor(obj)
+	if err != nil {
+		return err
+	}
+
+	_, err = dr.Update(ctx, obj, metav1.UpdateOptions{})
+	return err
+}
+
+// Delete deletes the object identified by the kind, namespace and name of
+// obj, together with its dependents.
+func (d *DynaClient) Delete(ctx context.Context, obj *unstructured.Unstructured) error {
+	dr, err := d.ResourceFor(obj)
+	if err != nil {
+		return err
+	}
+
+	propagation := metav1.DeletePropagationForeground
+	return dr.Delete(ctx, obj.GetName(), metav1.DeleteOptions{PropagationPolicy: &propagation})
+}
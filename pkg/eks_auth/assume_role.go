@@ -0,0 +1,154 @@
+package eks_auth
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	stsVersion = "2011-06-15"
+	stsTimeout = 30 * time.Second
+
+	// defaultRoleSessionName names the sessions of the assumed roles when the
+	// profile has no role_session_name, suffixed with the time they start.
+	defaultRoleSessionName = "k8s-resources-sync"
+)
+
+// stsClient calls the STS API of a region.
+type stsClient struct {
+	region   string
+	endpoint string
+	client   *http.Client
+	now      func() time.Time
+}
+
+func newSTSClient(region, endpoint string) *stsClient {
+	return &stsClient{
+		region:   region,
+		endpoint: endpoint,
+		client:   &http.Client{Timeout: stsTimeout},
+		now:      time.Now,
+	}
+}
+
+// assumeRoleResponse is the part of the AssumeRole response kept, and
+// stsErrorResponse the error returned instead.
+type assumeRoleResponse struct {
+	Credentials struct {
+		AccessKeyId     string
+		SecretAccessKey string
+		SessionToken    string
+		Expiration      time.Time
+	} `xml:"AssumeRoleResult>Credentials"`
+}
+
+type stsErrorResponse struct {
+	Code    string `xml:"Error>Code"`
+	Message string `xml:"Error>Message"`
+}
+
+// assumeRole returns the temporary credentials of roleARN, signing the
+// request with source. params are the optional AssumeRole parameters, like
+// ExternalId and DurationSeconds.
+func (c *stsClient) assumeRole(source *Credentials, roleARN, sessionName string, params url.Values) (*Credentials, error) {
+	u, err := url.Parse(c.endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid STS endpoint %q: %s", c.endpoint, err)
+	}
+	if len(u.Host) == 0 {
+		return nil, fmt.Errorf("invalid STS endpoint %q: no host", c.endpoint)
+	}
+	if len(u.Path) == 0 {
+		u.Path = "/"
+	}
+
+	form := url.Values{}
+	for k, v := range params {
+		form[k] = v
+	}
+	form.Set("Action", "AssumeRole")
+	form.Set("Version", stsVersion)
+	form.Set("RoleArn", roleARN)
+	form.Set("RoleSessionName", sessionName)
+	body := form.Encode()
+
+	req, err := http.NewRequest(http.MethodPost, u.String(), strings.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	s := signer{creds: source, region: c.region, service: stsService}
+	s.sign(req, payloadHash([]byte(body)), c.now())
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to assume role %s: %s", roleARN, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to assume role %s: %s", roleARN, err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var stsErr stsErrorResponse
+		if err := xml.Unmarshal(data, &stsErr); err != nil || len(stsErr.Code) == 0 {
+			return nil, fmt.Errorf("failed to assume role %s: %s", roleARN, resp.Status)
+		}
+		return nil, fmt.Errorf("failed to assume role %s: %s: %s", roleARN, stsErr.Code, stsErr.Message)
+	}
+
+	var assumed assumeRoleResponse
+	if err := xml.Unmarshal(data, &assumed); err != nil {
+		return nil, fmt.Errorf("invalid AssumeRole response for role %s: %s", roleARN, err)
+	}
+	creds := assumed.Credentials
+	if len(creds.AccessKeyId) == 0 || len(creds.SecretAccessKey) == 0 {
+		return nil, fmt.Errorf("invalid AssumeRole response for role %s: no credentials", roleARN)
+	}
+
+	return &Credentials{
+		AccessKeyID:     creds.AccessKeyId,
+		SecretAccessKey: creds.SecretAccessKey,
+		SessionToken:    creds.SessionToken,
+		Expires:         creds.Expiration,
+	}, nil
+}
+
+// newAssumeRoleCredentials returns the credentials of the role roleARN of a
+// profile with settings, assumed with the credentials of source and
+// assumed again before they expire.
+func newAssumeRoleCredentials(sts *stsClient, source CredentialsProvider, roleARN string, settings map[string]string) (CredentialsProvider, error) {
+	params := url.Values{}
+	if externalID := settings["external_id"]; len(externalID) > 0 {
+		params.Set("ExternalId", externalID)
+	}
+	if duration := settings["duration_seconds"]; len(duration) > 0 {
+		if _, err := strconv.Atoi(duration); err != nil {
+			return nil, fmt.Errorf("invalid duration_seconds %q for role %s", duration, roleARN)
+		}
+		params.Set("DurationSeconds", duration)
+	}
+	sessionName := settings["role_session_name"]
+
+	return newRefreshingCredentials(func() (*Credentials, error) {
+		creds, err := source.Retrieve()
+		if err != nil {
+			return nil, err
+		}
+
+		name := sessionName
+		if len(name) == 0 {
+			name = fmt.Sprintf("%s-%d", defaultRoleSessionName, sts.now().Unix())
+		}
+
+		return sts.assumeRole(creds, roleARN, name, params)
+	}), nil
+}
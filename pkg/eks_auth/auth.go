@@ -0,0 +1,121 @@
+package eks_auth
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"k8s.io/client-go/rest"
+)
+
+// Options select how the clients of a cluster authenticate. At most one of
+// ClusterName, TokenFile and Token may be set; when none is, the auth
+// declared in the kubeconfig is used.
+type Options struct {
+	// ClusterName generates EKS tokens natively for the named cluster,
+	// signed with the AWS credentials of Profile. Roles of profiles are
+	// assumed with the STS endpoint of Region, or STSEndpoint if set.
+	ClusterName string
+	Profile     string
+	Region      string
+	STSEndpoint string
+
+	// TokenFile is a file holding a bearer token, re-read periodically.
+	TokenFile string
+	// Token is a static bearer token.
+	Token string
+}
+
+// Configure replaces the authentication of config according to opts.
+func Configure(config *rest.Config, opts Options) error {
+	modes := 0
+	for _, s := range []string{opts.ClusterName, opts.TokenFile, opts.Token} {
+		if len(s) > 0 {
+			modes++
+		}
+	}
+	switch {
+	case modes == 0:
+		return nil
+	case modes > 1:
+		return fmt.Errorf("only one of an EKS cluster name, a token file and a token can be used")
+	}
+
+	// Drop whatever the kubeconfig declared, in particular exec plugins
+	// which may not be installed.
+	config.ExecProvider = nil
+	config.AuthProvider = nil
+	config.Username = ""
+	config.Password = ""
+	config.BearerToken = ""
+	config.BearerTokenFile = ""
+
+	switch {
+	case len(opts.Token) > 0:
+		config.BearerToken = opts.Token
+	case len(opts.TokenFile) > 0:
+		config.BearerTokenFile = opts.TokenFile
+	default:
+		creds, err := LoadCredentials(opts.Profile, opts.Region, opts.STSEndpoint)
+		if err != nil {
+			return err
+		}
+
+		generator := NewTokenGenerator(opts.ClusterName, opts.Region, opts.STSEndpoint, creds)
+		if _, _, err := generator.Token(); err != nil {
+			return err
+		}
+
+		config.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+			return &tokenRoundTripper{generator: generator, next: rt}
+		})
+	}
+
+	return nil
+}
+
+// tokenRoundTripper adds an EKS token to every request, signing a new one
+// before the current one expires.
+type tokenRoundTripper struct {
+	generator *TokenGenerator
+	next      http.RoundTripper
+
+	lock   sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+func (t *tokenRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if len(req.Header.Get("Authorization")) > 0 {
+		return t.next.RoundTrip(req)
+	}
+
+	token, err := t.currentToken()
+	if err != nil {
+		return nil, err
+	}
+
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+token)
+	return t.next.RoundTrip(req)
+}
+
+func (t *tokenRoundTripper) currentToken() (string, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if len(t.token) == 0 || !t.generator.now().Before(t.expiry) {
+		token, expiry, err := t.generator.Token()
+		if err != nil {
+			return "", err
+		}
+		t.token, t.expiry = token, expiry
+	}
+
+	return t.token, nil
+}
+
+func (t *tokenRoundTripper) WrappedRoundTripper() http.RoundTripper {
+	return t.next
+}
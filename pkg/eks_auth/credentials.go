@@ -0,0 +1,319 @@
+package eks_auth
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mwlng/k8s_resources_sync/pkg/utils"
+)
+
+const (
+	defaultProfile = "default"
+
+	// refreshMargin is how long before they expire temporary credentials
+	// are replaced.
+	refreshMargin = 5 * time.Minute
+)
+
+// errNoCredentials is returned for a profile that doesn't exist or declares
+// no credentials.
+var errNoCredentials = errors.New("no credentials")
+
+// Credentials are the AWS credentials the tokens are signed with. Expires
+// is zero for long-term credentials.
+type Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	Expires         time.Time
+}
+
+// CredentialsProvider returns the AWS credentials, replacing temporary ones
+// before they expire.
+type CredentialsProvider interface {
+	Retrieve() (*Credentials, error)
+}
+
+type staticCredentials struct {
+	creds *Credentials
+}
+
+func (s staticCredentials) Retrieve() (*Credentials, error) {
+	return s.creds, nil
+}
+
+// refreshingCredentials caches the temporary credentials returned by fetch
+// until shortly before they expire.
+type refreshingCredentials struct {
+	fetch func() (*Credentials, error)
+	now   func() time.Time
+
+	lock  sync.Mutex
+	creds *Credentials
+}
+
+func newRefreshingCredentials(fetch func() (*Credentials, error)) *refreshingCredentials {
+	return &refreshingCredentials{fetch: fetch, now: time.Now}
+}
+
+func (r *refreshingCredentials) Retrieve() (*Credentials, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.creds != nil && (r.creds.Expires.IsZero() || r.now().Add(refreshMargin).Before(r.creds.Expires)) {
+		return r.creds, nil
+	}
+
+	creds, err := r.fetch()
+	if err != nil {
+		return nil, err
+	}
+	r.creds = creds
+
+	return creds, nil
+}
+
+// LoadCredentials resolves the AWS credentials like the AWS CLI does: from
+// the AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN
+// environment variables, or else from the profile in the shared credentials
+// and config files, or else from the role of the EC2 instance. Profiles
+// either hold static credentials or assume the role of role_arn with the
+// credentials of source_profile or credential_source, with the STS endpoint
+// of region, or endpoint if set. An explicit profile skips the environment
+// and the instance role. Profiles using SSO, credential_process or web
+// identities aren't supported.
+func LoadCredentials(profile, region, endpoint string) (CredentialsProvider, error) {
+	explicit := len(profile) > 0
+	if !explicit {
+		if creds := environmentCredentials(); creds != nil {
+			return staticCredentials{creds: creds}, nil
+		}
+
+		profile = os.Getenv("AWS_PROFILE")
+		explicit = len(profile) > 0
+		if !explicit {
+			profile = defaultProfile
+		}
+	}
+
+	files, err := loadSharedFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	region = resolveRegion(region)
+	if len(endpoint) == 0 {
+		endpoint = defaultSTSEndpoint(region)
+	}
+	sts := newSTSClient(region, endpoint)
+
+	provider, err := files.provider(profile, sts, map[string]bool{})
+	if err == nil || explicit || !errors.Is(err, errNoCredentials) {
+		return provider, err
+	}
+
+	instanceRole := newInstanceRoleCredentials()
+	if _, ierr := instanceRole.Retrieve(); ierr != nil {
+		return nil, fmt.Errorf("no AWS credentials in the environment or the shared files (%s), nor from the EC2 instance metadata service (%s)", err, ierr)
+	}
+
+	return instanceRole, nil
+}
+
+func environmentCredentials() *Credentials {
+	creds := &Credentials{
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if len(creds.AccessKeyID) == 0 || len(creds.SecretAccessKey) == 0 {
+		return nil
+	}
+
+	return creds
+}
+
+// sharedFiles are the settings of the profiles in the shared credentials
+// and config files, by profile name.
+type sharedFiles struct {
+	credentialsPath string
+	configPath      string
+	credentials     map[string]map[string]string
+	config          map[string]map[string]string
+}
+
+func loadSharedFiles() (*sharedFiles, error) {
+	f := &sharedFiles{
+		credentialsPath: os.Getenv("AWS_SHARED_CREDENTIALS_FILE"),
+		configPath:      os.Getenv("AWS_CONFIG_FILE"),
+	}
+	if len(f.credentialsPath) == 0 {
+		f.credentialsPath = filepath.Join(utils.GetHomeDir(), ".aws", "credentials")
+	}
+	if len(f.configPath) == 0 {
+		f.configPath = filepath.Join(utils.GetHomeDir(), ".aws", "config")
+	}
+	f.credentialsPath = utils.NormalizePath(f.credentialsPath)
+	f.configPath = utils.NormalizePath(f.configPath)
+
+	var err error
+	if f.credentials, err = loadINI(f.credentialsPath); err != nil {
+		return nil, err
+	}
+	config, err := loadINI(f.configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// Profiles other than the default one are named "profile <name>" in
+	// the config file.
+	f.config = map[string]map[string]string{}
+	for section, settings := range config {
+		name := strings.TrimSpace(strings.TrimPrefix(section, "profile "))
+		if section != defaultProfile && name == section {
+			continue
+		}
+		f.config[name] = settings
+	}
+
+	return f, nil
+}
+
+// profile returns the settings of profile, those of the credentials file
+// overriding those of the config file.
+func (f *sharedFiles) profile(name string) (map[string]string, bool) {
+	config, inConfig := f.config[name]
+	credentials, inCredentials := f.credentials[name]
+
+	settings := map[string]string{}
+	for k, v := range config {
+		settings[k] = v
+	}
+	for k, v := range credentials {
+		settings[k] = v
+	}
+
+	return settings, inConfig || inCredentials
+}
+
+// provider returns the credentials of profile name. visited holds the
+// profiles already resolved along a chain of source profiles.
+func (f *sharedFiles) provider(name string, sts *stsClient, visited map[string]bool) (CredentialsProvider, error) {
+	if visited[name] {
+		return nil, fmt.Errorf("AWS profile %s is in a loop of source profiles", name)
+	}
+	visited[name] = true
+
+	settings, ok := f.profile(name)
+	if !ok {
+		return nil, fmt.Errorf("AWS profile %s not found in %s or %s: %w", name, f.credentialsPath, f.configPath, errNoCredentials)
+	}
+
+	for _, key := range []string{"sso_start_url", "sso_session", "credential_process", "web_identity_token_file", "mfa_serial"} {
+		if len(settings[key]) > 0 {
+			return nil, fmt.Errorf("AWS profile %s uses %s, which isn't supported: use static credentials, a role_arn with a source_profile or credential_source, or the role of the EC2 instance", name, key)
+		}
+	}
+
+	roleARN := settings["role_arn"]
+	if len(roleARN) == 0 {
+		if creds := profileCredentials(settings); creds != nil {
+			return staticCredentials{creds: creds}, nil
+		}
+		return nil, fmt.Errorf("AWS profile %s in %s or %s has no credentials: %w", name, f.credentialsPath, f.configPath, errNoCredentials)
+	}
+
+	var source CredentialsProvider
+	switch sourceProfile, credentialSource := settings["source_profile"], settings["credential_source"]; {
+	case sourceProfile == name:
+		// A profile can be the source of its own role with the static
+		// credentials next to its role_arn.
+		creds := profileCredentials(settings)
+		if creds == nil {
+			return nil, fmt.Errorf("AWS profile %s is its own source profile but has no static credentials", name)
+		}
+		source = staticCredentials{creds: creds}
+	case len(sourceProfile) > 0:
+		var err error
+		source, err = f.provider(sourceProfile, sts, visited)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve the source profile of AWS profile %s: %s", name, err)
+		}
+	case credentialSource == "Environment":
+		creds := environmentCredentials()
+		if creds == nil {
+			return nil, fmt.Errorf("AWS profile %s takes its credentials from the environment, but AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY aren't set", name)
+		}
+		source = staticCredentials{creds: creds}
+	case credentialSource == "Ec2InstanceMetadata":
+		source = newInstanceRoleCredentials()
+	case len(credentialSource) > 0:
+		return nil, fmt.Errorf("AWS profile %s uses credential_source %s, which isn't supported: use Environment or Ec2InstanceMetadata", name, credentialSource)
+	default:
+		return nil, fmt.Errorf("AWS profile %s has a role_arn but neither a source_profile nor a credential_source", name)
+	}
+
+	return newAssumeRoleCredentials(sts, source, roleARN, settings)
+}
+
+func profileCredentials(settings map[string]string) *Credentials {
+	creds := &Credentials{
+		AccessKeyID:     settings["aws_access_key_id"],
+		SecretAccessKey: settings["aws_secret_access_key"],
+		SessionToken:    settings["aws_session_token"],
+	}
+	if len(creds.AccessKeyID) == 0 || len(creds.SecretAccessKey) == 0 {
+		return nil
+	}
+
+	return creds
+}
+
+// loadINI reads the settings of the sections of an INI style file like the
+// shared credentials and config files. A missing file has no sections.
+func loadINI(path string) (map[string]map[string]string, error) {
+	sections := map[string]map[string]string{}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return sections, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var settings map[string]string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section := strings.TrimSpace(line[1 : len(line)-1])
+			if sections[section] == nil {
+				sections[section] = map[string]string{}
+			}
+			settings = sections[section]
+			continue
+		}
+
+		tokens := strings.SplitN(line, "=", 2)
+		if settings == nil || len(tokens) != 2 {
+			continue
+		}
+		settings[strings.TrimSpace(tokens[0])] = strings.TrimSpace(tokens[1])
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %s", path, err)
+	}
+
+	return sections, nil
+}
@@ -0,0 +1,149 @@
+package eks_auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	defaultIMDSEndpoint = "http://169.254.169.254"
+	imdsTokenTTL        = "21600"
+	// imdsTimeout is short, since the service isn't there outside of EC2.
+	imdsTimeout = 2 * time.Second
+
+	imdsCredentialsPath = "/latest/meta-data/iam/security-credentials/"
+)
+
+// instanceRole fetches the credentials of the role of the EC2 instance from
+// the instance metadata service, with IMDSv2 session tokens, or with IMDSv1
+// if the service doesn't hand them out.
+type instanceRole struct {
+	endpoint string
+	client   *http.Client
+}
+
+// newInstanceRoleCredentials returns the credentials of the role of the EC2
+// instance, from the metadata service at AWS_EC2_METADATA_SERVICE_ENDPOINT
+// or else the link-local one, fetched again before they expire.
+func newInstanceRoleCredentials() CredentialsProvider {
+	endpoint := os.Getenv("AWS_EC2_METADATA_SERVICE_ENDPOINT")
+	if len(endpoint) == 0 {
+		endpoint = defaultIMDSEndpoint
+	}
+	r := &instanceRole{
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		client:   &http.Client{Timeout: imdsTimeout},
+	}
+
+	return newRefreshingCredentials(r.fetch)
+}
+
+// instanceRoleResponse is the document of the credentials of the role.
+type instanceRoleResponse struct {
+	Code            string
+	Message         string
+	AccessKeyId     string
+	SecretAccessKey string
+	Token           string
+	Expiration      time.Time
+}
+
+func (r *instanceRole) fetch() (*Credentials, error) {
+	if strings.EqualFold(os.Getenv("AWS_EC2_METADATA_DISABLED"), "true") {
+		return nil, fmt.Errorf("the EC2 instance metadata service is disabled by AWS_EC2_METADATA_DISABLED")
+	}
+
+	token, err := r.token()
+	if err != nil {
+		return nil, err
+	}
+
+	roles, err := r.get(imdsCredentialsPath, token)
+	if err != nil {
+		return nil, err
+	}
+	role := strings.TrimSpace(strings.SplitN(roles, "\n", 2)[0])
+	if len(role) == 0 {
+		return nil, fmt.Errorf("no IAM role attached to the EC2 instance")
+	}
+
+	data, err := r.get(imdsCredentialsPath+role, token)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp instanceRoleResponse
+	if err := json.Unmarshal([]byte(data), &resp); err != nil {
+		return nil, fmt.Errorf("invalid credentials of the instance role %s: %s", role, err)
+	}
+	if resp.Code != "Success" {
+		return nil, fmt.Errorf("failed to get the credentials of the instance role %s: %s: %s", role, resp.Code, resp.Message)
+	}
+
+	return &Credentials{
+		AccessKeyID:     resp.AccessKeyId,
+		SecretAccessKey: resp.SecretAccessKey,
+		SessionToken:    resp.Token,
+		Expires:         resp.Expiration,
+	}, nil
+}
+
+// token returns an IMDSv2 session token, or an empty one if the service
+// only speaks IMDSv1.
+func (r *instanceRole) token() (string, error) {
+	req, err := http.NewRequest(http.MethodPut, r.endpoint+"/latest/api/token", nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", imdsTokenTTL)
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to reach the EC2 instance metadata service: %s", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		data, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return "", fmt.Errorf("failed to read the EC2 instance metadata token: %s", err)
+		}
+		return strings.TrimSpace(string(data)), nil
+	case http.StatusForbidden:
+		return "", fmt.Errorf("the EC2 instance metadata service refused a token: %s", resp.Status)
+	}
+
+	return "", nil
+}
+
+func (r *instanceRole) get(path, token string) (string, error) {
+	req, err := http.NewRequest(http.MethodGet, r.endpoint+path, nil)
+	if err != nil {
+		return "", err
+	}
+	if len(token) > 0 {
+		req.Header.Set("X-aws-ec2-metadata-token", token)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to reach the EC2 instance metadata service: %s", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s from the EC2 instance metadata service: %s", path, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to get %s from the EC2 instance metadata service: %s", path, resp.Status)
+	}
+
+	return string(data), nil
+}
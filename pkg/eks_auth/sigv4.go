@@ -0,0 +1,191 @@
+package eks_auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	sigV4Algorithm = "AWS4-HMAC-SHA256"
+	stsService     = "sts"
+
+	amzDateFormat   = "20060102T150405Z"
+	scopeDateFormat = "20060102"
+
+	// emptyPayloadHash is the hex SHA-256 of an empty body.
+	emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+// signer signs requests to the API of an AWS service with Signature
+// Version 4.
+type signer struct {
+	creds   *Credentials
+	region  string
+	service string
+}
+
+// presign returns u with a signature added to its query, so that a GET of it
+// is authenticated until expires has passed. headers are signed as well and
+// must be sent along with the request.
+func (s signer) presign(u *url.URL, headers map[string]string, now time.Time, expires time.Duration) string {
+	now = now.UTC()
+	signed := canonicalHeaders(u.Host, headers)
+
+	query := u.Query()
+	query.Set("X-Amz-Algorithm", sigV4Algorithm)
+	query.Set("X-Amz-Credential", s.creds.AccessKeyID+"/"+s.scope(now))
+	query.Set("X-Amz-Date", now.Format(amzDateFormat))
+	query.Set("X-Amz-Expires", fmt.Sprintf("%d", int(expires.Seconds())))
+	query.Set("X-Amz-SignedHeaders", strings.Join(sortedNames(signed), ";"))
+	if len(s.creds.SessionToken) > 0 {
+		query.Set("X-Amz-Security-Token", s.creds.SessionToken)
+	}
+	canonicalQuery := canonicalQueryString(query)
+
+	signature := s.signature("GET", u, canonicalQuery, signed, emptyPayloadHash, now)
+
+	presigned := *u
+	presigned.RawQuery = canonicalQuery + "&X-Amz-Signature=" + signature
+	return presigned.String()
+}
+
+// sign adds the X-Amz-Date, X-Amz-Security-Token and Authorization headers
+// to req, signing all its headers and its body, whose hex SHA-256 is
+// payloadHash.
+func (s signer) sign(req *http.Request, payloadHash string, now time.Time) {
+	now = now.UTC()
+	req.Header.Set("X-Amz-Date", now.Format(amzDateFormat))
+	if len(s.creds.SessionToken) > 0 {
+		req.Header.Set("X-Amz-Security-Token", s.creds.SessionToken)
+	}
+
+	headers := map[string]string{}
+	for name, values := range req.Header {
+		if strings.EqualFold(name, "Authorization") {
+			continue
+		}
+		headers[name] = strings.Join(values, ",")
+	}
+	host := req.Host
+	if len(host) == 0 {
+		host = req.URL.Host
+	}
+	signed := canonicalHeaders(host, headers)
+
+	signature := s.signature(req.Method, req.URL, canonicalQueryString(req.URL.Query()), signed, payloadHash, now)
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		sigV4Algorithm, s.creds.AccessKeyID, s.scope(now), strings.Join(sortedNames(signed), ";"), signature))
+}
+
+func (s signer) scope(now time.Time) string {
+	return fmt.Sprintf("%s/%s/%s/aws4_request", now.Format(scopeDateFormat), s.region, s.service)
+}
+
+// signature signs the canonical request of a request to u, with its
+// canonical query and its signed headers by lower case name.
+func (s signer) signature(method string, u *url.URL, canonicalQuery string, headers map[string]string, payloadHash string, now time.Time) string {
+	names := sortedNames(headers)
+	canonical := ""
+	for _, name := range names {
+		canonical += name + ":" + headers[name] + "\n"
+	}
+
+	path := u.EscapedPath()
+	if len(path) == 0 {
+		path = "/"
+	}
+
+	canonicalRequest := strings.Join([]string{
+		method,
+		path,
+		canonicalQuery,
+		canonical,
+		strings.Join(names, ";"),
+		payloadHash,
+	}, "\n")
+
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		sigV4Algorithm,
+		now.Format(amzDateFormat),
+		s.scope(now),
+		hex.EncodeToString(hash[:]),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.creds.SecretAccessKey), now.Format(scopeDateFormat))
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, s.service)
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// payloadHash returns the hex SHA-256 of a request body.
+func payloadHash(body []byte) string {
+	hash := sha256.Sum256(body)
+	return hex.EncodeToString(hash[:])
+}
+
+// canonicalHeaders returns the headers signed with a request to host, by
+// lower case name, with their values trimmed and their inner runs of spaces
+// collapsed.
+func canonicalHeaders(host string, headers map[string]string) map[string]string {
+	signed := map[string]string{"host": host}
+	for name, value := range headers {
+		signed[strings.ToLower(name)] = strings.Join(strings.Fields(value), " ")
+	}
+
+	return signed
+}
+
+func sortedNames(headers map[string]string) []string {
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// canonicalQueryString sorts and encodes the query the way SigV4 expects.
+func canonicalQueryString(query url.Values) string {
+	pairs := []string{}
+	for k, values := range query {
+		for _, v := range values {
+			pairs = append(pairs, uriEncode(k)+"="+uriEncode(v))
+		}
+	}
+	sort.Strings(pairs)
+
+	return strings.Join(pairs, "&")
+}
+
+// uriEncode percent-encodes everything but the unreserved characters of
+// RFC 3986, as SigV4 requires.
+func uriEncode(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+
+	return b.String()
+}
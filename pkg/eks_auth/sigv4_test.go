@@ -0,0 +1,124 @@
+package eks_auth
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The vectors of the AWS Signature Version 4 test suite, which all use these
+// credentials, region, service and time.
+var (
+	testSuiteCredentials = &Credentials{
+		AccessKeyID:     "AKIDEXAMPLE",
+		SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+	}
+	testSuiteTime = time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+)
+
+func TestSignTestSuite(t *testing.T) {
+	tests := []struct {
+		name          string
+		method        string
+		url           string
+		headers       map[string]string
+		body          string
+		authorization string
+	}{
+		{
+			name:          "get-vanilla",
+			method:        "GET",
+			url:           "https://example.amazonaws.com/",
+			authorization: "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		},
+		{
+			name:          "get-vanilla-query-order-key-case",
+			method:        "GET",
+			url:           "https://example.amazonaws.com/?Param2=value2&Param1=value1",
+			authorization: "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=b97d918cfa904a5beff61c982a1b6f458b799221646efd99d3219ec94cdf2500",
+		},
+		{
+			name:          "post-x-www-form-urlencoded",
+			method:        "POST",
+			url:           "https://example.amazonaws.com/",
+			headers:       map[string]string{"Content-Type": "application/x-www-form-urlencoded"},
+			body:          "Param1=value1",
+			authorization: "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=content-type;host;x-amz-date, Signature=ff11897932ad3f4e8b18135d722051e5ac45fc38421b1da7b9d196a0fe09473a",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req, err := http.NewRequest(test.method, test.url, strings.NewReader(test.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for k, v := range test.headers {
+				req.Header.Set(k, v)
+			}
+
+			s := signer{creds: testSuiteCredentials, region: "us-east-1", service: "service"}
+			s.sign(req, payloadHash([]byte(test.body)), testSuiteTime)
+
+			if got := req.Header.Get("Authorization"); got != test.authorization {
+				t.Errorf("Authorization = %q, want %q", got, test.authorization)
+			}
+			if got := req.Header.Get("X-Amz-Date"); got != "20150830T123600Z" {
+				t.Errorf("X-Amz-Date = %q, want 20150830T123600Z", got)
+			}
+		})
+	}
+}
+
+func TestSignSessionToken(t *testing.T) {
+	req, err := http.NewRequest("GET", "https://example.amazonaws.com/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	creds := *testSuiteCredentials
+	creds.SessionToken = "token"
+	s := signer{creds: &creds, region: "us-east-1", service: "service"}
+	s.sign(req, emptyPayloadHash, testSuiteTime)
+
+	if got := req.Header.Get("X-Amz-Security-Token"); got != "token" {
+		t.Errorf("X-Amz-Security-Token = %q, want token", got)
+	}
+	if got := req.Header.Get("Authorization"); !strings.Contains(got, "SignedHeaders=host;x-amz-date;x-amz-security-token,") {
+		t.Errorf("Authorization = %q, the session token isn't signed", got)
+	}
+}
+
+func TestPresign(t *testing.T) {
+	u, _ := url.Parse("https://sts.us-east-1.amazonaws.com/?Action=GetCallerIdentity&Version=2011-06-15")
+	s := signer{creds: testSuiteCredentials, region: "us-east-1", service: stsService}
+	presigned, err := url.Parse(s.presign(u, map[string]string{clusterIDKey: "cluster"}, testSuiteTime, 60*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	query := presigned.Query()
+	for k, want := range map[string]string{
+		"Action":              "GetCallerIdentity",
+		"X-Amz-Algorithm":     "AWS4-HMAC-SHA256",
+		"X-Amz-Credential":    "AKIDEXAMPLE/20150830/us-east-1/sts/aws4_request",
+		"X-Amz-Date":          "20150830T123600Z",
+		"X-Amz-Expires":       "60",
+		"X-Amz-SignedHeaders": "host;x-k8s-aws-id",
+	} {
+		if got := query.Get(k); got != want {
+			t.Errorf("%s = %q, want %q", k, got, want)
+		}
+	}
+
+	// The signature of the presigned URL is the one of a GET with the
+	// same query, except for the signature itself.
+	signature := query.Get("X-Amz-Signature")
+	query.Del("X-Amz-Signature")
+	want := s.signature("GET", presigned, canonicalQueryString(query), canonicalHeaders(u.Host, map[string]string{clusterIDKey: "cluster"}), emptyPayloadHash, testSuiteTime)
+	if signature != want {
+		t.Errorf("X-Amz-Signature = %q, want %q", signature, want)
+	}
+}
@@ -0,0 +1,280 @@
+package eks_auth
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const assumeRoleXML = `<AssumeRoleResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <AssumeRoleResult>
+    <Credentials>
+      <AccessKeyId>ASIAROLE</AccessKeyId>
+      <SecretAccessKey>role-secret</SecretAccessKey>
+      <SessionToken>role-token</SessionToken>
+      <Expiration>%s</Expiration>
+    </Credentials>
+  </AssumeRoleResult>
+</AssumeRoleResponse>`
+
+// stsStub is an STS endpoint that checks the SigV4 signatures of its requests
+// against the secrets it knows, handling AssumeRole and GetCallerIdentity.
+type stsStub struct {
+	secrets map[string]string
+	assumed []string
+}
+
+func (s *stsStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+
+	switch {
+	case r.Method == http.MethodPost:
+		if !s.checkSignature(r, body) {
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `<ErrorResponse><Error><Code>SignatureDoesNotMatch</Code><Message>bad signature</Message></Error></ErrorResponse>`)
+			return
+		}
+		r.Body = ioutil.NopCloser(strings.NewReader(string(body)))
+		if err := r.ParseForm(); err != nil || r.PostForm.Get("Action") != "AssumeRole" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		s.assumed = append(s.assumed, r.PostForm.Get("RoleArn")+" "+r.PostForm.Get("ExternalId"))
+		fmt.Fprintf(w, assumeRoleXML, time.Now().Add(time.Hour).UTC().Format(time.RFC3339))
+	case r.URL.Query().Get("Action") == "GetCallerIdentity":
+		if !s.checkPresigned(r) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		fmt.Fprint(w, `<GetCallerIdentityResponse/>`)
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func (s *stsStub) checkSignature(r *http.Request, body []byte) bool {
+	auth := r.Header.Get("Authorization")
+	prefix := "AWS4-HMAC-SHA256 Credential="
+	if !strings.HasPrefix(auth, prefix) {
+		return false
+	}
+	keyID := strings.SplitN(strings.TrimPrefix(auth, prefix), "/", 2)[0]
+	date, err := time.Parse(amzDateFormat, r.Header.Get("X-Amz-Date"))
+	if err != nil {
+		return false
+	}
+
+	req, _ := http.NewRequest(r.Method, "http://"+r.Host+r.URL.RequestURI(), nil)
+	for k, v := range r.Header {
+		if k != "Authorization" && k != "User-Agent" && k != "Accept-Encoding" && k != "Content-Length" {
+			req.Header[k] = v
+		}
+	}
+	signer{creds: &Credentials{AccessKeyID: keyID, SecretAccessKey: s.secrets[keyID], SessionToken: r.Header.Get("X-Amz-Security-Token")}, region: "us-east-1", service: stsService}.sign(req, payloadHash(body), date)
+
+	return req.Header.Get("Authorization") == auth
+}
+
+func (s *stsStub) checkPresigned(r *http.Request) bool {
+	query := r.URL.Query()
+	keyID := strings.SplitN(query.Get("X-Amz-Credential"), "/", 2)[0]
+	date, err := time.Parse(amzDateFormat, query.Get("X-Amz-Date"))
+	if err != nil || r.Header.Get(clusterIDKey) != "cluster" {
+		return false
+	}
+
+	signature := query.Get("X-Amz-Signature")
+	query.Del("X-Amz-Signature")
+	creds := &Credentials{AccessKeyID: keyID, SecretAccessKey: s.secrets[keyID]}
+	want := signer{creds: creds, region: "us-east-1", service: stsService}.signature("GET", r.URL, canonicalQueryString(query), canonicalHeaders(r.Host, map[string]string{clusterIDKey: "cluster"}), emptyPayloadHash, date)
+
+	return signature == want
+}
+
+// writeFile writes content to name in a temporary directory and returns its
+// path.
+func writeFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+// setenv sets the environment variables of env, unsetting the AWS ones
+// of the test environment, until the end of the test.
+func setenv(t *testing.T, env map[string]string) {
+	for _, k := range []string{"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN", "AWS_PROFILE", "AWS_REGION", "AWS_DEFAULT_REGION", "AWS_SHARED_CREDENTIALS_FILE", "AWS_CONFIG_FILE", "AWS_EC2_METADATA_SERVICE_ENDPOINT", "AWS_EC2_METADATA_DISABLED"} {
+		old, ok := os.LookupEnv(k)
+		os.Unsetenv(k)
+		t.Cleanup(func() {
+			if ok {
+				os.Setenv(k, old)
+			} else {
+				os.Unsetenv(k)
+			}
+		})
+	}
+	for k, v := range env {
+		os.Setenv(k, v)
+	}
+}
+
+func TestTokenVerifiedBySTS(t *testing.T) {
+	stub := &stsStub{secrets: map[string]string{"AKIDSTATIC": "static-secret"}}
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	creds := staticCredentials{creds: &Credentials{AccessKeyID: "AKIDSTATIC", SecretAccessKey: "static-secret"}}
+	generator := NewTokenGenerator("cluster", "us-east-1", server.URL, creds)
+	token, _, err := generator.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	presigned, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(token, tokenPrefix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, _ := http.NewRequest(http.MethodGet, string(presigned), nil)
+	req.Header.Set(clusterIDKey, "cluster")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("GetCallerIdentity returned %s", resp.Status)
+	}
+}
+
+func TestAssumeRoleProfile(t *testing.T) {
+	stub := &stsStub{secrets: map[string]string{"AKIDSOURCE": "source-secret", "ASIAROLE": "role-secret"}}
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	setenv(t, map[string]string{
+		"AWS_SHARED_CREDENTIALS_FILE": writeFile(t, "credentials", "[source]\naws_access_key_id = AKIDSOURCE\naws_secret_access_key = source-secret\n"),
+		"AWS_CONFIG_FILE":             writeFile(t, "config", "[profile deploy]\nrole_arn = arn:aws:iam::123456789012:role/deploy\nsource_profile = source\nexternal_id = ext\n"),
+	})
+
+	provider, err := LoadCredentials("deploy", "us-east-1", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	creds, err := provider.Retrieve()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if creds.AccessKeyID != "ASIAROLE" || creds.SessionToken != "role-token" || creds.Expires.IsZero() {
+		t.Errorf("credentials = %+v, want those of the role", creds)
+	}
+	if len(stub.assumed) != 1 || stub.assumed[0] != "arn:aws:iam::123456789012:role/deploy ext" {
+		t.Errorf("assumed %v, want the deploy role with its external ID", stub.assumed)
+	}
+
+	// The credentials of the role are cached until they expire, and the
+	// tokens signed with them are replaced before then.
+	generator := NewTokenGenerator("cluster", "us-east-1", server.URL, provider)
+	token, expiry, err := generator.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stub.assumed) != 1 {
+		t.Errorf("assumed the role %d times, want once", len(stub.assumed))
+	}
+	if !expiry.Before(creds.Expires) {
+		t.Errorf("token expiry %s isn't before the credentials expire at %s", expiry, creds.Expires)
+	}
+	if !strings.HasPrefix(token, tokenPrefix) {
+		t.Errorf("token %q has no %s prefix", token, tokenPrefix)
+	}
+}
+
+func TestAssumeRoleDenied(t *testing.T) {
+	stub := &stsStub{secrets: map[string]string{"AKIDSOURCE": "other-secret"}}
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	setenv(t, map[string]string{
+		"AWS_SHARED_CREDENTIALS_FILE": writeFile(t, "credentials", "[source]\naws_access_key_id = AKIDSOURCE\naws_secret_access_key = source-secret\n"),
+		"AWS_CONFIG_FILE":             writeFile(t, "config", "[profile deploy]\nrole_arn = arn:aws:iam::123456789012:role/deploy\nsource_profile = source\n"),
+	})
+
+	provider, err := LoadCredentials("deploy", "us-east-1", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := provider.Retrieve(); err == nil || !strings.Contains(err.Error(), "SignatureDoesNotMatch") {
+		t.Errorf("err = %v, want SignatureDoesNotMatch", err)
+	}
+}
+
+func TestInstanceRole(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/latest/api/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut || len(r.Header.Get("X-aws-ec2-metadata-token-ttl-seconds")) == 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		fmt.Fprint(w, "imds-token")
+	})
+	mux.HandleFunc(imdsCredentialsPath, func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-aws-ec2-metadata-token") != "imds-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch strings.TrimPrefix(r.URL.Path, imdsCredentialsPath) {
+		case "":
+			fmt.Fprint(w, "node-role\n")
+		case "node-role":
+			fmt.Fprintf(w, `{"Code": "Success", "AccessKeyId": "ASIANODE", "SecretAccessKey": "node-secret", "Token": "node-token", "Expiration": %q}`, time.Now().Add(time.Hour).UTC().Format(time.RFC3339))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	// Without an explicit profile, an absent default profile falls back to
+	// the instance role.
+	dir := t.TempDir()
+	setenv(t, map[string]string{
+		"AWS_SHARED_CREDENTIALS_FILE":       filepath.Join(dir, "credentials"),
+		"AWS_CONFIG_FILE":                   writeFile(t, "config", "[default]\nregion = us-east-1\n"),
+		"AWS_EC2_METADATA_SERVICE_ENDPOINT": server.URL,
+	})
+
+	provider, err := LoadCredentials("", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	creds, err := provider.Retrieve()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if creds.AccessKeyID != "ASIANODE" || creds.SessionToken != "node-token" {
+		t.Errorf("credentials = %+v, want those of the instance role", creds)
+	}
+}
+
+func TestUnsupportedProfile(t *testing.T) {
+	setenv(t, map[string]string{
+		"AWS_CONFIG_FILE": writeFile(t, "config", "[profile sso]\nsso_start_url = https://example.awsapps.com/start\n[profile process]\ncredential_process = /bin/creds\n"),
+	})
+
+	for _, profile := range []string{"sso", "process"} {
+		_, err := LoadCredentials(profile, "", "")
+		if err == nil || !strings.Contains(err.Error(), "isn't supported") {
+			t.Errorf("profile %s: err = %v, want an unsupported profile error", profile, err)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package eks_auth
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"os"
+	"time"
+)
+
+const (
+	tokenPrefix  = "k8s-aws-v1."
+	clusterIDKey = "x-k8s-aws-id"
+
+	// presignExpiry is how long the presigned URL is valid for. EKS accepts
+	// a token for 15 minutes after it was signed regardless.
+	presignExpiry = 60 * time.Second
+	// tokenLifetime is how long a token is used before a new one is signed,
+	// leaving some margin to the 15 minutes EKS accepts it for.
+	tokenLifetime = 10 * time.Minute
+
+	defaultRegion = "us-east-1"
+)
+
+// TokenGenerator signs EKS bearer tokens the way aws-iam-authenticator and
+// `aws eks get-token` do: a presigned STS GetCallerIdentity URL bound to
+// the cluster name.
+type TokenGenerator struct {
+	ClusterName string
+	Region      string
+	// Endpoint is the STS endpoint the tokens are presigned for, e.g. a
+	// local stub. It defaults to the regional endpoint of Region.
+	Endpoint    string
+	Credentials CredentialsProvider
+
+	now func() time.Time
+}
+
+// NewTokenGenerator builds a TokenGenerator for clusterName. An empty region
+// is read from AWS_REGION or AWS_DEFAULT_REGION, falling back to us-east-1.
+func NewTokenGenerator(clusterName, region, endpoint string, creds CredentialsProvider) *TokenGenerator {
+	region = resolveRegion(region)
+	if len(endpoint) == 0 {
+		endpoint = defaultSTSEndpoint(region)
+	}
+
+	return &TokenGenerator{
+		ClusterName: clusterName,
+		Region:      region,
+		Endpoint:    endpoint,
+		Credentials: creds,
+		now:         time.Now,
+	}
+}
+
+// resolveRegion returns region, or else the one of AWS_REGION or
+// AWS_DEFAULT_REGION, falling back to us-east-1.
+func resolveRegion(region string) string {
+	if len(region) == 0 {
+		region = os.Getenv("AWS_REGION")
+	}
+	if len(region) == 0 {
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if len(region) == 0 {
+		region = defaultRegion
+	}
+
+	return region
+}
+
+func defaultSTSEndpoint(region string) string {
+	return fmt.Sprintf("https://sts.%s.amazonaws.com", region)
+}
+
+// Token returns a new bearer token together with the time it should be
+// replaced, before the credentials it is signed with expire.
+func (g *TokenGenerator) Token() (string, time.Time, error) {
+	creds, err := g.Credentials.Retrieve()
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to get AWS credentials: %s", err)
+	}
+
+	u, err := url.Parse(g.Endpoint)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("invalid STS endpoint %q: %s", g.Endpoint, err)
+	}
+	if len(u.Host) == 0 {
+		return "", time.Time{}, fmt.Errorf("invalid STS endpoint %q: no host", g.Endpoint)
+	}
+
+	query := url.Values{}
+	query.Set("Action", "GetCallerIdentity")
+	query.Set("Version", "2011-06-15")
+	u.RawQuery = query.Encode()
+	if len(u.Path) == 0 {
+		u.Path = "/"
+	}
+
+	now := g.now()
+	s := signer{creds: creds, region: g.Region, service: stsService}
+	presigned := s.presign(u, map[string]string{clusterIDKey: g.ClusterName}, now, presignExpiry)
+	token := tokenPrefix + base64.RawURLEncoding.EncodeToString([]byte(presigned))
+
+	expiry := now.Add(tokenLifetime)
+	if !creds.Expires.IsZero() && creds.Expires.Add(-time.Minute).Before(expiry) {
+		expiry = creds.Expires.Add(-time.Minute)
+	}
+
+	return token, expiry, nil
+}
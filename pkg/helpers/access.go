@@ -0,0 +1,368 @@
+package helpers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/klog/v2"
+
+	"github.com/mwlng/k8s_resources_sync/pkg/k8s_resources"
+)
+
+// Permission is an access to the API a run needs. An empty Namespace stands
+// for a cluster-scoped resource.
+type Permission struct {
+	Verb        string
+	Group       string
+	Resource    string
+	Subresource string
+	Namespace   string
+}
+
+func (p Permission) resource() string {
+	resource := p.Resource
+	if len(p.Group) > 0 {
+		resource += "." + p.Group
+	}
+	if len(p.Subresource) > 0 {
+		resource += "/" + p.Subresource
+	}
+
+	return resource
+}
+
+// Permissions is a set of permissions.
+type Permissions map[Permission]bool
+
+func (ps Permissions) add(namespace string, gvr schema.GroupVersionResource, verbs ...string) {
+	for _, verb := range verbs {
+		ps[Permission{Verb: verb, Group: gvr.Group, Resource: gvr.Resource, Namespace: namespace}] = true
+	}
+}
+
+// Sorted returns the permissions ordered by resource, namespace and verb.
+func (ps Permissions) Sorted() []Permission {
+	sorted := make([]Permission, 0, len(ps))
+	for p := range ps {
+		sorted = append(sorted, p)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if a.resource() != b.resource() {
+			return a.resource() < b.resource()
+		}
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		return a.Verb < b.Verb
+	})
+
+	return sorted
+}
+
+// AccessOptions are the settings of a run that decide which permissions it
+// needs besides reading and writing its objects.
+type AccessOptions struct {
+	NamespaceMap  map[string]string
+	Jobs          JobOptions
+	LockNamespace string
+	// PullSecrets is set when the images of the workloads are verified
+	// with the image pull secrets of the target cluster.
+	PullSecrets bool
+	// PinDigests is set when the images of the workloads are pinned to the
+	// digests run by their pods in the source cluster.
+	PinDigests bool
+	// DataCopy is set when the data of the created persistent volume claims
+	// is copied from their source claims by a DataCopyHook.
+	DataCopy bool
+	// CustomResources are the kinds synced as custom resources, whose CRDs
+	// are listed in the source cluster.
+	CustomResources CustomResourceKinds
+}
+
+// namespaceMappedKinds are the kinds moved to their target namespace
+// according to the namespace map, next to the custom resources. The other
+// kinds keep the namespace of their manifest.
+var namespaceMappedKinds = map[schema.GroupKind]bool{
+	{Group: "rbac.authorization.k8s.io", Kind: "Role"}:        true,
+	{Group: "rbac.authorization.k8s.io", Kind: "RoleBinding"}: true,
+	{Group: "networking.k8s.io", Kind: "NetworkPolicy"}:       true,
+	{Kind: "PersistentVolumeClaim"}:                           true,
+}
+
+// defaultNamespaceKinds are the kinds synced in the default namespace only,
+// whatever the namespace of their manifest.
+var defaultNamespaceKinds = map[schema.GroupKind]bool{
+	{Group: "apps", Kind: "Deployment"}:  true,
+	{Group: "apps", Kind: "StatefulSet"}: true,
+	{Group: "batch", Kind: "CronJob"}:    true,
+	{Group: "batch", Kind: "Job"}:        true,
+	{Kind: "Service"}:                    true,
+	{Kind: "ServiceAccount"}:             true,
+}
+
+// RequiredPermissions works out the permissions a run syncing the manifests
+// under rootDir matched by match and filter needs: get, and list for kinds
+// indexed in one List per namespace, in the source cluster, and get, create,
+// update or patch, and delete for recreated jobs, in the target cluster,
+// together with the permissions on the run lock, on the pods of jobs whose
+// logs are streamed, on the pods and namespaces selected by network
+// policies, on the pods whose images are pinned, on the claims and pods the
+// data copy reads, on the image pull secrets and on the CRDs of the source
+// cluster.
+func RequiredPermissions(source, target *rest.Config, rootDir string, match func(gvk schema.GroupVersionKind) bool, filter *Filter, opts AccessOptions) (Permissions, Permissions, error) {
+	sourceMapper, err := restMapperFor(source)
+	if err != nil {
+		return nil, nil, err
+	}
+	targetMapper, err := restMapperFor(target)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	manifests, err := loadManifests(rootDir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Custom resources of CRDs that aren't applied yet are mapped from the
+	// CRD manifests.
+	pending := map[schema.GroupKind]*meta.RESTMapping{}
+	for _, m := range manifests {
+		if m.gvk.GroupKind() != crdGroupKind {
+			continue
+		}
+
+		group, _, _ := unstructured.NestedString(m.obj, "spec", "group")
+		kind, _, _ := unstructured.NestedString(m.obj, "spec", "names", "kind")
+		plural, _, _ := unstructured.NestedString(m.obj, "spec", "names", "plural")
+		scope, _, _ := unstructured.NestedString(m.obj, "spec", "scope")
+		mapping := &meta.RESTMapping{Resource: schema.GroupVersionResource{Group: group, Resource: plural}, Scope: meta.RESTScopeRoot}
+		if scope == "Namespaced" {
+			mapping.Scope = meta.RESTScopeNamespace
+		}
+		pending[schema.GroupKind{Group: group, Kind: kind}] = mapping
+	}
+
+	// The sync steps index the objects of a kind in one List per namespace
+	// when there are enough manifests of it there, whether filtered out or
+	// not.
+	type kindNamespace struct {
+		gk        schema.GroupKind
+		namespace string
+	}
+	counts := map[kindNamespace]int{}
+	for _, m := range manifests {
+		if match(m.gvk) {
+			counts[kindNamespace{m.gvk.GroupKind(), sourceNamespace(m)}]++
+		}
+	}
+
+	src, dst := Permissions{}, Permissions{}
+	pods := corev1.SchemeGroupVersion.WithResource("pods")
+	for _, m := range manifests {
+		if !match(m.gvk) || !filter.Matches(&unstructured.Unstructured{Object: m.obj}) {
+			continue
+		}
+
+		gk := m.gvk.GroupKind()
+		namespace := sourceNamespace(m)
+		targetNamespace := namespace
+		if namespaceMappedKinds[gk] || opts.CustomResources.Has(m.gvk) {
+			targetNamespace = mapNamespace(opts.NamespaceMap, namespace)
+		}
+
+		mapping, err := sourceMapper.RESTMapping(gk, m.gvk.Version)
+		if err != nil {
+			klog.Warningf("Failed to map %s in the source cluster, not checking its permissions. Err was: %s", m.gvk, err)
+		} else {
+			ns := namespace
+			if mapping.Scope.Name() != meta.RESTScopeNameNamespace {
+				ns = ""
+			}
+			src.add(ns, mapping.Resource, "get")
+			if counts[kindNamespace{gk, namespace}] >= listThreshold {
+				src.add(ns, mapping.Resource, "list")
+			}
+		}
+
+		switch gk {
+		case schema.GroupKind{Group: "networking.k8s.io", Kind: "NetworkPolicy"}:
+			networkPolicySelectorPermissions(dst, m, targetNamespace)
+		case schema.GroupKind{Kind: "PersistentVolumeClaim"}:
+			if opts.DataCopy {
+				src.add(namespace, pods, "get", "list")
+			}
+		}
+
+		mapping, err = targetMapper.RESTMapping(gk, m.gvk.Version)
+		if err != nil && pending[gk] != nil {
+			mapping, err = pending[gk], nil
+		}
+		if err != nil {
+			klog.Warningf("Failed to map %s in the target cluster, not checking its permissions. Err was: %s", m.gvk, err)
+			continue
+		}
+
+		ns := targetNamespace
+		if mapping.Scope.Name() != meta.RESTScopeNameNamespace {
+			ns = ""
+		}
+		switch {
+		case gk == crdGroupKind || opts.CustomResources.Has(m.gvk):
+			// Server-side applied.
+			dst.add(ns, mapping.Resource, "get", "patch")
+		case gk == schema.GroupKind{Group: "batch", Kind: "Job"}:
+			dst.add(ns, mapping.Resource, "get", "create")
+			if opts.Jobs.Mode == JobModeRecreate {
+				dst.add(ns, mapping.Resource, "delete")
+			}
+			if opts.Jobs.Logs {
+				dst.add(ns, pods, "list")
+				dst[Permission{Verb: "get", Resource: "pods", Subresource: "log", Namespace: ns}] = true
+			}
+		default:
+			dst.add(ns, mapping.Resource, "get", "create", "update")
+		}
+	}
+
+	if opts.PullSecrets {
+		dst.add(corev1.NamespaceDefault, corev1.SchemeGroupVersion.WithResource("serviceaccounts"), "get")
+		dst.add(corev1.NamespaceDefault, corev1.SchemeGroupVersion.WithResource("secrets"), "get")
+	}
+
+	if opts.PinDigests {
+		src.add(corev1.NamespaceDefault, pods, "list")
+		src.add(corev1.NamespaceDefault, corev1.SchemeGroupVersion.WithResource("serviceaccounts"), "get")
+		src.add(corev1.NamespaceDefault, corev1.SchemeGroupVersion.WithResource("secrets"), "get")
+	}
+
+	if opts.CustomResources != nil {
+		src.add("", crdGroupKind.WithVersion("v1").GroupVersion().WithResource("customresourcedefinitions"), "list")
+	}
+
+	if len(opts.LockNamespace) > 0 {
+		dst.add(opts.LockNamespace, coordinationv1.SchemeGroupVersion.WithResource("leases"), "get", "create", "update", "delete")
+	}
+
+	return src, dst, nil
+}
+
+// sourceNamespace returns the namespace of the object of manifest m in the
+// source cluster.
+func sourceNamespace(m manifest) string {
+	if defaultNamespaceKinds[m.gvk.GroupKind()] {
+		return corev1.NamespaceDefault
+	}
+
+	namespace, _, _ := unstructured.NestedString(m.obj, "metadata", "namespace")
+	return namespaceOf(namespace)
+}
+
+// networkPolicySelectorPermissions adds the permissions the check of the
+// selectors of the network policy of manifest m, synced to namespace, needs
+// in the target cluster: listing the pods of namespace, and listing the
+// namespaces and the pods of every namespace for peers with a namespace
+// selector.
+func networkPolicySelectorPermissions(dst Permissions, m manifest, namespace string) {
+	pods := corev1.SchemeGroupVersion.WithResource("pods")
+	dst.add(namespace, pods, "list")
+
+	policy := &networkingv1.NetworkPolicy{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(m.obj, policy); err != nil {
+		klog.Warningf("Failed to decode network policy %s, not checking the permissions of its selectors. Err was: %s", m.file, err)
+		return
+	}
+
+	peers := []networkingv1.NetworkPolicyPeer{}
+	for _, rule := range policy.Spec.Ingress {
+		peers = append(peers, rule.From...)
+	}
+	for _, rule := range policy.Spec.Egress {
+		peers = append(peers, rule.To...)
+	}
+	for _, peer := range peers {
+		if peer.NamespaceSelector == nil {
+			continue
+		}
+		dst.add("", corev1.SchemeGroupVersion.WithResource("namespaces"), "list")
+		if peer.PodSelector != nil {
+			dst.add("", pods, "list")
+		}
+	}
+}
+
+func restMapperFor(kubeConfig *rest.Config) (meta.RESTMapper, error) {
+	cluster, err := k8s_resources.ClusterFor(kubeConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return restmapper.NewDeferredDiscoveryRESTMapper(cluster.Discovery), nil
+}
+
+// CheckAccess asks the cluster of kubeConfig with a SelfSubjectAccessReview
+// per permission whether the current user has it, and returns the ones it
+// doesn't, together with the reason given by the authorizer.
+func CheckAccess(ctx context.Context, kubeConfig *rest.Config, permissions Permissions) ([]Permission, map[Permission]string, error) {
+	cluster, err := k8s_resources.ClusterFor(kubeConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+	reviews := cluster.Clientset.AuthorizationV1().SelfSubjectAccessReviews()
+
+	missing := []Permission{}
+	reasons := map[Permission]string{}
+	for _, p := range permissions.Sorted() {
+		review, err := reviews.Create(ctx, &authorizationv1.SelfSubjectAccessReview{
+			Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+				ResourceAttributes: &authorizationv1.ResourceAttributes{
+					Namespace:   p.Namespace,
+					Verb:        p.Verb,
+					Group:       p.Group,
+					Resource:    p.Resource,
+					Subresource: p.Subresource,
+				},
+			},
+		}, metav1.CreateOptions{})
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to review access to %s %s: %s", p.Verb, p.resource(), err)
+		}
+
+		if !review.Status.Allowed {
+			missing = append(missing, p)
+			reasons[p] = review.Status.Reason
+		}
+	}
+
+	return missing, reasons, nil
+}
+
+// PrintMissingPermissions writes a table of the permissions missing in
+// cluster.
+func PrintMissingPermissions(w io.Writer, cluster string, missing []Permission, reasons map[Permission]string) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "CLUSTER\tVERB\tRESOURCE\tNAMESPACE\tREASON")
+	for _, p := range missing {
+		namespace := p.Namespace
+		if len(namespace) == 0 {
+			namespace = "(cluster)"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", cluster, p.Verb, p.resource(), namespace, reasons[p])
+	}
+	tw.Flush()
+}
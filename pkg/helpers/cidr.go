@@ -0,0 +1,96 @@
+package helpers
+
+import (
+	"fmt"
+	"net"
+	"sort"
+)
+
+type cidrMapping struct {
+	from *net.IPNet
+	to   *net.IPNet
+}
+
+// CIDRTranslator rewrites CIDRs of the source cluster's VPC into the
+// equivalent CIDRs of the target cluster's VPC.
+type CIDRTranslator struct {
+	mappings []cidrMapping
+}
+
+// NewCIDRTranslator builds a translator from source=target CIDR pairs.
+// Both sides of a pair must be of the same IP family and prefix length,
+// so that any CIDR inside the source range keeps its host bits when it is
+// moved into the target range.
+func NewCIDRTranslator(cidrMap map[string]string) (*CIDRTranslator, error) {
+	mappings := []cidrMapping{}
+	for from, to := range cidrMap {
+		_, fromNet, err := net.ParseCIDR(from)
+		if err != nil {
+			return nil, err
+		}
+
+		_, toNet, err := net.ParseCIDR(to)
+		if err != nil {
+			return nil, err
+		}
+
+		fromOnes, fromBits := fromNet.Mask.Size()
+		toOnes, toBits := toNet.Mask.Size()
+		if fromOnes != toOnes || fromBits != toBits {
+			return nil, fmt.Errorf("CIDR mapping %s=%s must map between ranges of the same size", from, to)
+		}
+
+		mappings = append(mappings, cidrMapping{from: fromNet, to: toNet})
+	}
+
+	// Most specific source ranges are tried first.
+	sort.Slice(mappings, func(i, j int) bool {
+		iOnes, _ := mappings[i].from.Mask.Size()
+		jOnes, _ := mappings[j].from.Mask.Size()
+		if iOnes != jOnes {
+			return iOnes > jOnes
+		}
+		return mappings[i].from.String() < mappings[j].from.String()
+	})
+
+	return &CIDRTranslator{mappings: mappings}, nil
+}
+
+// Translate returns the target CIDR for cidr and whether it was rewritten.
+// CIDRs outside of every mapped source range are returned unchanged.
+func (t *CIDRTranslator) Translate(cidr string) (string, bool, error) {
+	if t == nil {
+		return cidr, false, nil
+	}
+
+	ip, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return cidr, false, err
+	}
+	ones, bits := ipNet.Mask.Size()
+
+	for _, m := range t.mappings {
+		fromOnes, fromBits := m.from.Mask.Size()
+		if fromBits != bits || ones < fromOnes || !m.from.Contains(ip) {
+			continue
+		}
+
+		to := normalizeIP(m.to.IP, bits)
+		addr := normalizeIP(ipNet.IP, bits)
+		translated := make(net.IP, len(addr))
+		for i := range addr {
+			translated[i] = to[i] | (addr[i] &^ m.from.Mask[i])
+		}
+
+		return fmt.Sprintf("%s/%d", translated.String(), ones), true, nil
+	}
+
+	return cidr, false, nil
+}
+
+func normalizeIP(ip net.IP, bits int) net.IP {
+	if bits == 8*net.IPv4len {
+		return ip.To4()
+	}
+	return ip.To16()
+}
@@ -1,6 +1,7 @@
 package helpers
 
 import (
+	"context"
 	"fmt"
 	"io/fs"
 	"io/ioutil"
@@ -16,6 +17,7 @@ import (
 	"k8s.io/klog/v2"
 
 	"github.com/mwlng/k8s_resources_sync/pkg/k8s_resources"
+	"github.com/mwlng/k8s_resources_sync/pkg/utils"
 )
 
 func LoadClusterRoleYamlFiles(rootDir string) []*rbacv1.ClusterRole {
@@ -58,29 +60,56 @@ func LoadClusterRoleYamlFiles(rootDir string) []*rbacv1.ClusterRole {
 	return roles
 }
 
-func SyncClusterRoles(kubeConfig *rest.Config, clusterRoles []*rbacv1.ClusterRole) []*rbacv1.ClusterRole {
+func SyncClusterRoles(ctx context.Context, kubeConfig *rest.Config, clusterRoles []*rbacv1.ClusterRole, filter *Filter) ([]*rbacv1.ClusterRole, Results, error) {
 	klog.Infof("Syncing cluster roles from cluster: %s\n", kubeConfig.Host)
 	clusterRole, err := k8s_resources.NewClusterRole(kubeConfig)
 	if err != nil {
-		panic(err)
+		return nil, nil, err
 	}
 
+	getClusterRole := clusterRole.GetClusterRole
+	if len(clusterRoles) >= listThreshold {
+		index, err := clusterRole.IndexClusterRoles(ctx)
+		if err != nil {
+			klog.Warningf("Failed to list cluster roles, falling back to one get per object. Err was: %s", err)
+		} else {
+			getClusterRole = index.GetClusterRole
+		}
+	}
+
+	results := Results{}
 	synced_clusterRoles := []*rbacv1.ClusterRole{}
 	for _, role := range clusterRoles {
-		src_clusterRole, err := clusterRole.GetClusterRole(role.Name)
+		if utils.Interrupted(ctx) {
+			results = append(results, skippedResult("ClusterRole", "", role.Name, reasonInterrupted))
+			continue
+		}
+
+		if !filter.Matches(role) {
+			results = append(results, filteredResult("ClusterRole", "", role.Name))
+			continue
+		}
+
+		src_clusterRole, err := getClusterRole(ctx, role.Name)
 		if err != nil {
 			klog.Errorf("Failed to get service: %s. Err was: %s", role.Name, err)
+			results = append(results, sourceErrorResult("ClusterRole", "", role.Name, err))
 			continue
 		}
 
 		if src_clusterRole != nil {
+			if !filter.Matches(src_clusterRole) {
+				results = append(results, filteredResult("ClusterRole", "", role.Name))
+				continue
+			}
+
 			role.Rules = src_clusterRole.Rules
 
 			synced_clusterRoles = append(synced_clusterRoles, role)
 		}
 	}
 
-	return synced_clusterRoles
+	return synced_clusterRoles, results, nil
 }
 
 func PrintClusterRoles(clusterRoles []*rbacv1.ClusterRole) {
@@ -90,19 +119,28 @@ func PrintClusterRoles(clusterRoles []*rbacv1.ClusterRole) {
 	}
 }
 
-func ApplyClusterRoles(kubeConfig *rest.Config, clusterRoles []*rbacv1.ClusterRole) {
+func ApplyClusterRoles(ctx context.Context, kubeConfig *rest.Config, clusterRoles []*rbacv1.ClusterRole) (Results, error) {
 	clusterRole, err := k8s_resources.NewClusterRole(kubeConfig)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
-	for _, role := range clusterRoles {
+	results := applyEach(ctx, len(clusterRoles), func(i int) Result {
+		role := clusterRoles[i]
+		if utils.Interrupted(ctx) {
+			return skippedResult("ClusterRole", "", role.Name, reasonInterrupted)
+		}
+
 		klog.Infof("Applying cluster role: %s ...", role.Name)
-		err := clusterRole.ApplyClusterRole(role)
+		op, err := clusterRole.ApplyClusterRole(ctx, role)
 		if err != nil {
 			klog.Errorf("Failed to apply cluster role. Err was: %s", err)
-			continue
+			return operationResult("ClusterRole", "", role.Name, op, err)
 		}
 		klog.Infoln("Done.")
-	}
+
+		return operationResult("ClusterRole", "", role.Name, op, nil)
+	})
+
+	return results, nil
 }
@@ -1,6 +1,7 @@
 package helpers
 
 import (
+	"context"
 	"fmt"
 	"io/fs"
 	"io/ioutil"
@@ -16,6 +17,7 @@ import (
 	"k8s.io/klog/v2"
 
 	"github.com/mwlng/k8s_resources_sync/pkg/k8s_resources"
+	"github.com/mwlng/k8s_resources_sync/pkg/utils"
 )
 
 func LoadClusterRoleBindingYamlFiles(rootDir string) []*rbacv1.ClusterRoleBinding {
@@ -58,29 +60,56 @@ func LoadClusterRoleBindingYamlFiles(rootDir string) []*rbacv1.ClusterRoleBindin
 	return roles
 }
 
-func SyncClusterRoleBindings(kubeConfig *rest.Config, clusterRoleBindings []*rbacv1.ClusterRoleBinding) []*rbacv1.ClusterRoleBinding {
+func SyncClusterRoleBindings(ctx context.Context, kubeConfig *rest.Config, clusterRoleBindings []*rbacv1.ClusterRoleBinding, filter *Filter) ([]*rbacv1.ClusterRoleBinding, Results, error) {
 	klog.Infof("Syncing cluster role bindings from cluster: %s\n", kubeConfig.Host)
 	clusterRoleBinding, err := k8s_resources.NewClusterRoleBinding(kubeConfig)
 	if err != nil {
-		panic(err)
+		return nil, nil, err
 	}
 
+	getClusterRoleBinding := clusterRoleBinding.GetClusterRoleBinding
+	if len(clusterRoleBindings) >= listThreshold {
+		index, err := clusterRoleBinding.IndexClusterRoleBindings(ctx)
+		if err != nil {
+			klog.Warningf("Failed to list cluster role bindings, falling back to one get per object. Err was: %s", err)
+		} else {
+			getClusterRoleBinding = index.GetClusterRoleBinding
+		}
+	}
+
+	results := Results{}
 	synced_clusterRoleBindings := []*rbacv1.ClusterRoleBinding{}
 	for _, roleBinding := range clusterRoleBindings {
-		src_clusterRoleBinding, err := clusterRoleBinding.GetClusterRoleBinding(roleBinding.Name)
+		if utils.Interrupted(ctx) {
+			results = append(results, skippedResult("ClusterRoleBinding", "", roleBinding.Name, reasonInterrupted))
+			continue
+		}
+
+		if !filter.Matches(roleBinding) {
+			results = append(results, filteredResult("ClusterRoleBinding", "", roleBinding.Name))
+			continue
+		}
+
+		src_clusterRoleBinding, err := getClusterRoleBinding(ctx, roleBinding.Name)
 		if err != nil {
 			klog.Errorf("Failed to get service: %s. Err was: %s", roleBinding.Name, err)
+			results = append(results, sourceErrorResult("ClusterRoleBinding", "", roleBinding.Name, err))
 			continue
 		}
 
 		if src_clusterRoleBinding != nil {
+			if !filter.Matches(src_clusterRoleBinding) {
+				results = append(results, filteredResult("ClusterRoleBinding", "", roleBinding.Name))
+				continue
+			}
+
 			roleBinding.Subjects = src_clusterRoleBinding.Subjects
 			roleBinding.RoleRef = src_clusterRoleBinding.RoleRef
 			synced_clusterRoleBindings = append(synced_clusterRoleBindings, roleBinding)
 		}
 	}
 
-	return synced_clusterRoleBindings
+	return synced_clusterRoleBindings, results, nil
 }
 
 func PrintClusterRoleBindings(clusterRoleBindings []*rbacv1.ClusterRoleBinding) {
@@ -90,19 +119,28 @@ func PrintClusterRoleBindings(clusterRoleBindings []*rbacv1.ClusterRoleBinding)
 	}
 }
 
-func ApplyClusterRoleBindings(kubeConfig *rest.Config, clusterRoleBindings []*rbacv1.ClusterRoleBinding) {
+func ApplyClusterRoleBindings(ctx context.Context, kubeConfig *rest.Config, clusterRoleBindings []*rbacv1.ClusterRoleBinding) (Results, error) {
 	clusterRoleBinding, err := k8s_resources.NewClusterRoleBinding(kubeConfig)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
-	for _, roleBinding := range clusterRoleBindings {
+	results := applyEach(ctx, len(clusterRoleBindings), func(i int) Result {
+		roleBinding := clusterRoleBindings[i]
+		if utils.Interrupted(ctx) {
+			return skippedResult("ClusterRoleBinding", "", roleBinding.Name, reasonInterrupted)
+		}
+
 		klog.Infof("Applying cluster role binding: %s ...", roleBinding.Name)
-		err := clusterRoleBinding.ApplyClusterRoleBinding(roleBinding)
+		op, err := clusterRoleBinding.ApplyClusterRoleBinding(ctx, roleBinding)
 		if err != nil {
 			klog.Errorf("Failed to apply cluster role binding. Err was: %s", err)
-			continue
+			return operationResult("ClusterRoleBinding", "", roleBinding.Name, op, err)
 		}
 		klog.Infoln("Done.")
-	}
+
+		return operationResult("ClusterRoleBinding", "", roleBinding.Name, op, nil)
+	})
+
+	return results, nil
 }
@@ -1,6 +1,7 @@
 package helpers
 
 import (
+	"context"
 	"fmt"
 	"io/fs"
 	"io/ioutil"
@@ -17,6 +18,7 @@ import (
 	"k8s.io/klog/v2"
 
 	"github.com/mwlng/k8s_resources_sync/pkg/k8s_resources"
+	"github.com/mwlng/k8s_resources_sync/pkg/utils"
 )
 
 func LoadCronJobYamlFiles(rootDir string) []*batchv1.CronJob {
@@ -61,22 +63,49 @@ func LoadCronJobYamlFiles(rootDir string) []*batchv1.CronJob {
 	return cronJobs
 }
 
-func SyncCronJobs(kubeConfig *rest.Config, cronJobs []*batchv1.CronJob) []*batchv1.CronJob {
+func SyncCronJobs(ctx context.Context, kubeConfig *rest.Config, cronJobs []*batchv1.CronJob, images *ImageRewriter, filter *Filter) ([]*batchv1.CronJob, Results, error) {
 	klog.Infof("Syncing cron jobs from cluster: %s, namespace: %s\n", kubeConfig.Host, corev1.NamespaceDefault)
 	cronJob, err := k8s_resources.NewCronJob(kubeConfig, corev1.NamespaceDefault)
 	if err != nil {
-		panic(err)
+		return nil, nil, err
 	}
 
+	getCronJob := cronJob.GetCronJob
+	if len(cronJobs) >= listThreshold {
+		index, err := cronJob.IndexCronJobs(ctx)
+		if err != nil {
+			klog.Warningf("Failed to list cron jobs, falling back to one get per object. Err was: %s", err)
+		} else {
+			getCronJob = index.GetCronJob
+		}
+	}
+
+	results := Results{}
 	synced_cronJobs := []*batchv1.CronJob{}
 	for _, job := range cronJobs {
-		src_cronJob, err := cronJob.GetCronJob(job.Name)
+		if utils.Interrupted(ctx) {
+			results = append(results, skippedResult("CronJob", corev1.NamespaceDefault, job.Name, reasonInterrupted))
+			continue
+		}
+
+		if !filter.Matches(job) {
+			results = append(results, filteredResult("CronJob", corev1.NamespaceDefault, job.Name))
+			continue
+		}
+
+		src_cronJob, err := getCronJob(ctx, job.Name)
 		if err != nil {
 			klog.Errorf("Failed to get cron job: %s. Err was: %s", job.Name, err)
+			results = append(results, sourceErrorResult("CronJob", corev1.NamespaceDefault, job.Name, err))
 			continue
 		}
 
 		if src_cronJob != nil {
+			if !filter.Matches(src_cronJob) {
+				results = append(results, filteredResult("CronJob", corev1.NamespaceDefault, job.Name))
+				continue
+			}
+
 			containerImageMap := map[string]string{}
 			for _, c := range src_cronJob.Spec.JobTemplate.Spec.Template.Spec.Containers {
 				containerImageMap[c.Name] = c.Image
@@ -86,13 +115,22 @@ func SyncCronJobs(kubeConfig *rest.Config, cronJobs []*batchv1.CronJob) []*batch
 				job.Spec.JobTemplate.Spec.Template.Spec.Containers[i].Image = containerImageMap[c.Name]
 			}
 
+			// The pods of a cron job come and go with its jobs, so its images
+			// are resolved in the registry.
+			err = images.Rewrite(ctx, "CronJob", corev1.NamespaceDefault, &job.ObjectMeta, &job.Spec.JobTemplate.Spec.Template.Spec, nil)
+			if err != nil {
+				klog.Errorf("Failed to rewrite the images of cron job: %s. Err was: %s", job.Name, err)
+				results = append(results, failedResult("CronJob", corev1.NamespaceDefault, job.Name, err))
+				continue
+			}
+
 			job.Spec.Schedule = src_cronJob.Spec.Schedule
 
 			synced_cronJobs = append(synced_cronJobs, job)
 		}
 	}
 
-	return synced_cronJobs
+	return synced_cronJobs, results, nil
 }
 
 func PrintCronJobs(cronJobs []*batchv1.CronJob) {
@@ -102,19 +140,28 @@ func PrintCronJobs(cronJobs []*batchv1.CronJob) {
 	}
 }
 
-func ApplyCronJobs(kubeConfig *rest.Config, cronJobs []*batchv1.CronJob) {
+func ApplyCronJobs(ctx context.Context, kubeConfig *rest.Config, cronJobs []*batchv1.CronJob) (Results, error) {
 	cronJob, err := k8s_resources.NewCronJob(kubeConfig, corev1.NamespaceDefault)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
-	for _, job := range cronJobs {
+	results := applyEach(ctx, len(cronJobs), func(i int) Result {
+		job := cronJobs[i]
+		if utils.Interrupted(ctx) {
+			return skippedResult("CronJob", corev1.NamespaceDefault, job.Name, reasonInterrupted)
+		}
+
 		klog.Infof("Applying cron job: %s ...", job.Name)
-		err := cronJob.ApplyCronJob(job)
+		op, err := cronJob.ApplyCronJob(ctx, job)
 		if err != nil {
 			klog.Errorf("Failed to apply cron job. Err was: %s", err)
-			continue
+			return operationResult("CronJob", corev1.NamespaceDefault, job.Name, op, err)
 		}
 		klog.Infoln("Done.")
-	}
+
+		return operationResult("CronJob", corev1.NamespaceDefault, job.Name, op, nil)
+	})
+
+	return results, nil
 }
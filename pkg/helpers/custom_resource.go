@@ -0,0 +1,430 @@
+package helpers
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"k8s.io/client-go/rest"
+	"k8s.io/klog/v2"
+
+	"github.com/mwlng/k8s_resources_sync/pkg/dyna_client"
+	"github.com/mwlng/k8s_resources_sync/pkg/k8s_resources"
+	"github.com/mwlng/k8s_resources_sync/pkg/ledger"
+	"github.com/mwlng/k8s_resources_sync/pkg/utils"
+)
+
+const (
+	fieldManager = "k8s_resources_sync"
+
+	crdPollInterval = 2 * time.Second
+)
+
+var crdGroupKind = schema.GroupKind{Group: "apiextensions.k8s.io", Kind: "CustomResourceDefinition"}
+
+func loadUnstructuredYamlFiles(rootDir string, match func(gvk *schema.GroupVersionKind) bool) []*unstructured.Unstructured {
+	objs := []*unstructured.Unstructured{}
+	err := filepath.Walk(rootDir, func(path string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !info.IsDir() {
+			ext := strings.ToLower(filepath.Ext(path))
+			if ext == ".yml" || ext == ".yaml" {
+				data, err := ioutil.ReadFile(path)
+				if err != nil {
+					klog.Errorf("Error while reading YAML file. Err was: %s", err)
+					return err
+				}
+
+				obj, gvk, err := dyna_client.UnstructuredDecode(data)
+				if err != nil {
+					klog.Errorf("Error while decoding YAML file: %s. Err was: %s", path, err)
+					return nil
+				}
+
+				if match(gvk) {
+					objs = append(objs, obj)
+				}
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
+		klog.Errorf("Error while reading YAML files. Err was: %s", err)
+	}
+
+	return objs
+}
+
+func LoadCustomResourceDefinitionYamlFiles(rootDir string) []*unstructured.Unstructured {
+	return loadUnstructuredYamlFiles(rootDir, func(gvk *schema.GroupVersionKind) bool {
+		return gvk.GroupKind() == crdGroupKind
+	})
+}
+
+// LoadCustomResourceYamlFiles loads every manifest whose kind is one of
+// kinds.
+func LoadCustomResourceYamlFiles(rootDir string, kinds CustomResourceKinds) []*unstructured.Unstructured {
+	return loadUnstructuredYamlFiles(rootDir, func(gvk *schema.GroupVersionKind) bool {
+		return kinds.Has(*gvk)
+	})
+}
+
+// CustomResourceKinds are the kinds backed by a CustomResourceDefinition.
+type CustomResourceKinds map[schema.GroupKind]bool
+
+// Has reports whether gvk is the kind of a custom resource.
+func (k CustomResourceKinds) Has(gvk schema.GroupVersionKind) bool {
+	return k[gvk.GroupKind()]
+}
+
+func (k CustomResourceKinds) add(crd *unstructured.Unstructured) {
+	group, _, _ := unstructured.NestedString(crd.Object, "spec", "group")
+	kind, _, _ := unstructured.NestedString(crd.Object, "spec", "names", "kind")
+	if len(kind) > 0 {
+		k[schema.GroupKind{Group: group, Kind: kind}] = true
+	}
+}
+
+// LoadCustomResourceKinds returns the kinds of the CRDs defined in rootDir
+// and of those of the cluster of kubeConfig. Other kinds that aren't built
+// into Kubernetes, e.g. of aggregated APIs or of kustomize files, aren't
+// custom resources.
+func LoadCustomResourceKinds(ctx context.Context, kubeConfig *rest.Config, rootDir string) (CustomResourceKinds, error) {
+	kinds := CustomResourceKinds{}
+	for _, crd := range LoadCustomResourceDefinitionYamlFiles(rootDir) {
+		kinds.add(crd)
+	}
+
+	cluster, err := k8s_resources.ClusterFor(kubeConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	crd := &unstructured.Unstructured{}
+	crd.SetGroupVersionKind(crdGroupKind.WithVersion("v1"))
+	crds, err := cluster.DynaClient.List(ctx, crd, k8s_resources.ListPageSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the custom resource definitions of %s: %s", kubeConfig.Host, err)
+	}
+	for i := range crds {
+		kinds.add(&crds[i])
+	}
+
+	return kinds, nil
+}
+
+// prepareUnstructured drops the fields the API server owns, so that an
+// object exported from a cluster can be server-side applied.
+func prepareUnstructured(obj *unstructured.Unstructured) {
+	obj.SetResourceVersion("")
+	obj.SetUID("")
+	obj.SetSelfLink("")
+	obj.SetGeneration(0)
+	obj.SetManagedFields(nil)
+	unstructured.RemoveNestedField(obj.Object, "metadata", "creationTimestamp")
+	unstructured.RemoveNestedField(obj.Object, "status")
+}
+
+func SyncCustomResourceDefinitions(ctx context.Context, kubeConfig *rest.Config, crds []*unstructured.Unstructured, filter *Filter) ([]*unstructured.Unstructured, Results, error) {
+	klog.Infof("Syncing custom resource definitions from cluster: %s\n", kubeConfig.Host)
+	cluster, err := k8s_resources.ClusterFor(kubeConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+	dynaClient := cluster.DynaClient
+
+	results := Results{}
+	synced_crds := []*unstructured.Unstructured{}
+	for _, crd := range crds {
+		if utils.Interrupted(ctx) {
+			results = append(results, skippedResult(crd.GetKind(), crd.GetNamespace(), crd.GetName(), reasonInterrupted))
+			continue
+		}
+
+		if !filter.Matches(crd) {
+			results = append(results, filteredResult(crd.GetKind(), crd.GetNamespace(), crd.GetName()))
+			continue
+		}
+
+		src_crd, err := dynaClient.Get(ctx, crd)
+		if err != nil {
+			klog.Errorf("Failed to get custom resource definition: %s. Err was: %s", crd.GetName(), err)
+			results = append(results, sourceErrorResult(crd.GetKind(), "", crd.GetName(), err))
+			continue
+		}
+
+		if src_crd != nil {
+			if !filter.Matches(src_crd) {
+				results = append(results, filteredResult(crd.GetKind(), crd.GetNamespace(), crd.GetName()))
+				continue
+			}
+
+			err := defaultMergeRule.Merge(crd, src_crd)
+			if err != nil {
+				klog.Errorf("Failed to merge custom resource definition: %s. Err was: %s", crd.GetName(), err)
+				results = append(results, failedResult(crd.GetKind(), "", crd.GetName(), err))
+				continue
+			}
+
+			synced_crds = append(synced_crds, crd)
+		}
+	}
+
+	return synced_crds, results, nil
+}
+
+// ApplyCustomResourceDefinitions applies the CRDs to the target cluster and
+// waits until every applied CRD is established, so that instances of it can
+// be created right after. An error is returned for the first CRD that
+// doesn't become established in time.
+func ApplyCustomResourceDefinitions(ctx context.Context, kubeConfig *rest.Config, crds []*unstructured.Unstructured, timeout time.Duration) (Results, error) {
+	cluster, err := k8s_resources.ClusterFor(kubeConfig)
+	if err != nil {
+		return nil, err
+	}
+	dynaClient := cluster.DynaClient
+
+	results := applyEach(ctx, len(crds), func(i int) Result {
+		crd := crds[i]
+		if utils.Interrupted(ctx) {
+			return skippedResult(crd.GetKind(), crd.GetNamespace(), crd.GetName(), reasonInterrupted)
+		}
+
+		klog.Infof("Applying custom resource definition: %s ...", crd.GetName())
+		prepareUnstructured(crd)
+		err := admitUnstructured(ctx, dynaClient, crd)
+		if err != nil {
+			return failedResult(crd.GetKind(), "", crd.GetName(), err)
+		}
+
+		if k8s_resources.IsDryRun(ctx) {
+			return planUnstructured(ctx, dynaClient, crd)
+		}
+
+		err = snapshotUnstructured(ctx, dynaClient, crd)
+		if err != nil {
+			klog.Errorf("Failed to snapshot custom resource definition. Err was: %s", err)
+			return failedResult(crd.GetKind(), "", crd.GetName(), err)
+		}
+
+		err = k8s_resources.Retry(ctx, "custom resource definition "+crd.GetName(), func() error {
+			return dynaClient.ApplyObject(ctx, crd, fieldManager, true)
+		})
+		if err != nil {
+			klog.Errorf("Failed to apply custom resource definition. Err was: %s", err)
+			return failedResult(crd.GetKind(), "", crd.GetName(), err)
+		}
+		klog.Infoln("Done.")
+
+		return Result{Kind: crd.GetKind(), Name: crd.GetName(), Status: ResultApplied}
+	})
+
+	if k8s_resources.IsDryRun(ctx) {
+		return results, nil
+	}
+
+	for i, crd := range crds {
+		if results[i].Status != ResultApplied {
+			continue
+		}
+
+		klog.Infof("Waiting for custom resource definition %s to be established ...", crd.GetName())
+		err := k8s_resources.Poll(ctx, crdPollInterval, timeout, func() (bool, error) {
+			result, err := dynaClient.Get(ctx, crd)
+			if err != nil {
+				return false, err
+			}
+			return crdEstablished(result), nil
+		})
+		if err != nil {
+			err = fmt.Errorf("custom resource definition %s is not established: %s", crd.GetName(), err)
+			results[i] = failedResult(crd.GetKind(), "", crd.GetName(), err)
+			return results, err
+		}
+	}
+
+	// The discovery cache is shared by the whole run, so it must learn about
+	// the new kinds before any custom resources are applied.
+	dynaClient.ResetMapper()
+
+	return results, nil
+}
+
+// planUnstructured works out whether applying obj would create, update or
+// leave unchanged its counterpart in the target cluster. Objects of kinds
+// the target cluster doesn't know yet, e.g. of CRDs still to be applied,
+// are reported as created.
+func planUnstructured(ctx context.Context, dynaClient *dyna_client.DynaClient, obj *unstructured.Unstructured) Result {
+	current, err := dynaClient.Get(ctx, obj)
+	if apierrors.IsNotFound(err) || meta.IsNoMatchError(err) {
+		return operationResult(obj.GetKind(), obj.GetNamespace(), obj.GetName(), k8s_resources.OperationCreated, nil)
+	}
+	if err != nil {
+		return failedResult(obj.GetKind(), obj.GetNamespace(), obj.GetName(), err)
+	}
+
+	applied, err := dynaClient.DryRunApplyObject(ctx, obj, fieldManager, true)
+	if err != nil {
+		return failedResult(obj.GetKind(), obj.GetNamespace(), obj.GetName(), err)
+	}
+
+	op := k8s_resources.OperationUpdated
+	if ledger.Hash(current) == ledger.Hash(applied) {
+		op = k8s_resources.OperationUnchanged
+	}
+
+	return operationResult(obj.GetKind(), obj.GetNamespace(), obj.GetName(), op, nil)
+}
+
+// snapshotUnstructured passes the current state of obj in the target
+// cluster to k8s_resources.Snapshot before obj is applied.
+func snapshotUnstructured(ctx context.Context, dynaClient *dyna_client.DynaClient, obj *unstructured.Unstructured) error {
+	if k8s_resources.OptionsFrom(ctx).Snapshots == nil {
+		return nil
+	}
+
+	current, err := dynaClient.Get(ctx, obj)
+	if apierrors.IsNotFound(err) {
+		return k8s_resources.Snapshot(ctx, obj.GroupVersionKind(), obj.GetNamespace(), obj.GetName(), nil)
+	}
+	if err != nil {
+		return err
+	}
+
+	return k8s_resources.Snapshot(ctx, obj.GroupVersionKind(), obj.GetNamespace(), obj.GetName(), current)
+}
+
+func crdEstablished(crd *unstructured.Unstructured) bool {
+	conditions, _, _ := unstructured.NestedSlice(crd.Object, "status", "conditions")
+	for _, c := range conditions {
+		condition, ok := c.(map[string]interface{})
+		if ok && condition["type"] == "Established" && condition["status"] == "True" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// SyncCustomResources merges each custom resource with its counterpart in the
+// source cluster according to the merge rule of its kind, and moves it to its
+// target namespace according to namespaceMap.
+func SyncCustomResources(ctx context.Context, kubeConfig *rest.Config, objs []*unstructured.Unstructured,
+	namespaceMap map[string]string, mergeRules *MergeRules, filter *Filter) ([]*unstructured.Unstructured, Results, error) {
+	klog.Infof("Syncing custom resources from cluster: %s\n", kubeConfig.Host)
+	cluster, err := k8s_resources.ClusterFor(kubeConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+	dynaClient := cluster.DynaClient
+
+	results := Results{}
+	synced_objs := []*unstructured.Unstructured{}
+	for _, obj := range objs {
+		if utils.Interrupted(ctx) {
+			results = append(results, skippedResult(obj.GetKind(), obj.GetNamespace(), obj.GetName(), reasonInterrupted))
+			continue
+		}
+
+		if !filter.Matches(obj) {
+			results = append(results, filteredResult(obj.GetKind(), obj.GetNamespace(), obj.GetName()))
+			continue
+		}
+
+		src_obj, err := dynaClient.Get(ctx, obj)
+		if err != nil {
+			klog.Errorf("Failed to get %s: %s. Err was: %s", obj.GetKind(), obj.GetName(), err)
+			results = append(results, sourceErrorResult(obj.GetKind(), obj.GetNamespace(), obj.GetName(), err))
+			continue
+		}
+
+		if src_obj != nil {
+			if !filter.Matches(src_obj) {
+				results = append(results, filteredResult(obj.GetKind(), obj.GetNamespace(), obj.GetName()))
+				continue
+			}
+
+			err := mergeRules.RuleFor(obj).Merge(obj, src_obj)
+			if err != nil {
+				klog.Errorf("Failed to merge %s: %s. Err was: %s", obj.GetKind(), obj.GetName(), err)
+				results = append(results, failedResult(obj.GetKind(), obj.GetNamespace(), obj.GetName(), err))
+				continue
+			}
+
+			if len(src_obj.GetNamespace()) > 0 {
+				obj.SetNamespace(mapNamespace(namespaceMap, src_obj.GetNamespace()))
+			}
+
+			synced_objs = append(synced_objs, obj)
+		}
+	}
+
+	return synced_objs, results, nil
+}
+
+func PrintCustomResources(objs []*unstructured.Unstructured) {
+	for _, obj := range objs {
+		result, _ := yaml.Marshal(obj.Object)
+		fmt.Printf("%s\n", string(result))
+	}
+}
+
+func ApplyCustomResources(ctx context.Context, kubeConfig *rest.Config, objs []*unstructured.Unstructured) (Results, error) {
+	cluster, err := k8s_resources.ClusterFor(kubeConfig)
+	if err != nil {
+		return nil, err
+	}
+	dynaClient := cluster.DynaClient
+
+	results := applyEach(ctx, len(objs), func(i int) Result {
+		obj := objs[i]
+		if utils.Interrupted(ctx) {
+			return skippedResult(obj.GetKind(), obj.GetNamespace(), obj.GetName(), reasonInterrupted)
+		}
+
+		klog.Infof("Applying %s: %s ...", obj.GetKind(), obj.GetName())
+		prepareUnstructured(obj)
+		err := admitUnstructured(ctx, dynaClient, obj)
+		if err != nil {
+			return failedResult(obj.GetKind(), obj.GetNamespace(), obj.GetName(), err)
+		}
+
+		if k8s_resources.IsDryRun(ctx) {
+			return planUnstructured(ctx, dynaClient, obj)
+		}
+
+		err = snapshotUnstructured(ctx, dynaClient, obj)
+		if err != nil {
+			klog.Errorf("Failed to snapshot %s. Err was: %s", obj.GetKind(), err)
+			return failedResult(obj.GetKind(), obj.GetNamespace(), obj.GetName(), err)
+		}
+
+		err = k8s_resources.Retry(ctx, obj.GetKind()+" "+obj.GetName(), func() error {
+			return dynaClient.ApplyObject(ctx, obj, fieldManager, true)
+		})
+		if err != nil {
+			klog.Errorf("Failed to apply %s. Err was: %s", obj.GetKind(), err)
+			return failedResult(obj.GetKind(), obj.GetNamespace(), obj.GetName(), err)
+		}
+		klog.Infoln("Done.")
+
+		return Result{Kind: obj.GetKind(), Namespace: obj.GetNamespace(), Name: obj.GetName(), Status: ResultApplied}
+	})
+
+	return results, nil
+}
@@ -0,0 +1,65 @@
+package helpers
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestLoadCustomResourceKinds(t *testing.T) {
+	// The source cluster has the Certificate CRD.
+	source := testAPIServer(t, map[string]string{
+		"/api":  `{"kind": "APIVersions", "versions": ["v1"]}`,
+		"/apis": `{"kind": "APIGroupList", "groups": [{"name": "apiextensions.k8s.io", "versions": [{"groupVersion": "apiextensions.k8s.io/v1", "version": "v1"}], "preferredVersion": {"groupVersion": "apiextensions.k8s.io/v1", "version": "v1"}}]}`,
+		"/apis/apiextensions.k8s.io/v1": `{"kind": "APIResourceList", "groupVersion": "apiextensions.k8s.io/v1", "resources": [
+			{"name": "customresourcedefinitions", "kind": "CustomResourceDefinition", "namespaced": false, "verbs": ["get", "list"]}
+		]}`,
+		"/apis/apiextensions.k8s.io/v1/customresourcedefinitions": `{"kind": "CustomResourceDefinitionList", "apiVersion": "apiextensions.k8s.io/v1", "metadata": {}, "items": [
+			{"apiVersion": "apiextensions.k8s.io/v1", "kind": "CustomResourceDefinition", "metadata": {"name": "certificates.cert-manager.io"},
+			 "spec": {"group": "cert-manager.io", "names": {"kind": "Certificate", "plural": "certificates"}, "scope": "Namespaced"}}
+		]}`,
+	})
+
+	dir := t.TempDir()
+	for name, data := range map[string]string{
+		"crd.yaml":           "apiVersion: apiextensions.k8s.io/v1\nkind: CustomResourceDefinition\nmetadata:\n  name: widgets.example.com\nspec:\n  group: example.com\n  names:\n    kind: Widget\n    plural: widgets\n  scope: Namespaced\n",
+		"widget.yaml":        "apiVersion: example.com/v1\nkind: Widget\nmetadata:\n  name: w\n",
+		"certificate.yaml":   "apiVersion: cert-manager.io/v1\nkind: Certificate\nmetadata:\n  name: c\n",
+		"apiservice.yaml":    "apiVersion: apiregistration.k8s.io/v1\nkind: APIService\nmetadata:\n  name: v1beta1.metrics.k8s.io\n",
+		"kustomization.yaml": "apiVersion: kustomize.config.k8s.io/v1beta1\nkind: Kustomization\nresources:\n- widget.yaml\n",
+		"service.yaml":       "apiVersion: v1\nkind: Service\nmetadata:\n  name: s\n",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	kinds, err := LoadCustomResourceKinds(context.Background(), source, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for gvk, want := range map[schema.GroupVersionKind]bool{
+		{Group: "example.com", Version: "v1", Kind: "Widget"}:                            true,
+		{Group: "cert-manager.io", Version: "v1", Kind: "Certificate"}:                   true,
+		{Group: "apiregistration.k8s.io", Version: "v1", Kind: "APIService"}:             false,
+		{Group: "kustomize.config.k8s.io", Version: "v1beta1", Kind: "Kustomization"}:    false,
+		{Group: "apiextensions.k8s.io", Version: "v1", Kind: "CustomResourceDefinition"}: false,
+	} {
+		if kinds.Has(gvk) != want {
+			t.Errorf("Has(%s) = %t, want %t", gvk, !want, want)
+		}
+	}
+
+	names := []string{}
+	for _, obj := range LoadCustomResourceYamlFiles(dir, kinds) {
+		names = append(names, obj.GetKind()+" "+obj.GetName())
+	}
+	sort.Strings(names)
+	if len(names) != 2 || names[0] != "Certificate c" || names[1] != "Widget w" {
+		t.Errorf("LoadCustomResourceYamlFiles() = %q, want the Certificate and the Widget", names)
+	}
+}
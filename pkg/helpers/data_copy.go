@@ -0,0 +1,94 @@
+package helpers
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"k8s.io/klog/v2"
+
+	"github.com/mwlng/k8s_resources_sync/pkg/utils"
+)
+
+// DataCopyHook copies the data of a claim in the source cluster into its
+// newly created counterpart in the target cluster, e.g. by running an rsync
+// job.
+type DataCopyHook interface {
+	CopyData(ctx context.Context, source, target *corev1.PersistentVolumeClaim) error
+}
+
+// CommandDataCopyHook runs a shell command for each pair of claims. The
+// claims are passed to the command through the SOURCE_NAMESPACE, SOURCE_PVC,
+// SOURCE_STORAGE_CLASS, TARGET_NAMESPACE, TARGET_PVC and TARGET_STORAGE_CLASS
+// environment variables, together with the hosts of both clusters in
+// SOURCE_HOST and TARGET_HOST.
+type CommandDataCopyHook struct {
+	Command    string
+	SourceHost string
+	TargetHost string
+}
+
+func (h *CommandDataCopyHook) CopyData(ctx context.Context, source, target *corev1.PersistentVolumeClaim) error {
+	storageClassOf := func(claim *corev1.PersistentVolumeClaim) string {
+		if claim.Spec.StorageClassName == nil {
+			return ""
+		}
+		return *claim.Spec.StorageClassName
+	}
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", h.Command)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(),
+		"SOURCE_HOST="+h.SourceHost,
+		"SOURCE_NAMESPACE="+source.Namespace,
+		"SOURCE_PVC="+source.Name,
+		"SOURCE_STORAGE_CLASS="+storageClassOf(source),
+		"TARGET_HOST="+h.TargetHost,
+		"TARGET_NAMESPACE="+target.Namespace,
+		"TARGET_PVC="+target.Name,
+		"TARGET_STORAGE_CLASS="+storageClassOf(target),
+	)
+
+	return cmd.Run()
+}
+
+// CopyPersistentVolumeClaimData runs hook for every claim created in the
+// target cluster, paired with its claim in the source cluster in sources.
+// The created result of a claim in results whose data couldn't be copied is
+// replaced by a failed one, and the updated results are returned.
+func CopyPersistentVolumeClaimData(ctx context.Context, claims []*corev1.PersistentVolumeClaim, sources ClaimSources,
+	hook DataCopyHook, results Results) Results {
+	for _, claim := range claims {
+		namespace := namespaceOf(claim.Namespace)
+		if utils.Interrupted(ctx) {
+			results.replace(failedResult("PersistentVolumeClaim", namespace, claim.Name,
+				fmt.Errorf("data copy: %s", reasonInterrupted)))
+			continue
+		}
+
+		src_claim, ok := sources[claimKey(claim)]
+		if !ok {
+			klog.Errorf("No source claim for %s/%s, skipping data copy", namespace, claim.Name)
+			results.replace(failedResult("PersistentVolumeClaim", namespace, claim.Name,
+				fmt.Errorf("data copy: no source claim")))
+			continue
+		}
+
+		klog.Infof("Copying data of persistent volume claim %s/%s to %s/%s ...",
+			src_claim.Namespace, src_claim.Name, namespace, claim.Name)
+		err := hook.CopyData(ctx, src_claim, claim)
+		if err != nil {
+			klog.Errorf("Failed to copy data of persistent volume claim: %s/%s. Err was: %s", namespace, claim.Name, err)
+			results.replace(failedResult("PersistentVolumeClaim", namespace, claim.Name,
+				fmt.Errorf("data copy: %s", err)))
+			continue
+		}
+		klog.Infoln("Done.")
+	}
+
+	return results
+}
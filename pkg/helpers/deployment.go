@@ -1,6 +1,7 @@
 package helpers
 
 import (
+	"context"
 	"fmt"
 	"io/fs"
 	"io/ioutil"
@@ -17,6 +18,7 @@ import (
 	"k8s.io/klog/v2"
 
 	"github.com/mwlng/k8s_resources_sync/pkg/k8s_resources"
+	"github.com/mwlng/k8s_resources_sync/pkg/utils"
 )
 
 func LoadDeploymentYamlFiles(rootDir string) []*appsv1.Deployment {
@@ -59,22 +61,49 @@ func LoadDeploymentYamlFiles(rootDir string) []*appsv1.Deployment {
 	return deployments
 }
 
-func SyncDeployments(kubeConfig *rest.Config, deployments []*appsv1.Deployment) []*appsv1.Deployment {
+func SyncDeployments(ctx context.Context, kubeConfig *rest.Config, deployments []*appsv1.Deployment, images *ImageRewriter, filter *Filter) ([]*appsv1.Deployment, Results, error) {
 	klog.Infof("Syncing deployments from cluster: %s, namespace: %s\n", kubeConfig.Host, corev1.NamespaceDefault)
 	deployment, err := k8s_resources.NewDeployment(kubeConfig, corev1.NamespaceDefault)
 	if err != nil {
-		panic(err)
+		return nil, nil, err
+	}
+
+	getDeployment := deployment.GetDeployment
+	if len(deployments) >= listThreshold {
+		index, err := deployment.IndexDeployments(ctx)
+		if err != nil {
+			klog.Warningf("Failed to list deployments, falling back to one get per object. Err was: %s", err)
+		} else {
+			getDeployment = index.GetDeployment
+		}
 	}
 
+	results := Results{}
 	synced_Deployments := []*appsv1.Deployment{}
 	for _, d := range deployments {
-		src_deployment, err := deployment.GetDeployment(d.Name)
+		if utils.Interrupted(ctx) {
+			results = append(results, skippedResult("Deployment", corev1.NamespaceDefault, d.Name, reasonInterrupted))
+			continue
+		}
+
+		if !filter.Matches(d) {
+			results = append(results, filteredResult("Deployment", corev1.NamespaceDefault, d.Name))
+			continue
+		}
+
+		src_deployment, err := getDeployment(ctx, d.Name)
 		if err != nil {
 			klog.Errorf("Failed to get deployment: %s. Err was: %s", d.Name, err)
+			results = append(results, sourceErrorResult("Deployment", corev1.NamespaceDefault, d.Name, err))
 			continue
 		}
 
 		if src_deployment != nil {
+			if !filter.Matches(src_deployment) {
+				results = append(results, filteredResult("Deployment", corev1.NamespaceDefault, d.Name))
+				continue
+			}
+
 			containerImageMap := map[string]string{}
 			for _, c := range src_deployment.Spec.Template.Spec.Containers {
 				containerImageMap[c.Name] = c.Image
@@ -84,13 +113,20 @@ func SyncDeployments(kubeConfig *rest.Config, deployments []*appsv1.Deployment)
 				d.Spec.Template.Spec.Containers[i].Image = containerImageMap[c.Name]
 			}
 
+			err = images.Rewrite(ctx, "Deployment", corev1.NamespaceDefault, &d.ObjectMeta, &d.Spec.Template.Spec, src_deployment.Spec.Selector)
+			if err != nil {
+				klog.Errorf("Failed to rewrite the images of deployment: %s. Err was: %s", d.Name, err)
+				results = append(results, failedResult("Deployment", corev1.NamespaceDefault, d.Name, err))
+				continue
+			}
+
 			d.Spec.Replicas = src_deployment.Spec.Replicas
 
 			synced_Deployments = append(synced_Deployments, d)
 		}
 	}
 
-	return synced_Deployments
+	return synced_Deployments, results, nil
 }
 
 func PrintDeployments(deployments []*appsv1.Deployment) {
@@ -100,21 +136,30 @@ func PrintDeployments(deployments []*appsv1.Deployment) {
 	}
 }
 
-func ApplyDeployments(kubeConfig *rest.Config, deployments []*appsv1.Deployment) {
+func ApplyDeployments(ctx context.Context, kubeConfig *rest.Config, deployments []*appsv1.Deployment) (Results, error) {
 	deployment, err := k8s_resources.NewDeployment(kubeConfig, corev1.NamespaceDefault)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
-	for _, d := range deployments {
+	results := applyEach(ctx, len(deployments), func(i int) Result {
+		d := deployments[i]
+		if utils.Interrupted(ctx) {
+			return skippedResult("Deployment", corev1.NamespaceDefault, d.Name, reasonInterrupted)
+		}
+
 		klog.Infof("Applying deployment %s ...", d.Name)
-		err := deployment.ApplyDeployment(d)
+		op, err := deployment.ApplyDeployment(ctx, d)
 		if err != nil {
 			klog.Errorf("Failed to apply deployment. Err was: %s", err)
-			continue
+			return operationResult("Deployment", corev1.NamespaceDefault, d.Name, op, err)
 		}
 		klog.Infoln("Done.")
-	}
+
+		return operationResult("Deployment", corev1.NamespaceDefault, d.Name, op, nil)
+	})
+
+	return results, nil
 }
 
 /*func ApplyDeployments(kubeConfig *rest.Config, deployments []*appsv1.Deployment) {
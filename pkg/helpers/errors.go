@@ -0,0 +1,58 @@
+package helpers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// errorClass returns a short classification of an API error, e.g.
+// "forbidden" or "timeout", or an empty string when it isn't known.
+func errorClass(err error) string {
+	switch {
+	case apierrors.IsNotFound(err):
+		return "not found"
+	case apierrors.IsForbidden(err):
+		return "forbidden"
+	case apierrors.IsUnauthorized(err):
+		return "unauthorized"
+	case apierrors.IsConflict(err):
+		return "conflict"
+	case apierrors.IsAlreadyExists(err):
+		return "already exists"
+	case apierrors.IsInvalid(err):
+		return "invalid"
+	case apierrors.IsTimeout(err), apierrors.IsServerTimeout(err), errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case apierrors.IsTooManyRequests(err):
+		return "throttled"
+	case errors.Is(err, context.Canceled):
+		return "cancelled"
+	case apierrors.IsInternalError(err), apierrors.IsServiceUnavailable(err), apierrors.IsUnexpectedServerError(err):
+		return "server error"
+	}
+
+	return ""
+}
+
+// errorReason formats err for the report, prefixed with its class.
+func errorReason(err error) string {
+	if class := errorClass(err); len(class) > 0 {
+		return fmt.Sprintf("%s: %s", class, err)
+	}
+
+	return err.Error()
+}
+
+// sourceErrorResult reports an object that couldn't be read from the source
+// cluster. Objects missing in the source are reported separately from the
+// ones that couldn't be read because of a real failure.
+func sourceErrorResult(kind, namespace, name string, err error) Result {
+	if apierrors.IsNotFound(err) {
+		return Result{Kind: kind, Namespace: namespace, Name: name, Status: ResultMissing, Reason: "missing in source cluster"}
+	}
+
+	return failedResult(kind, namespace, name, err)
+}
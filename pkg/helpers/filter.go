@@ -0,0 +1,109 @@
+package helpers
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// Filter selects the objects to sync by label selector and name patterns.
+// A nil Filter matches every object.
+type Filter struct {
+	selector labels.Selector
+	names    []namePattern
+	excludes []namePattern
+}
+
+// namePattern matches either the name or the namespace/name of an object,
+// as a glob, or as a regular expression when written as /regexp/.
+type namePattern struct {
+	glob string
+	re   *regexp.Regexp
+}
+
+func newNamePattern(s string) (namePattern, error) {
+	if len(s) > 1 && strings.HasPrefix(s, "/") && strings.HasSuffix(s, "/") {
+		re, err := regexp.Compile("^(?:" + s[1:len(s)-1] + ")$")
+		if err != nil {
+			return namePattern{}, err
+		}
+		return namePattern{re: re}, nil
+	}
+
+	if _, err := path.Match(s, ""); err != nil {
+		return namePattern{}, fmt.Errorf("invalid glob %q: %s", s, err)
+	}
+	return namePattern{glob: s}, nil
+}
+
+func (p namePattern) match(s string) bool {
+	if p.re != nil {
+		return p.re.MatchString(s)
+	}
+
+	matched, _ := path.Match(p.glob, s)
+	return matched
+}
+
+// NewFilter builds a Filter from a label selector and the name patterns to
+// include and exclude. Empty arguments don't filter anything.
+func NewFilter(selector string, names, excludes []string) (*Filter, error) {
+	f := &Filter{selector: labels.Everything()}
+	if len(selector) > 0 {
+		s, err := labels.Parse(selector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid selector: %s", err)
+		}
+		f.selector = s
+	}
+
+	for _, name := range names {
+		p, err := newNamePattern(name)
+		if err != nil {
+			return nil, err
+		}
+		f.names = append(f.names, p)
+	}
+
+	for _, exclude := range excludes {
+		p, err := newNamePattern(exclude)
+		if err != nil {
+			return nil, err
+		}
+		f.excludes = append(f.excludes, p)
+	}
+
+	return f, nil
+}
+
+// Matches reports whether obj carries labels matching the selector, has a
+// name matching one of the name patterns, if any, and none of the exclude
+// patterns.
+func (f *Filter) Matches(obj metav1.Object) bool {
+	if f == nil {
+		return true
+	}
+
+	if !f.selector.Matches(labels.Set(obj.GetLabels())) {
+		return false
+	}
+
+	matchAny := func(patterns []namePattern) bool {
+		for _, p := range patterns {
+			if p.match(obj.GetName()) || (len(obj.GetNamespace()) > 0 && p.match(obj.GetNamespace()+"/"+obj.GetName())) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if len(f.names) > 0 && !matchAny(f.names) {
+		return false
+	}
+
+	return !matchAny(f.excludes)
+}
@@ -0,0 +1,263 @@
+package helpers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/rest"
+	"k8s.io/klog/v2"
+
+	"github.com/mwlng/k8s_resources_sync/pkg/k8s_resources"
+	"github.com/mwlng/k8s_resources_sync/pkg/registry"
+	"github.com/mwlng/k8s_resources_sync/pkg/utils"
+)
+
+// ImageUse is a container image of a workload, together with what the
+// kubelet pulls it with.
+type ImageUse struct {
+	Kind      string
+	Namespace string
+	Name      string
+	Container string
+	Image     string
+
+	PullSecrets    []string
+	ServiceAccount string
+}
+
+// PodImages returns the images of the containers and init containers of the
+// pod template spec of a workload.
+func PodImages(kind, namespace, name string, spec *corev1.PodSpec) []ImageUse {
+	uses := []ImageUse{}
+	containers := append(append([]corev1.Container{}, spec.InitContainers...), spec.Containers...)
+	for _, c := range containers {
+		if len(c.Image) == 0 {
+			continue
+		}
+		use := podImage(namespace, spec, c.Image)
+		use.Kind, use.Name, use.Container = kind, name, c.Name
+		uses = append(uses, use)
+	}
+
+	return uses
+}
+
+// podImage returns the use of image by a pod of spec in namespace.
+func podImage(namespace string, spec *corev1.PodSpec, image string) ImageUse {
+	secrets := []string{}
+	for _, s := range spec.ImagePullSecrets {
+		secrets = append(secrets, s.Name)
+	}
+	serviceAccount := spec.ServiceAccountName
+	if len(serviceAccount) == 0 {
+		serviceAccount = "default"
+	}
+
+	return ImageUse{Namespace: namespace, Image: image, PullSecrets: secrets, ServiceAccount: serviceAccount}
+}
+
+// ImageIssue is an image the target cluster won't be able to pull.
+type ImageIssue struct {
+	ImageUse
+	Problem string
+}
+
+// ImageOptions configure how images are resolved.
+type ImageOptions struct {
+	// DockerConfig is the path of a docker config file whose credentials,
+	// and credential helpers, are used for the registries the image pull
+	// secrets have none for. It's ignored when it doesn't exist.
+	DockerConfig string
+	// Insecure lists the registry hosts reached over plain HTTP.
+	Insecure map[string]bool
+}
+
+// VerifyImages resolves every image of uses with the Docker Registry v2 API,
+// with the credentials of the image pull secrets of its pod and of its
+// service account in the target cluster, and returns the ones that can't be
+// pulled: missing repositories, tags or digests, and denied pulls.
+func VerifyImages(ctx context.Context, kubeConfig *rest.Config, uses []ImageUse, opts ImageOptions) ([]ImageIssue, error) {
+	pullSecrets, err := newPullSecrets(kubeConfig, opts)
+	if err != nil {
+		return nil, err
+	}
+	client := &registry.Client{Insecure: opts.Insecure}
+
+	problems := map[string]string{}
+	issues := []ImageIssue{}
+	for _, use := range uses {
+		if utils.Interrupted(ctx) {
+			return issues, fmt.Errorf("interrupted")
+		}
+
+		keychain, key, err := pullSecrets.credentials(ctx, use)
+		if err != nil {
+			return nil, err
+		}
+
+		// Images are resolved once per set of credentials.
+		problem, ok := problems[use.Image+" "+key]
+		if !ok {
+			_, problem = resolveImage(ctx, client, use.Image, keychain)
+			problems[use.Image+" "+key] = problem
+		}
+
+		if len(problem) > 0 {
+			issues = append(issues, ImageIssue{ImageUse: use, Problem: problem})
+		}
+	}
+
+	return issues, nil
+}
+
+// resolveImage returns the digest of image, or why it can't be pulled.
+func resolveImage(ctx context.Context, client *registry.Client, image string, keychain registry.Keychain) (string, string) {
+	ref, err := registry.ParseReference(image)
+	if err != nil {
+		return "", err.Error()
+	}
+
+	digest, err := client.Resolve(ctx, ref, keychain)
+	switch {
+	case err == nil:
+		return digest, ""
+	case err == registry.ErrNotFound:
+		return "", fmt.Sprintf("%s not found in %s", ref.Version(), ref.Registry)
+	case err == registry.ErrUnauthorized:
+		if _, ok, _ := keychain.Lookup(ref.Registry); !ok {
+			return "", fmt.Sprintf("pull denied by %s, no credentials for it", ref.Registry)
+		}
+		return "", fmt.Sprintf("pull denied by %s", ref.Registry)
+	}
+
+	return "", fmt.Sprintf("failed to resolve: %s", err)
+}
+
+// pullSecrets caches the image pull secrets of a cluster and of its service
+// accounts.
+type pullSecrets struct {
+	kubeConfig *rest.Config
+	local      registry.Keychain
+	keychains  map[string]registry.Keychain
+	accounts   map[string][]string
+}
+
+func newPullSecrets(kubeConfig *rest.Config, opts ImageOptions) (*pullSecrets, error) {
+	local := registry.Keychain{}
+	if len(opts.DockerConfig) > 0 && utils.FileExists(opts.DockerConfig) {
+		keychain, err := registry.LoadDockerConfig(opts.DockerConfig)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load docker config %s: %s", opts.DockerConfig, err)
+		}
+		local = keychain
+	}
+
+	return &pullSecrets{
+		kubeConfig: kubeConfig,
+		local:      local,
+		keychains:  map[string]registry.Keychain{},
+		accounts:   map[string][]string{},
+	}, nil
+}
+
+// credentials returns the credentials the image of use is pulled with,
+// those of its image pull secrets and then those of the docker config, and
+// a key identifying them.
+func (p *pullSecrets) credentials(ctx context.Context, use ImageUse) (registry.Keychain, string, error) {
+	secrets, err := p.names(ctx, use)
+	if err != nil {
+		return registry.Keychain{}, "", err
+	}
+
+	keychain := registry.Keychain{}
+	for _, name := range secrets {
+		secretKeychain, err := p.keychain(ctx, use.Namespace, name)
+		if err != nil {
+			return registry.Keychain{}, "", err
+		}
+		keychain = keychain.Merge(secretKeychain)
+	}
+
+	return keychain.Merge(p.local), use.Namespace + "/" + strings.Join(secrets, ","), nil
+}
+
+// names returns the image pull secrets of use, those of its pod spec
+// followed by those of its service account, sorted.
+func (p *pullSecrets) names(ctx context.Context, use ImageUse) ([]string, error) {
+	key := use.Namespace + "/" + use.ServiceAccount
+	accountSecrets, ok := p.accounts[key]
+	if !ok {
+		serviceAccount, err := k8s_resources.NewServiceAccount(p.kubeConfig, use.Namespace)
+		if err != nil {
+			return nil, err
+		}
+
+		account, err := serviceAccount.GetServiceAccount(ctx, use.ServiceAccount)
+		if err != nil && !apierrors.IsNotFound(err) {
+			return nil, fmt.Errorf("failed to get service account %s: %s", key, err)
+		}
+		if account != nil {
+			for _, s := range account.ImagePullSecrets {
+				accountSecrets = append(accountSecrets, s.Name)
+			}
+		}
+		p.accounts[key] = accountSecrets
+	}
+
+	names := append(append([]string{}, use.PullSecrets...), accountSecrets...)
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// keychain returns the credentials of an image pull secret, which are empty
+// if it doesn't exist in the cluster, e.g. when not synced yet.
+func (p *pullSecrets) keychain(ctx context.Context, namespace, name string) (registry.Keychain, error) {
+	key := namespace + "/" + name
+	if keychain, ok := p.keychains[key]; ok {
+		return keychain, nil
+	}
+
+	secret, err := k8s_resources.NewSecret(p.kubeConfig, namespace)
+	if err != nil {
+		return registry.Keychain{}, err
+	}
+
+	keychain := registry.Keychain{}
+	s, err := secret.GetSecret(ctx, name)
+	switch {
+	case apierrors.IsNotFound(err):
+		klog.Warningf("Image pull secret %s doesn't exist in cluster %s", key, p.kubeConfig.Host)
+	case err != nil:
+		return registry.Keychain{}, fmt.Errorf("failed to get image pull secret %s: %s", key, err)
+	case s.Type == corev1.SecretTypeDockerConfigJson:
+		keychain, err = registry.ParseDockerConfig(s.Data[corev1.DockerConfigJsonKey])
+	case s.Type == corev1.SecretTypeDockercfg:
+		keychain, err = registry.ParseDockerConfig(s.Data[corev1.DockerConfigKey])
+	default:
+		klog.Warningf("Image pull secret %s is of type %s, ignoring it", key, s.Type)
+	}
+	if err != nil {
+		klog.Warningf("Failed to parse image pull secret %s, ignoring it. Err was: %s", key, err)
+		keychain = registry.Keychain{}
+	}
+	p.keychains[key] = keychain
+
+	return keychain, nil
+}
+
+// PrintImageIssues writes a table of the images that can't be pulled.
+func PrintImageIssues(w io.Writer, issues []ImageIssue) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "KIND\tNAME\tCONTAINER\tIMAGE\tPROBLEM")
+	for _, issue := range issues {
+		fmt.Fprintf(tw, "%s\t%s/%s\t%s\t%s\t%s\n", issue.Kind, issue.Namespace, issue.Name, issue.Container, issue.Image, issue.Problem)
+	}
+	tw.Flush()
+}
@@ -0,0 +1,327 @@
+package helpers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/klog/v2"
+
+	"github.com/mwlng/k8s_resources_sync/pkg/k8s_resources"
+	"github.com/mwlng/k8s_resources_sync/pkg/registry"
+)
+
+// ImageRewriter rewrites the images of the workloads synced from the source
+// cluster. A nil ImageRewriter leaves them as they are.
+type ImageRewriter struct {
+	// PinDigests pins every image to the digest the source cluster runs,
+	// from the status of its pods, or else from the registry.
+	PinDigests bool
+	// Registries maps the registries of the images to the ones the target
+	// cluster pulls from.
+	Registries registry.Mapping
+
+	source      *rest.Config
+	client      *registry.Client
+	pullSecrets *pullSecrets
+	digests     map[string]string
+
+	rewrites map[string]ImageRewrite
+}
+
+// ImageRewrite is an image of a container replaced by an ImageRewriter.
+type ImageRewrite struct {
+	Kind      string
+	Namespace string
+	Name      string
+	Container string
+	From      string
+	To        string
+}
+
+// NewImageRewriter returns an ImageRewriter for the workloads of the source
+// cluster, resolving images in their registries according to opts.
+func NewImageRewriter(source *rest.Config, opts ImageOptions) (*ImageRewriter, error) {
+	pullSecrets, err := newPullSecrets(source, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ImageRewriter{
+		source:      source,
+		client:      &registry.Client{Insecure: opts.Insecure},
+		pullSecrets: pullSecrets,
+		digests:     map[string]string{},
+		rewrites:    map[string]ImageRewrite{},
+	}, nil
+}
+
+// Rewrite rewrites the images of spec, the pod template spec of a workload
+// of kind synced from namespace in the source cluster, where its pods are
+// selected by selector, or nil if it has none of its own. Images are pinned
+// to digests first, recording the images replaced by digests in the
+// PinnedImagesAnnotation of meta, and then their registries are mapped.
+func (w *ImageRewriter) Rewrite(ctx context.Context, kind, namespace string, meta *metav1.ObjectMeta, spec *corev1.PodSpec, selector *metav1.LabelSelector) error {
+	if w == nil {
+		return nil
+	}
+
+	original := podImagesByContainer(spec)
+	if w.PinDigests {
+		if err := w.pin(ctx, namespace, meta, spec, selector); err != nil {
+			return err
+		}
+	}
+	w.mapRegistries(spec)
+	w.record(kind, namespace, meta.Name, original, spec)
+
+	return nil
+}
+
+// RewriteRegistries maps the registries of the images of spec, the pod
+// template spec of a workload of kind synced from namespace, without pinning
+// them.
+func (w *ImageRewriter) RewriteRegistries(kind, namespace string, meta *metav1.ObjectMeta, spec *corev1.PodSpec) {
+	if w == nil {
+		return
+	}
+
+	original := podImagesByContainer(spec)
+	w.mapRegistries(spec)
+	w.record(kind, namespace, meta.Name, original, spec)
+}
+
+func (w *ImageRewriter) pin(ctx context.Context, namespace string, meta *metav1.ObjectMeta, spec *corev1.PodSpec, selector *metav1.LabelSelector) error {
+	running, err := w.runningDigests(ctx, namespace, spec, selector)
+	if err != nil {
+		return err
+	}
+
+	pinned := []string{}
+	for _, containers := range [][]corev1.Container{spec.InitContainers, spec.Containers} {
+		for i, c := range containers {
+			if len(c.Image) == 0 || strings.Contains(c.Image, "@") {
+				continue
+			}
+
+			digest, ok := running[c.Name]
+			if !ok {
+				digest, err = w.resolve(ctx, namespace, spec, c.Image)
+				if err != nil {
+					return fmt.Errorf("failed to pin the image %s of container %s: %s", c.Image, c.Name, err)
+				}
+			}
+
+			containers[i].Image = pinImage(c.Image, digest)
+			pinned = append(pinned, c.Name+"="+c.Image)
+		}
+	}
+
+	if len(pinned) > 0 {
+		sort.Strings(pinned)
+		if meta.Annotations == nil {
+			meta.Annotations = map[string]string{}
+		}
+		meta.Annotations[k8s_resources.PinnedImagesAnnotation] = strings.Join(pinned, ",")
+	}
+
+	return nil
+}
+
+// mapRegistries maps the registries of the images of the containers, init
+// containers and ephemeral containers of spec.
+func (w *ImageRewriter) mapRegistries(spec *corev1.PodSpec) {
+	if len(w.Registries) == 0 {
+		return
+	}
+
+	for i := range spec.InitContainers {
+		spec.InitContainers[i].Image, _ = w.Registries.Rewrite(spec.InitContainers[i].Image)
+	}
+	for i := range spec.Containers {
+		spec.Containers[i].Image, _ = w.Registries.Rewrite(spec.Containers[i].Image)
+	}
+	for i := range spec.EphemeralContainers {
+		spec.EphemeralContainers[i].Image, _ = w.Registries.Rewrite(spec.EphemeralContainers[i].Image)
+	}
+}
+
+// record keeps the images of spec that differ from original for the report.
+// Workloads rewritten again, e.g. when planned before being synced, are
+// only reported once.
+func (w *ImageRewriter) record(kind, namespace, name string, original map[string]string, spec *corev1.PodSpec) {
+	for container, image := range podImagesByContainer(spec) {
+		if from := original[container]; from != image {
+			w.rewrites[kind+"/"+namespace+"/"+name+"/"+container] = ImageRewrite{
+				Kind:      kind,
+				Namespace: namespace,
+				Name:      name,
+				Container: container,
+				From:      from,
+				To:        image,
+			}
+		}
+	}
+}
+
+// Rewrites returns the images rewritten so far, sorted by workload and
+// container.
+func (w *ImageRewriter) Rewrites() []ImageRewrite {
+	if w == nil {
+		return nil
+	}
+
+	keys := make([]string, 0, len(w.rewrites))
+	for key := range w.rewrites {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	rewrites := make([]ImageRewrite, len(keys))
+	for i, key := range keys {
+		rewrites[i] = w.rewrites[key]
+	}
+
+	return rewrites
+}
+
+// PrintImageRewrites writes a table of the rewritten images.
+func PrintImageRewrites(w io.Writer, rewrites []ImageRewrite) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "KIND\tNAME\tCONTAINER\tIMAGE\tREWRITTEN TO")
+	for _, r := range rewrites {
+		fmt.Fprintf(tw, "%s\t%s/%s\t%s\t%s\t%s\n", r.Kind, r.Namespace, r.Name, r.Container, r.From, r.To)
+	}
+	tw.Flush()
+}
+
+// podImagesByContainer returns the images of all the containers of spec, by
+// container name.
+func podImagesByContainer(spec *corev1.PodSpec) map[string]string {
+	images := map[string]string{}
+	for _, c := range spec.InitContainers {
+		images[c.Name] = c.Image
+	}
+	for _, c := range spec.Containers {
+		images[c.Name] = c.Image
+	}
+	for _, c := range spec.EphemeralContainers {
+		images[c.Name] = c.Image
+	}
+
+	return images
+}
+
+// runningDigests returns the digests of the images run by the containers and
+// init containers of the pods selected by selector, by container name. Containers whose pods
+// run another image, e.g. during a rollout, or different digests of it, are
+// left out.
+func (w *ImageRewriter) runningDigests(ctx context.Context, namespace string, spec *corev1.PodSpec, selector *metav1.LabelSelector) (map[string]string, error) {
+	running := map[string]string{}
+	if selector == nil {
+		return running, nil
+	}
+
+	labelSelector, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		return nil, err
+	}
+
+	pod, err := k8s_resources.NewPod(w.source, namespace)
+	if err != nil {
+		return nil, err
+	}
+	pods, err := pod.ListPods(ctx, labelSelector.String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the pods of the workload: %s", err)
+	}
+
+	images := map[string]string{}
+	for _, c := range append(append([]corev1.Container{}, spec.InitContainers...), spec.Containers...) {
+		images[c.Name] = c.Image
+	}
+
+	digests := map[string]map[string]bool{}
+	for _, p := range pods.Items {
+		podImages := map[string]string{}
+		for _, c := range append(append([]corev1.Container{}, p.Spec.InitContainers...), p.Spec.Containers...) {
+			podImages[c.Name] = c.Image
+		}
+
+		statuses := append(append([]corev1.ContainerStatus{}, p.Status.InitContainerStatuses...), p.Status.ContainerStatuses...)
+		for _, status := range statuses {
+			if podImages[status.Name] != images[status.Name] {
+				continue
+			}
+
+			digest := imageDigest(status.ImageID)
+			if len(digest) == 0 {
+				continue
+			}
+			if digests[status.Name] == nil {
+				digests[status.Name] = map[string]bool{}
+			}
+			digests[status.Name][digest] = true
+		}
+	}
+
+	for name, set := range digests {
+		if len(set) > 1 {
+			klog.Warningf("Pods run %d digests of image %s, resolving it in the registry", len(set), images[name])
+			continue
+		}
+		for digest := range set {
+			running[name] = digest
+		}
+	}
+
+	return running, nil
+}
+
+// resolve returns the digest of image in its registry, with the credentials
+// of the pod spec.
+func (w *ImageRewriter) resolve(ctx context.Context, namespace string, spec *corev1.PodSpec, image string) (string, error) {
+	keychain, key, err := w.pullSecrets.credentials(ctx, podImage(namespace, spec, image))
+	if err != nil {
+		return "", err
+	}
+
+	if digest, ok := w.digests[image+" "+key]; ok {
+		return digest, nil
+	}
+
+	digest, problem := resolveImage(ctx, w.client, image, keychain)
+	if len(problem) > 0 {
+		return "", fmt.Errorf("%s", problem)
+	}
+	w.digests[image+" "+key] = digest
+
+	return digest, nil
+}
+
+// imageDigest returns the digest of the imageID of a container status, like
+// docker-pullable://nginx@sha256:..., or an empty string when it only has the
+// ID of the image configuration, which can't be pulled.
+func imageDigest(imageID string) string {
+	if i := strings.LastIndex(imageID, "@"); i >= 0 {
+		return imageID[i+1:]
+	}
+
+	return ""
+}
+
+// pinImage replaces the tag of image by digest.
+func pinImage(image, digest string) string {
+	name := image
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		name = name[:i]
+	}
+
+	return name + "@" + digest
+}
@@ -0,0 +1,315 @@
+package helpers
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v2"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/klog/v2"
+
+	"github.com/mwlng/k8s_resources_sync/pkg/k8s_resources"
+	"github.com/mwlng/k8s_resources_sync/pkg/utils"
+)
+
+const (
+	// JobModeRecreate deletes an existing job before creating it again.
+	JobModeRecreate = "recreate"
+	// JobModeSuffix creates the job under a new, suffixed name.
+	JobModeSuffix = "suffix"
+
+	jobPollInterval = 2 * time.Second
+	maxJobNameLen   = 63
+)
+
+// JobOptions controls how jobs are applied to the target cluster.
+type JobOptions struct {
+	Mode    string
+	Suffix  string
+	Wait    bool
+	Logs    bool
+	Timeout time.Duration
+}
+
+func LoadJobYamlFiles(rootDir string) []*batchv1.Job {
+	jobs := []*batchv1.Job{}
+	err := filepath.Walk(rootDir, func(path string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !info.IsDir() {
+			ext := strings.ToLower(filepath.Ext(path))
+			if ext == ".yml" || ext == ".yaml" {
+				data, err := ioutil.ReadFile(path)
+				if err != nil {
+					klog.Errorf("Error while reading YAML file. Err was: %s", err)
+					return err
+				}
+
+				decode := scheme.Codecs.UniversalDeserializer().Decode
+				obj, _, err := decode([]byte(data), nil, nil)
+
+				if err != nil {
+					klog.Errorf("Error while decoding YAML file: %s. Err was: %s", path, err)
+					return nil
+				}
+
+				switch obj.(type) {
+				case *batchv1.Job:
+					jobs = append(jobs, obj.(*batchv1.Job))
+				}
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
+		klog.Errorf("Error while reading YAML files. Err was: %s", err)
+	}
+
+	return jobs
+}
+
+func SyncJobs(ctx context.Context, kubeConfig *rest.Config, jobs []*batchv1.Job, images *ImageRewriter, filter *Filter) ([]*batchv1.Job, Results, error) {
+	klog.Infof("Syncing jobs from cluster: %s, namespace: %s\n", kubeConfig.Host, corev1.NamespaceDefault)
+	job, err := k8s_resources.NewJob(kubeConfig, corev1.NamespaceDefault)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	getJob := job.GetJob
+	if len(jobs) >= listThreshold {
+		index, err := job.IndexJobs(ctx)
+		if err != nil {
+			klog.Warningf("Failed to list jobs, falling back to one get per object. Err was: %s", err)
+		} else {
+			getJob = index.GetJob
+		}
+	}
+
+	results := Results{}
+	synced_jobs := []*batchv1.Job{}
+	for _, j := range jobs {
+		if utils.Interrupted(ctx) {
+			results = append(results, skippedResult("Job", corev1.NamespaceDefault, j.Name, reasonInterrupted))
+			continue
+		}
+
+		if !filter.Matches(j) {
+			results = append(results, filteredResult("Job", corev1.NamespaceDefault, j.Name))
+			continue
+		}
+
+		src_job, err := getJob(ctx, j.Name)
+		if err != nil {
+			klog.Errorf("Failed to get job: %s. Err was: %s", j.Name, err)
+			results = append(results, sourceErrorResult("Job", corev1.NamespaceDefault, j.Name, err))
+			continue
+		}
+
+		if src_job != nil {
+			if !filter.Matches(src_job) {
+				results = append(results, filteredResult("Job", corev1.NamespaceDefault, j.Name))
+				continue
+			}
+
+			containerImageMap := map[string]string{}
+			for _, c := range src_job.Spec.Template.Spec.Containers {
+				containerImageMap[c.Name] = c.Image
+			}
+
+			for i, c := range j.Spec.Template.Spec.Containers {
+				j.Spec.Template.Spec.Containers[i].Image = containerImageMap[c.Name]
+			}
+
+			images.RewriteRegistries("Job", corev1.NamespaceDefault, &j.ObjectMeta, &j.Spec.Template.Spec)
+
+			synced_jobs = append(synced_jobs, j)
+		}
+	}
+
+	return synced_jobs, results, nil
+}
+
+func PrintJobs(jobs []*batchv1.Job) {
+	for _, j := range jobs {
+		result, _ := yaml.Marshal(j)
+		fmt.Printf("%s\n", string(result))
+	}
+}
+
+// ApplyJobs runs every job in the target cluster in order, one at a time
+// regardless of the Concurrency of the options of ctx. Since a job's pod
+// template is immutable, existing jobs are either deleted and recreated or
+// the job is created under a suffixed name, depending on opts.Mode. When
+// opts.Wait is set, each job must complete before the next one is started,
+// and an error is returned for the first job that doesn't.
+func ApplyJobs(ctx context.Context, kubeConfig *rest.Config, jobs []*batchv1.Job, opts JobOptions) (Results, error) {
+	job, err := k8s_resources.NewJob(kubeConfig, corev1.NamespaceDefault)
+	if err != nil {
+		return nil, err
+	}
+
+	results := Results{}
+	for _, j := range jobs {
+		if utils.Interrupted(ctx) {
+			results = append(results, skippedResult("Job", corev1.NamespaceDefault, j.Name, reasonInterrupted))
+			continue
+		}
+
+		prepareJob(j)
+
+		var op k8s_resources.Operation
+		if opts.Mode == JobModeSuffix {
+			j.Name = suffixedJobName(j.Name, opts.Suffix)
+			klog.Infof("Creating job: %s ...", j.Name)
+			op, err = job.CreateNewJob(ctx, j)
+		} else {
+			klog.Infof("Recreating job: %s ...", j.Name)
+			op, err = job.ApplyJob(ctx, j, opts.Timeout)
+		}
+		if err != nil {
+			klog.Errorf("Failed to apply job. Err was: %s", err)
+			results = append(results, failedResult("Job", corev1.NamespaceDefault, j.Name, err))
+			continue
+		}
+
+		if opts.Wait && !k8s_resources.IsDryRun(ctx) {
+			klog.Infof("Waiting for job %s to complete ...", j.Name)
+			err := waitForJob(ctx, kubeConfig, job, j.Name, opts)
+			if err != nil {
+				err = fmt.Errorf("job %s did not complete: %s", j.Name, err)
+				results = append(results, failedResult("Job", corev1.NamespaceDefault, j.Name, err))
+				return results, err
+			}
+		}
+		results = append(results, operationResult("Job", corev1.NamespaceDefault, j.Name, op, nil))
+		klog.Infoln("Done.")
+	}
+
+	return results, nil
+}
+
+// prepareJob drops the fields the API server generates for a job, so that a
+// job exported from a cluster can be created again.
+func prepareJob(job *batchv1.Job) {
+	job.ResourceVersion = ""
+	job.UID = ""
+	job.Status = batchv1.JobStatus{}
+
+	if job.Spec.ManualSelector == nil || !*job.Spec.ManualSelector {
+		job.Spec.Selector = nil
+		// Clusters since 1.27 set the batch.kubernetes.io/ labels along
+		// with the legacy ones.
+		for _, label := range []string{"controller-uid", "job-name", "batch.kubernetes.io/controller-uid", "batch.kubernetes.io/job-name"} {
+			delete(job.Spec.Template.Labels, label)
+		}
+	}
+}
+
+func suffixedJobName(name, suffix string) string {
+	suffix = "-" + suffix
+	if len(name)+len(suffix) > maxJobNameLen {
+		name = strings.TrimRight(name[:maxJobNameLen-len(suffix)], "-.")
+	}
+
+	return name + suffix
+}
+
+// waitForJob polls job name until it finishes or opts.Timeout passes. With
+// opts.Logs, the logs of its pods are streamed concurrently, and the streams
+// are cancelled when the wait is over, so that a container which never
+// exits, e.g. a sidecar, doesn't hold the run.
+func waitForJob(ctx context.Context, kubeConfig *rest.Config, job *k8s_resources.Job, name string, opts JobOptions) error {
+	pod, err := k8s_resources.NewPod(kubeConfig, corev1.NamespaceDefault)
+	if err != nil {
+		return err
+	}
+
+	var streamCtx context.Context
+	var cancel context.CancelFunc
+	if opts.Timeout > 0 {
+		streamCtx, cancel = context.WithTimeout(ctx, opts.Timeout)
+	} else {
+		streamCtx, cancel = context.WithCancel(ctx)
+	}
+	var streams sync.WaitGroup
+	defer func() {
+		cancel()
+		streams.Wait()
+	}()
+
+	streamed := map[string]bool{}
+	return k8s_resources.Poll(ctx, jobPollInterval, opts.Timeout, func() (bool, error) {
+		if opts.Logs {
+			pods, err := pod.ListPods(ctx, fmt.Sprintf("job-name=%s", name))
+			if err != nil {
+				return false, err
+			}
+
+			for i := range pods.Items {
+				p := &pods.Items[i]
+				if streamed[p.Name] || p.Status.Phase == corev1.PodPending {
+					continue
+				}
+				streamed[p.Name] = true
+				for _, c := range p.Spec.Containers {
+					streams.Add(1)
+					go func(pod *k8s_resources.Pod, podName, container string) {
+						defer streams.Done()
+						streamPodLogs(streamCtx, pod, podName, container)
+					}(pod, p.Name, c.Name)
+				}
+			}
+		}
+
+		result, err := job.GetJob(ctx, name)
+		if err != nil {
+			return false, err
+		}
+
+		return k8s_resources.JobFinished(result)
+	})
+}
+
+// streamPodLogs copies the logs of a container to stdout until it
+// terminates or ctx is done, prefixing each line with the pod and container
+// since the containers of a job are streamed concurrently.
+func streamPodLogs(ctx context.Context, pod *k8s_resources.Pod, podName, container string) {
+	logs, err := pod.StreamPodLogs(ctx, podName, container)
+	if err != nil {
+		if ctx.Err() == nil {
+			klog.Errorf("Failed to stream logs of pod: %s, container: %s. Err was: %s", podName, container, err)
+		}
+		return
+	}
+	defer logs.Close()
+
+	scanner := bufio.NewScanner(logs)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		logLock.Lock()
+		fmt.Fprintf(os.Stdout, "[%s/%s] %s\n", podName, container, scanner.Text())
+		logLock.Unlock()
+	}
+	if err := scanner.Err(); err != nil && ctx.Err() == nil {
+		klog.Errorf("Failed to stream logs of pod: %s, container: %s. Err was: %s", podName, container, err)
+	}
+}
+
+// logLock keeps the lines of concurrent log streams whole.
+var logLock sync.Mutex
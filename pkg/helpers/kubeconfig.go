@@ -1,10 +1,16 @@
 package helpers
 
 import (
+	"net/url"
+	"strings"
+
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/util/flowcontrol"
 )
 
+// GetKubeConfig loads the given context of the kubeconfig file at
+// configPath. An empty context selects the file's current-context.
 func GetKubeConfig(context, configPath string) (*rest.Config, error) {
 	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
 	loadingRules.ExplicitPath = configPath
@@ -14,3 +20,38 @@ func GetKubeConfig(context, configPath string) (*rest.Config, error) {
 
 	return kubeConfig.ClientConfig()
 }
+
+// SetRateLimit limits the requests of every client built from config to
+// qps, with bursts of up to burst requests. The limiter is shared by all
+// those clients, so the limit holds however many of them run in parallel.
+func SetRateLimit(config *rest.Config, qps float32, burst int) {
+	config.QPS = qps
+	config.Burst = burst
+	config.RateLimiter = flowcontrol.NewTokenBucketRateLimiter(qps, burst)
+}
+
+// SameHost reports whether both configs point at the same API server.
+func SameHost(a, b *rest.Config) bool {
+	return normalizeHost(a.Host) == normalizeHost(b.Host)
+}
+
+func normalizeHost(host string) string {
+	if !strings.Contains(host, "://") {
+		host = "https://" + host
+	}
+
+	u, err := url.Parse(host)
+	if err != nil {
+		return strings.ToLower(host)
+	}
+
+	port := u.Port()
+	if len(port) == 0 {
+		port = "443"
+		if u.Scheme == "http" {
+			port = "80"
+		}
+	}
+
+	return strings.ToLower(u.Hostname()) + ":" + port + strings.TrimSuffix(u.Path, "/")
+}
@@ -0,0 +1,89 @@
+package helpers
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"k8s.io/client-go/rest"
+	"k8s.io/klog/v2"
+
+	"github.com/mwlng/k8s_resources_sync/pkg/backup"
+	"github.com/mwlng/k8s_resources_sync/pkg/k8s_resources"
+	"github.com/mwlng/k8s_resources_sync/pkg/ledger"
+)
+
+// LedgerObjects builds the ledger record of every object in b: the hash of
+// its saved state, the hash of its live state in the target cluster after
+// the run, and its outcome in report.
+func LedgerObjects(ctx context.Context, kubeConfig *rest.Config, b *backup.Backup, report Results) ([]ledger.Object, error) {
+	cluster, err := k8s_resources.ClusterFor(kubeConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	outcomes := map[string]Result{}
+	for _, r := range report {
+		outcomes[r.Kind+"/"+r.Namespace+"/"+r.Name] = r
+	}
+
+	objects := []ledger.Object{}
+	for _, entry := range b.Entries() {
+		object := ledger.Object{
+			APIVersion: entry.APIVersion,
+			Kind:       entry.Kind,
+			Namespace:  entry.Namespace,
+			Name:       entry.Name,
+		}
+
+		if entry.Existed {
+			saved, err := b.Load(entry)
+			if err != nil {
+				return nil, err
+			}
+			object.Before = ledger.Hash(saved)
+		}
+
+		live, err := getEntry(ctx, cluster.DynaClient, entry)
+		if err != nil {
+			klog.Errorf("Failed to get %s for the run ledger. Err was: %s", entry, err)
+		}
+		object.After = ledger.Hash(live)
+
+		if r, ok := outcomes[entry.Kind+"/"+entry.Namespace+"/"+entry.Name]; ok {
+			object.Status = string(r.Status)
+			object.Reason = r.Reason
+		}
+		objects = append(objects, object)
+	}
+
+	return objects, nil
+}
+
+// RollbackRun reverts the changes of run, whose backup is b. Objects that
+// were changed by someone else since the run, or not changed by the run at
+// all, are skipped.
+func RollbackRun(ctx context.Context, kubeConfig *rest.Config, b *backup.Backup, run *ledger.Run) (Results, error) {
+	objects := map[string]ledger.Object{}
+	for _, object := range run.Objects {
+		objects[object.Kind+"/"+object.Namespace+"/"+object.Name] = object
+	}
+
+	return restoreEntries(ctx, kubeConfig, b, func(entry backup.Entry, live *unstructured.Unstructured) string {
+		object, ok := objects[entry.Kind+"/"+entry.Namespace+"/"+entry.Name]
+		if !ok {
+			return fmt.Sprintf("not recorded by run %s", run.ID)
+		}
+
+		if object.Before == object.After {
+			return fmt.Sprintf("not changed by run %s", run.ID)
+		}
+
+		if ledger.Hash(live) != object.After {
+			return fmt.Sprintf("modified since run %s", run.ID)
+		}
+
+		return ""
+	})
+}
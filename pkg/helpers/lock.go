@@ -0,0 +1,244 @@
+package helpers
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/user"
+	"sync"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"k8s.io/client-go/rest"
+	"k8s.io/klog/v2"
+
+	"github.com/mwlng/k8s_resources_sync/pkg/k8s_resources"
+)
+
+const (
+	// LockName is the name of the Lease holding the run lock of a target
+	// cluster.
+	LockName = "k8s-resources-sync"
+
+	lockRunIDAnnotation = "k8s-resources-sync/run-id"
+	lockDuration        = 60 * time.Second
+	lockRenewInterval   = lockDuration / 3
+	lockReleaseTimeout  = 30 * time.Second
+)
+
+// LockHeldError is returned by AcquireLock when another run holds the lock.
+type LockHeldError struct {
+	Holder  string
+	RunID   string
+	Renewed time.Time
+	Expires time.Time
+}
+
+func (e *LockHeldError) Error() string {
+	return fmt.Sprintf("target cluster is locked by %s for run %s, last renewed at %s, expiring at %s",
+		e.Holder, e.RunID, e.Renewed.Format(time.RFC3339), e.Expires.Format(time.RFC3339))
+}
+
+// RunLock is a Lease in the target cluster, held for the duration of a run
+// so that two runs don't change the same cluster at once. It is renewed in
+// the background until released.
+type RunLock struct {
+	lease  *k8s_resources.Lease
+	holder string
+	runID  string
+
+	lock    sync.Mutex
+	current *coordinationv1.Lease
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// LockHolder identifies this process as holder of a lock, by user, host and
+// process ID.
+func LockHolder() string {
+	name := "unknown"
+	if usr, err := user.Current(); err == nil {
+		name = usr.Username
+	}
+
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+
+	return fmt.Sprintf("%s@%s (pid %d)", name, host, os.Getpid())
+}
+
+// AcquireLock takes the run lock in namespace of the target cluster for the
+// run runID. A lock held by another run is refused with a *LockHeldError,
+// unless it has expired or breakLock is set. The returned context is
+// cancelled when the lock is lost while the run is going on.
+func AcquireLock(ctx context.Context, kubeConfig *rest.Config, namespace, runID string, breakLock bool) (*RunLock, context.Context, error) {
+	lease, err := k8s_resources.NewLease(kubeConfig, namespace)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	l := &RunLock{
+		lease:  lease,
+		holder: LockHolder(),
+		runID:  runID,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+
+	current, err := lease.GetLease(ctx, LockName)
+	switch {
+	case apierrors.IsNotFound(err):
+		current, err = lease.CreateLease(ctx, l.take(&coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{Name: LockName, Namespace: namespace},
+		}))
+	case err != nil:
+	default:
+		if held := heldBy(current); held != nil && (held.Holder != l.holder || held.RunID != runID) {
+			if time.Now().Before(held.Expires) && !breakLock {
+				return nil, nil, held
+			}
+			klog.Warningf("Taking over the run lock of %s for run %s", held.Holder, held.RunID)
+		}
+		current, err = lease.UpdateLease(ctx, l.take(current.DeepCopy()))
+	}
+	if apierrors.IsAlreadyExists(err) || apierrors.IsConflict(err) {
+		return nil, nil, fmt.Errorf("another run took the lock at the same time: %s", err)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	l.current = current
+
+	runCtx, cancel := context.WithCancel(ctx)
+	go l.renew(runCtx, cancel)
+
+	return l, runCtx, nil
+}
+
+// Release stops renewing the lock and deletes it, unless it was taken over
+// by another run in the meantime.
+func (l *RunLock) Release() {
+	close(l.stop)
+	<-l.done
+
+	ctx, cancel := context.WithTimeout(context.Background(), lockReleaseTimeout)
+	defer cancel()
+
+	l.lock.Lock()
+	current := l.current
+	l.lock.Unlock()
+
+	// A conflict means the lock was taken over, it isn't ours to delete.
+	err := l.lease.DeleteLease(ctx, LockName, current.ResourceVersion)
+	if err != nil && !apierrors.IsNotFound(err) && !apierrors.IsConflict(err) {
+		klog.Errorf("Failed to release the run lock, it expires at %s. Err was: %s",
+			current.Spec.RenewTime.Add(lockDuration).Format(time.RFC3339), err)
+	}
+}
+
+// take makes lease held by l as of now.
+func (l *RunLock) take(lease *coordinationv1.Lease) *coordinationv1.Lease {
+	now := metav1.NewMicroTime(time.Now())
+	seconds := int32(lockDuration / time.Second)
+
+	if lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity != l.holder {
+		transitions := int32(0)
+		if lease.Spec.LeaseTransitions != nil {
+			transitions = *lease.Spec.LeaseTransitions + 1
+		}
+		lease.Spec.LeaseTransitions = &transitions
+	}
+
+	if lease.Annotations == nil {
+		lease.Annotations = map[string]string{}
+	}
+	lease.Annotations[lockRunIDAnnotation] = l.runID
+	lease.Spec.HolderIdentity = &l.holder
+	lease.Spec.LeaseDurationSeconds = &seconds
+	lease.Spec.AcquireTime = &now
+	lease.Spec.RenewTime = &now
+
+	return lease
+}
+
+// renew renews the lock every lockRenewInterval until it is released. If the
+// lock is taken over, or can't be renewed before it expires, the run is
+// cancelled.
+func (l *RunLock) renew(ctx context.Context, cancel context.CancelFunc) {
+	defer close(l.done)
+
+	ticker := time.NewTicker(lockRenewInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		l.lock.Lock()
+		lease := l.current.DeepCopy()
+		l.lock.Unlock()
+
+		expires := lease.Spec.RenewTime.Add(lockDuration)
+		now := metav1.NewMicroTime(time.Now())
+		lease.Spec.RenewTime = &now
+		updated, err := l.lease.UpdateLease(ctx, lease)
+		if err == nil {
+			l.lock.Lock()
+			l.current = updated
+			l.lock.Unlock()
+			continue
+		}
+
+		if apierrors.IsConflict(err) || apierrors.IsNotFound(err) {
+			reason := "it was deleted"
+			if current, err := l.lease.GetLease(ctx, LockName); err == nil {
+				if held := heldBy(current); held != nil {
+					reason = fmt.Sprintf("it was taken over by %s for run %s", held.Holder, held.RunID)
+				}
+			}
+			klog.Errorf("Lost the run lock, %s. Aborting the run.", reason)
+			cancel()
+			return
+		}
+
+		if time.Now().After(expires) {
+			klog.Errorf("Failed to renew the run lock before it expired. Aborting the run. Err was: %s", err)
+			cancel()
+			return
+		}
+		klog.Warningf("Failed to renew the run lock, retrying. Err was: %s", err)
+	}
+}
+
+// heldBy describes the holder of lease, or returns nil if it isn't held.
+func heldBy(lease *coordinationv1.Lease) *LockHeldError {
+	if lease.Spec.HolderIdentity == nil || len(*lease.Spec.HolderIdentity) == 0 {
+		return nil
+	}
+
+	held := &LockHeldError{
+		Holder: *lease.Spec.HolderIdentity,
+		RunID:  lease.Annotations[lockRunIDAnnotation],
+	}
+	if lease.Spec.RenewTime != nil {
+		held.Renewed = lease.Spec.RenewTime.Time
+	}
+	duration := lockDuration
+	if lease.Spec.LeaseDurationSeconds != nil {
+		duration = time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second
+	}
+	held.Expires = held.Renewed.Add(duration)
+
+	return held
+}
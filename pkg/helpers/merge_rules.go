@@ -0,0 +1,126 @@
+package helpers
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// MergeRule decides which fields of a custom resource are taken from the
+// source cluster. Paths are dot separated, e.g. "spec.dnsNames". Fields
+// listed in Except keep the value of the manifest.
+type MergeRule struct {
+	Group  string   `yaml:"group"`
+	Kind   string   `yaml:"kind"`
+	Copy   []string `yaml:"copy"`
+	Except []string `yaml:"except"`
+}
+
+type MergeRules struct {
+	Rules []MergeRule `yaml:"rules"`
+}
+
+// defaultMergeRule copies the whole spec from the source, like the typed
+// kinds do.
+var defaultMergeRule = MergeRule{Copy: []string{"spec"}}
+
+// LoadMergeRules reads merge rules from a YAML file of the form:
+//
+//	rules:
+//	- group: cert-manager.io
+//	  kind: Certificate
+//	  copy: [spec]
+//	  except: [spec.dnsNames]
+func LoadMergeRules(path string) (*MergeRules, error) {
+	rules := &MergeRules{}
+	if len(path) == 0 {
+		return rules, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	err = yaml.UnmarshalStrict(data, rules)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, rule := range rules.Rules {
+		if len(rule.Kind) == 0 {
+			return nil, fmt.Errorf("merge rule in %s has no kind", path)
+		}
+	}
+
+	return rules, nil
+}
+
+// RuleFor returns the rule matching the group and kind of obj, or the
+// default rule when none does.
+func (m *MergeRules) RuleFor(obj *unstructured.Unstructured) MergeRule {
+	gvk := obj.GroupVersionKind()
+	if m != nil {
+		for _, rule := range m.Rules {
+			if rule.Kind == gvk.Kind && (len(rule.Group) == 0 || rule.Group == gvk.Group) {
+				return rule
+			}
+		}
+	}
+
+	return defaultMergeRule
+}
+
+// Merge copies the fields selected by the rule from src into dst.
+func (r MergeRule) Merge(dst, src *unstructured.Unstructured) error {
+	kept := map[string]interface{}{}
+	for _, path := range r.Except {
+		value, found, err := unstructured.NestedFieldCopy(dst.Object, splitPath(path)...)
+		if err != nil {
+			return err
+		}
+		if found {
+			kept[path] = value
+		}
+	}
+
+	for _, path := range r.Copy {
+		fields := splitPath(path)
+		value, found, err := unstructured.NestedFieldCopy(src.Object, fields...)
+		if err != nil {
+			return err
+		}
+
+		if !found {
+			unstructured.RemoveNestedField(dst.Object, fields...)
+			continue
+		}
+		err = unstructured.SetNestedField(dst.Object, value, fields...)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, path := range r.Except {
+		fields := splitPath(path)
+		value, ok := kept[path]
+		if !ok {
+			unstructured.RemoveNestedField(dst.Object, fields...)
+			continue
+		}
+		err := unstructured.SetNestedField(dst.Object, value, fields...)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func splitPath(path string) []string {
+	return strings.Split(strings.Trim(path, "."), ".")
+}
@@ -0,0 +1,25 @@
+package helpers
+
+import (
+	corev1 "k8s.io/api/core/v1"
+)
+
+// namespaceOf returns the namespace declared in a manifest, falling back
+// to the default namespace when it is empty.
+func namespaceOf(namespace string) string {
+	if len(namespace) == 0 {
+		return corev1.NamespaceDefault
+	}
+
+	return namespace
+}
+
+// mapNamespace translates a source namespace into its target namespace.
+// Namespaces without an entry in namespaceMap are kept as is.
+func mapNamespace(namespaceMap map[string]string, namespace string) string {
+	if target, ok := namespaceMap[namespace]; ok {
+		return target
+	}
+
+	return namespace
+}
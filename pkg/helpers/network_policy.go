@@ -0,0 +1,305 @@
+package helpers
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/klog/v2"
+
+	"github.com/mwlng/k8s_resources_sync/pkg/k8s_resources"
+	"github.com/mwlng/k8s_resources_sync/pkg/utils"
+)
+
+func LoadNetworkPolicyYamlFiles(rootDir string) []*networkingv1.NetworkPolicy {
+	policies := []*networkingv1.NetworkPolicy{}
+	err := filepath.Walk(rootDir, func(path string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !info.IsDir() {
+			ext := strings.ToLower(filepath.Ext(path))
+			if ext == ".yml" || ext == ".yaml" {
+				data, err := ioutil.ReadFile(path)
+				if err != nil {
+					klog.Errorf("Error while reading YAML file. Err was: %s", err)
+					return err
+				}
+
+				decode := scheme.Codecs.UniversalDeserializer().Decode
+				obj, _, err := decode([]byte(data), nil, nil)
+
+				if err != nil {
+					klog.Errorf("Error while decoding YAML file: %s. Err was: %s", path, err)
+					return nil
+				}
+
+				switch obj.(type) {
+				case *networkingv1.NetworkPolicy:
+					policies = append(policies, obj.(*networkingv1.NetworkPolicy))
+				}
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
+		klog.Errorf("Error while reading YAML files. Err was: %s", err)
+	}
+
+	return policies
+}
+
+// SyncNetworkPolicies copies the spec of each network policy from the source
+// cluster, rewrites its ipBlock CIDRs with cidrTranslator and moves it to its
+// target namespace according to namespaceMap.
+func SyncNetworkPolicies(ctx context.Context, kubeConfig *rest.Config, policies []*networkingv1.NetworkPolicy,
+	namespaceMap map[string]string, cidrTranslator *CIDRTranslator, filter *Filter) ([]*networkingv1.NetworkPolicy, Results, error) {
+	klog.Infof("Syncing network policies from cluster: %s\n", kubeConfig.Host)
+	policyGetters := map[string]func(context.Context, string) (*networkingv1.NetworkPolicy, error){}
+	counts := map[string]int{}
+	for _, policy := range policies {
+		counts[namespaceOf(policy.Namespace)]++
+	}
+
+	results := Results{}
+	synced_policies := []*networkingv1.NetworkPolicy{}
+	for _, policy := range policies {
+		if utils.Interrupted(ctx) {
+			results = append(results, skippedResult("NetworkPolicy", namespaceOf(policy.Namespace), policy.Name, reasonInterrupted))
+			continue
+		}
+
+		if !filter.Matches(policy) {
+			results = append(results, filteredResult("NetworkPolicy", namespaceOf(policy.Namespace), policy.Name))
+			continue
+		}
+
+		namespace := namespaceOf(policy.Namespace)
+		if _, ok := policyGetters[namespace]; !ok {
+			np, err := k8s_resources.NewNetworkPolicy(kubeConfig, namespace)
+			if err != nil {
+				results = append(results, failedResult("NetworkPolicy", namespace, policy.Name, err))
+				continue
+			}
+			policyGetters[namespace] = np.GetNetworkPolicy
+			if counts[namespace] >= listThreshold {
+				index, err := np.IndexNetworkPolicies(ctx)
+				if err != nil {
+					klog.Warningf("Failed to list network policies in %s, falling back to one get per object. Err was: %s", namespace, err)
+				} else {
+					policyGetters[namespace] = index.GetNetworkPolicy
+				}
+			}
+		}
+
+		src_policy, err := policyGetters[namespace](ctx, policy.Name)
+		if err != nil {
+			klog.Errorf("Failed to get network policy: %s/%s. Err was: %s", namespace, policy.Name, err)
+			results = append(results, sourceErrorResult("NetworkPolicy", namespace, policy.Name, err))
+			continue
+		}
+
+		if src_policy != nil {
+			if !filter.Matches(src_policy) {
+				results = append(results, filteredResult("NetworkPolicy", namespaceOf(policy.Namespace), policy.Name))
+				continue
+			}
+
+			policy.Spec = *src_policy.Spec.DeepCopy()
+			for i := range policy.Spec.Ingress {
+				translatePeers(cidrTranslator, policy, policy.Spec.Ingress[i].From)
+			}
+			for i := range policy.Spec.Egress {
+				translatePeers(cidrTranslator, policy, policy.Spec.Egress[i].To)
+			}
+			policy.Namespace = mapNamespace(namespaceMap, namespace)
+
+			synced_policies = append(synced_policies, policy)
+		}
+	}
+
+	return synced_policies, results, nil
+}
+
+func translatePeers(cidrTranslator *CIDRTranslator, policy *networkingv1.NetworkPolicy, peers []networkingv1.NetworkPolicyPeer) {
+	translate := func(cidr string) string {
+		translated, changed, err := cidrTranslator.Translate(cidr)
+		if err != nil {
+			klog.Warningf("Network policy %s/%s has an invalid CIDR: %s. Err was: %s", policy.Namespace, policy.Name, cidr, err)
+		} else if changed {
+			klog.Infof("Network policy %s/%s: translated CIDR %s to %s", policy.Namespace, policy.Name, cidr, translated)
+		}
+		return translated
+	}
+
+	for _, peer := range peers {
+		if peer.IPBlock == nil {
+			continue
+		}
+
+		peer.IPBlock.CIDR = translate(peer.IPBlock.CIDR)
+		for i, except := range peer.IPBlock.Except {
+			peer.IPBlock.Except[i] = translate(except)
+		}
+	}
+}
+
+// CheckNetworkPolicySelectors warns about network policies whose pod or
+// namespace selectors don't match anything in the target cluster, which
+// usually means the policy would silently block or allow nothing.
+func CheckNetworkPolicySelectors(ctx context.Context, kubeConfig *rest.Config, policies []*networkingv1.NetworkPolicy) error {
+	namespace, err := k8s_resources.NewNamespace(kubeConfig)
+	if err != nil {
+		return err
+	}
+
+	podClients := map[string]*k8s_resources.Pod{}
+	countPods := func(namespace string, selector *metav1.LabelSelector) (int, error) {
+		if _, ok := podClients[namespace]; !ok {
+			p, err := k8s_resources.NewPod(kubeConfig, namespace)
+			if err != nil {
+				return 0, err
+			}
+			podClients[namespace] = p
+		}
+
+		labelSelector, err := metav1.LabelSelectorAsSelector(selector)
+		if err != nil {
+			return 0, err
+		}
+
+		pods, err := podClients[namespace].ListPods(ctx, labelSelector.String())
+		if err != nil {
+			return 0, err
+		}
+		return len(pods.Items), nil
+	}
+
+	selectNamespaces := func(selector *metav1.LabelSelector) ([]string, error) {
+		labelSelector, err := metav1.LabelSelectorAsSelector(selector)
+		if err != nil {
+			return nil, err
+		}
+
+		list, err := namespace.ListNamespaces(ctx, labelSelector.String())
+		if err != nil {
+			return nil, err
+		}
+
+		names := []string{}
+		for _, ns := range list.Items {
+			names = append(names, ns.Name)
+		}
+		return names, nil
+	}
+
+	for _, policy := range policies {
+		policyNamespace := namespaceOf(policy.Namespace)
+		policyName := fmt.Sprintf("%s/%s", policyNamespace, policy.Name)
+
+		count, err := countPods(policyNamespace, &policy.Spec.PodSelector)
+		if err != nil {
+			klog.Errorf("Failed to check pod selector of network policy: %s. Err was: %s", policyName, err)
+		} else if count == 0 {
+			klog.Warningf("Network policy %s: podSelector %s matches no pods in the target cluster",
+				policyName, metav1.FormatLabelSelector(&policy.Spec.PodSelector))
+		}
+
+		peers := []networkingv1.NetworkPolicyPeer{}
+		for _, rule := range policy.Spec.Ingress {
+			peers = append(peers, rule.From...)
+		}
+		for _, rule := range policy.Spec.Egress {
+			peers = append(peers, rule.To...)
+		}
+
+		for _, peer := range peers {
+			namespaces := []string{policyNamespace}
+			if peer.NamespaceSelector != nil {
+				namespaces, err = selectNamespaces(peer.NamespaceSelector)
+				if err != nil {
+					klog.Errorf("Failed to check namespace selector of network policy: %s. Err was: %s", policyName, err)
+					continue
+				}
+				if len(namespaces) == 0 {
+					klog.Warningf("Network policy %s: namespaceSelector %s matches no namespaces in the target cluster",
+						policyName, metav1.FormatLabelSelector(peer.NamespaceSelector))
+					continue
+				}
+			}
+
+			if peer.PodSelector == nil {
+				continue
+			}
+
+			total := 0
+			for _, ns := range namespaces {
+				count, err := countPods(ns, peer.PodSelector)
+				if err != nil {
+					klog.Errorf("Failed to check pod selector of network policy: %s. Err was: %s", policyName, err)
+					break
+				}
+				total += count
+			}
+			if total == 0 {
+				klog.Warningf("Network policy %s: peer podSelector %s matches no pods in the target cluster",
+					policyName, metav1.FormatLabelSelector(peer.PodSelector))
+			}
+		}
+	}
+
+	return nil
+}
+
+func PrintNetworkPolicies(policies []*networkingv1.NetworkPolicy) {
+	for _, policy := range policies {
+		result, _ := yaml.Marshal(policy)
+		fmt.Printf("%s\n", string(result))
+	}
+}
+
+func ApplyNetworkPolicies(ctx context.Context, kubeConfig *rest.Config, policies []*networkingv1.NetworkPolicy) (Results, error) {
+	policyClients := map[string]*k8s_resources.NetworkPolicy{}
+	for _, policy := range policies {
+		namespace := namespaceOf(policy.Namespace)
+		if _, ok := policyClients[namespace]; !ok {
+			np, err := k8s_resources.NewNetworkPolicy(kubeConfig, namespace)
+			if err != nil {
+				return nil, err
+			}
+			policyClients[namespace] = np
+		}
+	}
+
+	results := applyEach(ctx, len(policies), func(i int) Result {
+		policy := policies[i]
+		if utils.Interrupted(ctx) {
+			return skippedResult("NetworkPolicy", namespaceOf(policy.Namespace), policy.Name, reasonInterrupted)
+		}
+
+		namespace := namespaceOf(policy.Namespace)
+		klog.Infof("Applying network policy: %s/%s ...", namespace, policy.Name)
+		op, err := policyClients[namespace].ApplyNetworkPolicy(ctx, policy)
+		if err != nil {
+			klog.Errorf("Failed to apply network policy. Err was: %s", err)
+			return operationResult("NetworkPolicy", namespace, policy.Name, op, err)
+		}
+		klog.Infoln("Done.")
+
+		return operationResult("NetworkPolicy", namespace, policy.Name, op, nil)
+	})
+
+	return results, nil
+}
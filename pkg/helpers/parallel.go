@@ -0,0 +1,43 @@
+package helpers
+
+import (
+	"context"
+	"sync"
+
+	"github.com/mwlng/k8s_resources_sync/pkg/k8s_resources"
+)
+
+// applyEach calls apply for every index in [0, n) on as many workers as the
+// Concurrency of the options of ctx. The results are returned in index order,
+// so the report doesn't depend on the scheduling of the workers.
+func applyEach(ctx context.Context, n int, apply func(i int) Result) Results {
+	results := make(Results, n)
+
+	workers := k8s_resources.OptionsFrom(ctx).Concurrency
+	if workers > n {
+		workers = n
+	}
+	if workers < 1 {
+		workers = 1
+	}
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				results[i] = apply(i)
+			}
+		}()
+	}
+
+	for i := 0; i < n; i++ {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	return results
+}
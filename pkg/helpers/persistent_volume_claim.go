@@ -0,0 +1,220 @@
+package helpers
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/klog/v2"
+
+	"github.com/mwlng/k8s_resources_sync/pkg/k8s_resources"
+	"github.com/mwlng/k8s_resources_sync/pkg/utils"
+)
+
+// boundClaimAnnotations are set by the PV controller and the scheduler when a
+// claim gets bound, they must not be carried over to a new cluster.
+var boundClaimAnnotations = []string{
+	"pv.kubernetes.io/bind-completed",
+	"pv.kubernetes.io/bound-by-controller",
+	"volume.beta.kubernetes.io/storage-provisioner",
+	"volume.kubernetes.io/storage-provisioner",
+	"volume.kubernetes.io/selected-node",
+}
+
+func LoadPersistentVolumeClaimYamlFiles(rootDir string) []*corev1.PersistentVolumeClaim {
+	claims := []*corev1.PersistentVolumeClaim{}
+	err := filepath.Walk(rootDir, func(path string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !info.IsDir() {
+			ext := strings.ToLower(filepath.Ext(path))
+			if ext == ".yml" || ext == ".yaml" {
+				data, err := ioutil.ReadFile(path)
+				if err != nil {
+					klog.Errorf("Error while reading YAML file. Err was: %s", err)
+					return err
+				}
+
+				decode := scheme.Codecs.UniversalDeserializer().Decode
+				obj, _, err := decode([]byte(data), nil, nil)
+
+				if err != nil {
+					klog.Errorf("Error while decoding YAML file: %s. Err was: %s", path, err)
+					return nil
+				}
+
+				switch obj.(type) {
+				case *corev1.PersistentVolumeClaim:
+					claims = append(claims, obj.(*corev1.PersistentVolumeClaim))
+				}
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
+		klog.Errorf("Error while reading YAML files. Err was: %s", err)
+	}
+
+	return claims
+}
+
+// SyncPersistentVolumeClaims copies the storage request, access modes and
+// volume mode of each claim from the source cluster. The storage class is
+// translated with storageClassMap, the fields binding the claim to a volume
+// of the source cluster are stripped and the claim is moved to its target
+// namespace according to namespaceMap. The source claims of the synced
+// claims are returned along with them.
+func SyncPersistentVolumeClaims(ctx context.Context, kubeConfig *rest.Config, claims []*corev1.PersistentVolumeClaim,
+	namespaceMap, storageClassMap map[string]string, filter *Filter) ([]*corev1.PersistentVolumeClaim, ClaimSources, Results, error) {
+	klog.Infof("Syncing persistent volume claims from cluster: %s\n", kubeConfig.Host)
+	claimGetters := map[string]func(context.Context, string) (*corev1.PersistentVolumeClaim, error){}
+	counts := map[string]int{}
+	for _, claim := range claims {
+		counts[namespaceOf(claim.Namespace)]++
+	}
+
+	results := Results{}
+	synced_claims := []*corev1.PersistentVolumeClaim{}
+	sources := ClaimSources{}
+	for _, claim := range claims {
+		if utils.Interrupted(ctx) {
+			results = append(results, skippedResult("PersistentVolumeClaim", namespaceOf(claim.Namespace), claim.Name, reasonInterrupted))
+			continue
+		}
+
+		if !filter.Matches(claim) {
+			results = append(results, filteredResult("PersistentVolumeClaim", namespaceOf(claim.Namespace), claim.Name))
+			continue
+		}
+
+		namespace := namespaceOf(claim.Namespace)
+		if _, ok := claimGetters[namespace]; !ok {
+			p, err := k8s_resources.NewPersistentVolumeClaim(kubeConfig, namespace)
+			if err != nil {
+				results = append(results, failedResult("PersistentVolumeClaim", namespace, claim.Name, err))
+				continue
+			}
+			claimGetters[namespace] = p.GetPersistentVolumeClaim
+			if counts[namespace] >= listThreshold {
+				index, err := p.IndexPersistentVolumeClaims(ctx)
+				if err != nil {
+					klog.Warningf("Failed to list persistent volume claims in %s, falling back to one get per object. Err was: %s", namespace, err)
+				} else {
+					claimGetters[namespace] = index.GetPersistentVolumeClaim
+				}
+			}
+		}
+
+		src_claim, err := claimGetters[namespace](ctx, claim.Name)
+		if err != nil {
+			klog.Errorf("Failed to get persistent volume claim: %s/%s. Err was: %s", namespace, claim.Name, err)
+			results = append(results, sourceErrorResult("PersistentVolumeClaim", namespace, claim.Name, err))
+			continue
+		}
+
+		if src_claim != nil {
+			if !filter.Matches(src_claim) {
+				results = append(results, filteredResult("PersistentVolumeClaim", namespaceOf(claim.Namespace), claim.Name))
+				continue
+			}
+
+			claim.Spec.AccessModes = src_claim.Spec.AccessModes
+			claim.Spec.Resources = src_claim.Spec.Resources
+			claim.Spec.VolumeMode = src_claim.Spec.VolumeMode
+			claim.Spec.StorageClassName = src_claim.Spec.StorageClassName
+			if claim.Spec.StorageClassName != nil {
+				storageClassName := *claim.Spec.StorageClassName
+				if target, ok := storageClassMap[storageClassName]; ok {
+					storageClassName = target
+				}
+				claim.Spec.StorageClassName = &storageClassName
+			}
+
+			claim.Spec.VolumeName = ""
+			claim.Status = corev1.PersistentVolumeClaimStatus{}
+			claim.ResourceVersion = ""
+			claim.UID = ""
+			annotations := claim.GetAnnotations()
+			for _, annotation := range boundClaimAnnotations {
+				delete(annotations, annotation)
+			}
+			claim.SetAnnotations(annotations)
+			claim.Namespace = mapNamespace(namespaceMap, namespace)
+
+			synced_claims = append(synced_claims, claim)
+			sources[claimKey(claim)] = src_claim
+		}
+	}
+
+	return synced_claims, sources, results, nil
+}
+
+// ClaimSources maps the synced claims, by target namespace and name, to
+// their claims in the source cluster.
+type ClaimSources map[string]*corev1.PersistentVolumeClaim
+
+func claimKey(claim *corev1.PersistentVolumeClaim) string {
+	return namespaceOf(claim.Namespace) + "/" + claim.Name
+}
+
+func PrintPersistentVolumeClaims(claims []*corev1.PersistentVolumeClaim) {
+	for _, claim := range claims {
+		result, _ := yaml.Marshal(claim)
+		fmt.Printf("%s\n", string(result))
+	}
+}
+
+// ApplyPersistentVolumeClaims applies the claims to the target cluster and
+// returns the ones that didn't exist before, which need their data copied.
+func ApplyPersistentVolumeClaims(ctx context.Context, kubeConfig *rest.Config, claims []*corev1.PersistentVolumeClaim) ([]*corev1.PersistentVolumeClaim, Results, error) {
+	claimClients := map[string]*k8s_resources.PersistentVolumeClaim{}
+	for _, claim := range claims {
+		namespace := namespaceOf(claim.Namespace)
+		if _, ok := claimClients[namespace]; !ok {
+			p, err := k8s_resources.NewPersistentVolumeClaim(kubeConfig, namespace)
+			if err != nil {
+				return nil, nil, err
+			}
+			claimClients[namespace] = p
+		}
+	}
+
+	results := applyEach(ctx, len(claims), func(i int) Result {
+		claim := claims[i]
+		if utils.Interrupted(ctx) {
+			return skippedResult("PersistentVolumeClaim", namespaceOf(claim.Namespace), claim.Name, reasonInterrupted)
+		}
+
+		namespace := namespaceOf(claim.Namespace)
+		klog.Infof("Applying persistent volume claim: %s/%s ...", namespace, claim.Name)
+		op, err := claimClients[namespace].ApplyPersistentVolumeClaim(ctx, claim)
+		if err != nil {
+			klog.Errorf("Failed to apply persistent volume claim. Err was: %s", err)
+			return operationResult("PersistentVolumeClaim", namespace, claim.Name, op, err)
+		}
+		klog.Infoln("Done.")
+
+		return operationResult("PersistentVolumeClaim", namespace, claim.Name, op, nil)
+	})
+
+	created_claims := []*corev1.PersistentVolumeClaim{}
+	for i, result := range results {
+		if result.Status == ResultCreated {
+			created_claims = append(created_claims, claims[i])
+		}
+	}
+
+	return created_claims, results, nil
+}
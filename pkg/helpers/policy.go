@@ -0,0 +1,246 @@
+package helpers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/klog/v2"
+
+	"github.com/mwlng/k8s_resources_sync/pkg/dyna_client"
+	"github.com/mwlng/k8s_resources_sync/pkg/k8s_resources"
+)
+
+const (
+	// PolicyModeFail fails the plan of a run that would change a protected
+	// object, before anything is applied.
+	PolicyModeFail = "fail"
+	// PolicyModeSkip leaves protected objects alone with a warning, and
+	// syncs everything else.
+	PolicyModeSkip = "skip"
+)
+
+// PolicyRule protects the objects matching all of its fields. Namespace and
+// Name are globs, or regular expressions when written as /regexp/, and
+// Selector is a label selector matched against the labels of both the
+// manifest and the live object.
+type PolicyRule struct {
+	Group     string `yaml:"group"`
+	Kind      string `yaml:"kind"`
+	Namespace string `yaml:"namespace"`
+	Name      string `yaml:"name"`
+	Selector  string `yaml:"selector"`
+
+	namespace *namePattern
+	name      *namePattern
+	selector  labels.Selector
+}
+
+func (r PolicyRule) String() string {
+	fields := []string{}
+	for _, field := range []struct{ key, value string }{
+		{"group", r.Group}, {"kind", r.Kind}, {"namespace", r.Namespace}, {"name", r.Name}, {"selector", r.Selector},
+	} {
+		if len(field.value) > 0 {
+			fields = append(fields, field.key+"="+field.value)
+		}
+	}
+
+	return strings.Join(fields, ",")
+}
+
+func (r *PolicyRule) compile() error {
+	if len(r.Group) == 0 && len(r.Kind) == 0 && len(r.Namespace) == 0 && len(r.Name) == 0 && len(r.Selector) == 0 {
+		return fmt.Errorf("policy rule matches every object")
+	}
+
+	if len(r.Namespace) > 0 {
+		p, err := newNamePattern(r.Namespace)
+		if err != nil {
+			return err
+		}
+		r.namespace = &p
+	}
+
+	if len(r.Name) > 0 {
+		p, err := newNamePattern(r.Name)
+		if err != nil {
+			return err
+		}
+		r.name = &p
+	}
+
+	if len(r.Selector) > 0 {
+		s, err := labels.Parse(r.Selector)
+		if err != nil {
+			return fmt.Errorf("invalid selector: %s", err)
+		}
+		r.selector = s
+	}
+
+	return nil
+}
+
+func (r *PolicyRule) matches(gvk schema.GroupVersionKind, namespace, name string, labelSets []map[string]string) bool {
+	if len(r.Group) > 0 && r.Group != gvk.Group {
+		return false
+	}
+	if len(r.Kind) > 0 && r.Kind != gvk.Kind {
+		return false
+	}
+	if r.namespace != nil && !r.namespace.match(namespace) {
+		return false
+	}
+	if r.name != nil && !r.name.match(name) {
+		return false
+	}
+	if r.selector == nil {
+		return true
+	}
+
+	for _, set := range labelSets {
+		if r.selector.Matches(labels.Set(set)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Policy is a deny-list of objects that must never be created, updated or
+// deleted by a run. It implements k8s_resources.Guard.
+type Policy struct {
+	Mode      string       `yaml:"mode"`
+	Protected []PolicyRule `yaml:"protected"`
+}
+
+// DefaultPolicy is used when no policy file is given. It protects the
+// system components of a cluster, e.g. the aws-auth ConfigMap and the
+// coredns Service, which live in kube-system.
+var DefaultPolicy = Policy{
+	Mode: PolicyModeSkip,
+	Protected: []PolicyRule{
+		{Namespace: "kube-system"},
+		{Group: "rbac.authorization.k8s.io", Kind: "ClusterRole", Name: "system:*"},
+		{Group: "rbac.authorization.k8s.io", Kind: "ClusterRoleBinding", Name: "system:*"},
+	},
+}
+
+// PolicyViolation is the error refusing a change to a protected object.
+type PolicyViolation struct {
+	Rule PolicyRule
+	Skip bool
+}
+
+func (v *PolicyViolation) Error() string {
+	return fmt.Sprintf("protected by policy rule %s", v.Rule)
+}
+
+// LoadPolicy reads a policy from a YAML file of the form:
+//
+//	mode: fail
+//	protected:
+//	- kind: ConfigMap
+//	  namespace: kube-system
+//	  name: aws-auth
+//	- namespace: kube-system
+//	- selector: sync.example.com/protected=true
+//
+// The mode defaults to skip, like the mode of DefaultPolicy, which an empty
+// path returns.
+func LoadPolicy(path string) (*Policy, error) {
+	policy := &Policy{}
+	if len(path) == 0 {
+		*policy = DefaultPolicy
+		policy.Protected = append([]PolicyRule{}, DefaultPolicy.Protected...)
+	} else {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		err = yaml.UnmarshalStrict(data, policy)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(policy.Mode) == 0 {
+		policy.Mode = PolicyModeSkip
+	}
+	if policy.Mode != PolicyModeFail && policy.Mode != PolicyModeSkip {
+		return nil, fmt.Errorf("invalid policy mode: %s, expected %s or %s", policy.Mode, PolicyModeFail, PolicyModeSkip)
+	}
+
+	for i := range policy.Protected {
+		if err := policy.Protected[i].compile(); err != nil {
+			return nil, fmt.Errorf("policy rule %d: %s", i+1, err)
+		}
+	}
+
+	return policy, nil
+}
+
+// Admit refuses the change of an object matching any of the protected rules
+// with a *PolicyViolation.
+func (p *Policy) Admit(gvk schema.GroupVersionKind, namespace, name string, labelSets ...map[string]string) error {
+	for _, rule := range p.Protected {
+		if !rule.matches(gvk, namespace, name, labelSets) {
+			continue
+		}
+
+		violation := &PolicyViolation{Rule: rule, Skip: p.Mode == PolicyModeSkip}
+		if violation.Skip {
+			object := name
+			if len(namespace) > 0 {
+				object = namespace + "/" + name
+			}
+			klog.Warningf("Skipping %s %s: %s", gvk.Kind, object, violation)
+		}
+		return violation
+	}
+
+	return nil
+}
+
+// policyResult reports an object whose change was refused by a policy: as
+// skipped if the policy skips protected objects, or denied.
+func policyResult(kind, namespace, name string, err error) (Result, bool) {
+	var violation *PolicyViolation
+	if !errors.As(err, &violation) {
+		return Result{}, false
+	}
+
+	if violation.Skip {
+		return skippedResult(kind, namespace, name, violation.Error()), true
+	}
+	return Result{Kind: kind, Namespace: namespace, Name: name, Status: ResultDenied, Reason: violation.Error()}, true
+}
+
+// admitUnstructured asks k8s_resources.Admit whether obj may be changed,
+// with the labels of obj and of its live state.
+func admitUnstructured(ctx context.Context, dynaClient *dyna_client.DynaClient, obj *unstructured.Unstructured) error {
+	if k8s_resources.OptionsFrom(ctx).Guards == nil {
+		return nil
+	}
+
+	labelSets := []map[string]string{obj.GetLabels()}
+	current, err := dynaClient.Get(ctx, obj)
+	switch {
+	case err == nil:
+		labelSets = append(labelSets, current.GetLabels())
+	case !apierrors.IsNotFound(err) && !meta.IsNoMatchError(err):
+		return err
+	}
+
+	return k8s_resources.Admit(ctx, obj.GroupVersionKind(), obj.GetNamespace(), obj.GetName(), labelSets...)
+}
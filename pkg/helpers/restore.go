@@ -0,0 +1,186 @@
+package helpers
+
+import (
+	"context"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"k8s.io/client-go/rest"
+	"k8s.io/klog/v2"
+
+	"github.com/mwlng/k8s_resources_sync/pkg/backup"
+	"github.com/mwlng/k8s_resources_sync/pkg/dyna_client"
+	"github.com/mwlng/k8s_resources_sync/pkg/k8s_resources"
+	"github.com/mwlng/k8s_resources_sync/pkg/utils"
+)
+
+// restoreJobTimeout is how long a restore waits for a job to be deleted
+// before recreating it.
+const restoreJobTimeout = 5 * time.Minute
+
+// RestoreBackup puts every object touched by the run of b back to the state
+// it had before: objects the run created are deleted, and the others are
+// updated, or recreated, from their saved state. Objects are restored in
+// the reverse order they were touched.
+func RestoreBackup(ctx context.Context, kubeConfig *rest.Config, b *backup.Backup) (Results, error) {
+	return restoreEntries(ctx, kubeConfig, b, nil)
+}
+
+// restoreEntries restores the entries of b in reverse order. check, if not
+// nil, is called with the live state of each entry, nil if it is gone, and
+// returns why the entry must be skipped, or an empty string.
+func restoreEntries(ctx context.Context, kubeConfig *rest.Config, b *backup.Backup,
+	check func(entry backup.Entry, live *unstructured.Unstructured) string) (Results, error) {
+	cluster, err := k8s_resources.ClusterFor(kubeConfig)
+	if err != nil {
+		return nil, err
+	}
+	dynaClient := cluster.DynaClient
+
+	entries := b.Entries()
+	results := Results{}
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := entries[i]
+		if utils.Interrupted(ctx) {
+			results = append(results, skippedResult(entry.Kind, entry.Namespace, entry.Name, reasonInterrupted))
+			continue
+		}
+
+		if check != nil {
+			live, err := getEntry(ctx, dynaClient, entry)
+			if err != nil {
+				klog.Errorf("Failed to get %s. Err was: %s", entry, err)
+				results = append(results, failedResult(entry.Kind, entry.Namespace, entry.Name, err))
+				continue
+			}
+
+			if reason := check(entry, live); len(reason) > 0 {
+				klog.Warningf("Skipping %s: %s", entry, reason)
+				results = append(results, skippedResult(entry.Kind, entry.Namespace, entry.Name, reason))
+				continue
+			}
+		}
+
+		if !entry.Existed {
+			obj := entryObject(entry)
+			err := admitUnstructured(ctx, dynaClient, obj)
+			if err != nil {
+				klog.Errorf("Failed to delete %s. Err was: %s", entry, err)
+				results = append(results, failedResult(entry.Kind, entry.Namespace, entry.Name, err))
+				continue
+			}
+
+			klog.Infof("Deleting %s created by the run ...", entry)
+			err = k8s_resources.Retry(ctx, entry.String(), func() error {
+				return dynaClient.Delete(ctx, obj)
+			})
+			if apierrors.IsNotFound(err) {
+				results = append(results, skippedResult(entry.Kind, entry.Namespace, entry.Name, "already deleted"))
+				continue
+			}
+			if err != nil {
+				klog.Errorf("Failed to delete %s. Err was: %s", entry, err)
+				results = append(results, failedResult(entry.Kind, entry.Namespace, entry.Name, err))
+				continue
+			}
+			results = append(results, Result{Kind: entry.Kind, Namespace: entry.Namespace, Name: entry.Name, Status: ResultDeleted})
+			klog.Infoln("Done.")
+			continue
+		}
+
+		obj, err := b.Load(entry)
+		if err != nil {
+			klog.Errorf("Failed to load %s from the backup. Err was: %s", entry, err)
+			results = append(results, failedResult(entry.Kind, entry.Namespace, entry.Name, err))
+			continue
+		}
+
+		klog.Infof("Restoring %s ...", entry)
+		op, err := restoreObject(ctx, kubeConfig, dynaClient, obj)
+		results = append(results, operationResult(entry.Kind, entry.Namespace, entry.Name, op, err))
+		if err != nil {
+			klog.Errorf("Failed to restore %s. Err was: %s", entry, err)
+			continue
+		}
+		klog.Infoln("Done.")
+	}
+
+	return results, nil
+}
+
+// restoreObject replaces the live object with its saved state, creating it
+// if it is gone.
+func restoreObject(ctx context.Context, kubeConfig *rest.Config, dynaClient *dyna_client.DynaClient, obj *unstructured.Unstructured) (k8s_resources.Operation, error) {
+	prepareUnstructured(obj)
+
+	// The pod template of a job is immutable, so a job is restored by
+	// recreating it.
+	if obj.GroupVersionKind().GroupKind() == batchv1.SchemeGroupVersion.WithKind("Job").GroupKind() {
+		job := &batchv1.Job{}
+		err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, job)
+		if err != nil {
+			return "", err
+		}
+		prepareJob(job)
+
+		j, err := k8s_resources.NewJob(kubeConfig, namespaceOf(job.Namespace))
+		if err != nil {
+			return "", err
+		}
+		return j.ApplyJob(ctx, job, restoreJobTimeout)
+	}
+
+	err := admitUnstructured(ctx, dynaClient, obj)
+	if err != nil {
+		return "", err
+	}
+
+	var op k8s_resources.Operation
+	err = k8s_resources.Retry(ctx, obj.GetKind()+" "+obj.GetName(), func() error {
+		current, err := dynaClient.Get(ctx, obj)
+		if apierrors.IsNotFound(err) {
+			obj.SetResourceVersion("")
+			op = k8s_resources.OperationCreated
+			return dynaClient.Create(ctx, obj)
+		}
+		if err != nil {
+			return err
+		}
+
+		obj.SetResourceVersion(current.GetResourceVersion())
+		op = k8s_resources.OperationUpdated
+		return dynaClient.Update(ctx, obj)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return op, nil
+}
+
+func entryObject(entry backup.Entry) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(entry.GroupVersionKind())
+	obj.SetNamespace(entry.Namespace)
+	obj.SetName(entry.Name)
+
+	return obj
+}
+
+// getEntry returns the live state of the object of entry, or nil if it
+// doesn't exist.
+func getEntry(ctx context.Context, dynaClient *dyna_client.DynaClient, entry backup.Entry) (*unstructured.Unstructured, error) {
+	live, err := dynaClient.Get(ctx, entryObject(entry))
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return live, nil
+}
@@ -0,0 +1,226 @@
+package helpers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/mwlng/k8s_resources_sync/pkg/k8s_resources"
+)
+
+// ResultStatus is the outcome of syncing a single object.
+type ResultStatus string
+
+const (
+	// ResultApplied means the object was server-side applied, so whether it
+	// was created or updated isn't known.
+	ResultApplied ResultStatus = "applied"
+	ResultCreated ResultStatus = "created"
+	ResultUpdated ResultStatus = "updated"
+	// ResultDeleted means a restore deleted an object created by a run.
+	ResultDeleted ResultStatus = "deleted"
+	ResultSkipped ResultStatus = "skipped"
+	// ResultMissing means the object of a manifest doesn't exist in the
+	// source cluster, so there was nothing to sync.
+	ResultMissing ResultStatus = "missing"
+	// ResultFiltered means the object was left out by the Filter of the run.
+	ResultFiltered ResultStatus = "filtered"
+	ResultFailed   ResultStatus = "failed"
+	// ResultDenied means the change of a protected object was refused by
+	// the Policy of the run. It counts as a failure.
+	ResultDenied ResultStatus = "denied"
+)
+
+// reasonInterrupted is reported for the objects left untouched when a run is
+// interrupted.
+const reasonInterrupted = "interrupted"
+
+// reasonDeclined is reported for the objects the operator chose not to
+// change.
+const reasonDeclined = "declined"
+
+// Result records what happened to a single object during a sync.
+type Result struct {
+	Kind      string
+	Namespace string
+	Name      string
+	Status    ResultStatus
+	Reason    string
+}
+
+func (r Result) String() string {
+	name := r.Name
+	if len(r.Namespace) > 0 {
+		name = r.Namespace + "/" + r.Name
+	}
+
+	if len(r.Reason) > 0 {
+		return fmt.Sprintf("%s %s: %s (%s)", r.Kind, name, r.Status, r.Reason)
+	}
+	return fmt.Sprintf("%s %s: %s", r.Kind, name, r.Status)
+}
+
+// Results is the per-object report of a sync run.
+type Results []Result
+
+func (rs Results) Count(status ResultStatus) int {
+	count := 0
+	for _, r := range rs {
+		if r.Status == status {
+			count++
+		}
+	}
+
+	return count
+}
+
+func (rs Results) Failed() bool {
+	return rs.Count(ResultFailed) > 0 || rs.Count(ResultDenied) > 0
+}
+
+// PrintSummary writes the per-kind counts of each status, followed by the
+// objects that were skipped, missing or failed together with the reason.
+func (rs Results) PrintSummary(w io.Writer) {
+	statuses := []ResultStatus{ResultCreated, ResultUpdated, ResultDeleted, ResultApplied, ResultSkipped, ResultMissing, ResultFiltered, ResultDenied, ResultFailed}
+
+	kinds := []string{}
+	counts := map[string]map[ResultStatus]int{}
+	for _, r := range rs {
+		if _, ok := counts[r.Kind]; !ok {
+			kinds = append(kinds, r.Kind)
+			counts[r.Kind] = map[ResultStatus]int{}
+		}
+		counts[r.Kind][r.Status]++
+	}
+	sort.Strings(kinds)
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprint(tw, "KIND")
+	for _, status := range statuses {
+		fmt.Fprintf(tw, "\t%s", status)
+	}
+	fmt.Fprintln(tw)
+	for _, kind := range kinds {
+		fmt.Fprint(tw, kind)
+		for _, status := range statuses {
+			fmt.Fprintf(tw, "\t%d", counts[kind][status])
+		}
+		fmt.Fprintln(tw)
+	}
+	tw.Flush()
+
+	for _, r := range rs {
+		if r.Status == ResultSkipped || r.Status == ResultMissing || r.Status == ResultDenied || r.Status == ResultFailed {
+			fmt.Fprintf(w, "* %s\n", r)
+		}
+	}
+}
+
+// PrintPlan writes the per-kind counts of the objects a dry run would
+// create, update or leave unchanged, followed by the objects that would be
+// skipped or refused, or couldn't be planned.
+func (rs Results) PrintPlan(w io.Writer) {
+	columns := []string{"create", "update", "unchanged", "skip", "missing", "filtered", "denied", "failed"}
+	column := func(r Result) string {
+		switch {
+		case r.Status == ResultCreated:
+			return "create"
+		case r.Status == ResultUpdated:
+			return "update"
+		case r.Status == ResultSkipped && r.Reason == string(k8s_resources.OperationUnchanged):
+			return "unchanged"
+		case r.Status == ResultSkipped:
+			return "skip"
+		case r.Status == ResultMissing:
+			return "missing"
+		case r.Status == ResultFiltered:
+			return "filtered"
+		case r.Status == ResultDenied:
+			return "denied"
+		}
+		return "failed"
+	}
+
+	kinds := []string{}
+	counts := map[string]map[string]int{}
+	for _, r := range rs {
+		if _, ok := counts[r.Kind]; !ok {
+			kinds = append(kinds, r.Kind)
+			counts[r.Kind] = map[string]int{}
+		}
+		counts[r.Kind][column(r)]++
+	}
+	sort.Strings(kinds)
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprint(tw, "KIND")
+	for _, c := range columns {
+		fmt.Fprintf(tw, "\t%s", c)
+	}
+	fmt.Fprintln(tw)
+	for _, kind := range kinds {
+		fmt.Fprint(tw, kind)
+		for _, c := range columns {
+			fmt.Fprintf(tw, "\t%d", counts[kind][c])
+		}
+		fmt.Fprintln(tw)
+	}
+	tw.Flush()
+
+	for _, r := range rs {
+		if c := column(r); c == "skip" || c == "missing" || c == "denied" || c == "failed" {
+			fmt.Fprintf(w, "* %s\n", r)
+		}
+	}
+}
+
+// replace replaces the result of the object of r, if any.
+func (rs Results) replace(r Result) {
+	for i := range rs {
+		if rs[i].Kind == r.Kind && rs[i].Namespace == r.Namespace && rs[i].Name == r.Name {
+			rs[i] = r
+			return
+		}
+	}
+}
+
+func operationResult(kind, namespace, name string, op k8s_resources.Operation, err error) Result {
+	result := Result{Kind: kind, Namespace: namespace, Name: name}
+	switch {
+	case err != nil:
+		return failedResult(kind, namespace, name, err)
+	case op == k8s_resources.OperationCreated:
+		result.Status = ResultCreated
+	case op == k8s_resources.OperationUpdated:
+		result.Status = ResultUpdated
+	default:
+		result.Status = ResultSkipped
+		result.Reason = string(op)
+	}
+
+	return result
+}
+
+func skippedResult(kind, namespace, name, reason string) Result {
+	return Result{Kind: kind, Namespace: namespace, Name: name, Status: ResultSkipped, Reason: reason}
+}
+
+func filteredResult(kind, namespace, name string) Result {
+	return Result{Kind: kind, Namespace: namespace, Name: name, Status: ResultFiltered}
+}
+
+// failedResult reports an object that couldn't be changed because of err.
+// Changes declined by the operator are reported as skipped, and changes
+// refused by the Policy according to its mode.
+func failedResult(kind, namespace, name string, err error) Result {
+	if errors.Is(err, k8s_resources.ErrDeclined) {
+		return skippedResult(kind, namespace, name, reasonDeclined)
+	}
+	if result, ok := policyResult(kind, namespace, name, err); ok {
+		return result
+	}
+
+	return Result{Kind: kind, Namespace: namespace, Name: name, Status: ResultFailed, Reason: errorReason(err)}
+}
@@ -0,0 +1,167 @@
+package helpers
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/klog/v2"
+
+	"github.com/mwlng/k8s_resources_sync/pkg/k8s_resources"
+	"github.com/mwlng/k8s_resources_sync/pkg/utils"
+)
+
+func LoadRoleYamlFiles(rootDir string) []*rbacv1.Role {
+	roles := []*rbacv1.Role{}
+	err := filepath.Walk(rootDir, func(path string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !info.IsDir() {
+			ext := strings.ToLower(filepath.Ext(path))
+			if ext == ".yml" || ext == ".yaml" {
+				data, err := ioutil.ReadFile(path)
+				if err != nil {
+					klog.Errorf("Error while reading YAML file. Err was: %s", err)
+					return err
+				}
+
+				decode := scheme.Codecs.UniversalDeserializer().Decode
+				obj, _, err := decode([]byte(data), nil, nil)
+
+				if err != nil {
+					klog.Errorf("Error while decoding YAML file: %s. Err was: %s", path, err)
+					return nil
+				}
+
+				switch obj.(type) {
+				case *rbacv1.Role:
+					roles = append(roles, obj.(*rbacv1.Role))
+				}
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
+		klog.Errorf("Error while reading YAML files. Err was: %s", err)
+	}
+
+	return roles
+}
+
+// SyncRoles copies the rules of each role from the source cluster, looking
+// it up in the namespace declared by its manifest, and moves the role to
+// its target namespace according to namespaceMap.
+func SyncRoles(ctx context.Context, kubeConfig *rest.Config, roles []*rbacv1.Role, namespaceMap map[string]string, filter *Filter) ([]*rbacv1.Role, Results, error) {
+	klog.Infof("Syncing roles from cluster: %s\n", kubeConfig.Host)
+	roleGetters := map[string]func(context.Context, string) (*rbacv1.Role, error){}
+	counts := map[string]int{}
+	for _, role := range roles {
+		counts[namespaceOf(role.Namespace)]++
+	}
+
+	results := Results{}
+	synced_roles := []*rbacv1.Role{}
+	for _, role := range roles {
+		if utils.Interrupted(ctx) {
+			results = append(results, skippedResult("Role", namespaceOf(role.Namespace), role.Name, reasonInterrupted))
+			continue
+		}
+
+		if !filter.Matches(role) {
+			results = append(results, filteredResult("Role", namespaceOf(role.Namespace), role.Name))
+			continue
+		}
+
+		namespace := namespaceOf(role.Namespace)
+		if _, ok := roleGetters[namespace]; !ok {
+			r, err := k8s_resources.NewRole(kubeConfig, namespace)
+			if err != nil {
+				results = append(results, failedResult("Role", namespace, role.Name, err))
+				continue
+			}
+			roleGetters[namespace] = r.GetRole
+			if counts[namespace] >= listThreshold {
+				index, err := r.IndexRoles(ctx)
+				if err != nil {
+					klog.Warningf("Failed to list roles in %s, falling back to one get per object. Err was: %s", namespace, err)
+				} else {
+					roleGetters[namespace] = index.GetRole
+				}
+			}
+		}
+
+		src_role, err := roleGetters[namespace](ctx, role.Name)
+		if err != nil {
+			klog.Errorf("Failed to get role: %s/%s. Err was: %s", namespace, role.Name, err)
+			results = append(results, sourceErrorResult("Role", namespace, role.Name, err))
+			continue
+		}
+
+		if src_role != nil {
+			if !filter.Matches(src_role) {
+				results = append(results, filteredResult("Role", namespaceOf(role.Namespace), role.Name))
+				continue
+			}
+
+			role.Rules = src_role.Rules
+			role.Namespace = mapNamespace(namespaceMap, namespace)
+
+			synced_roles = append(synced_roles, role)
+		}
+	}
+
+	return synced_roles, results, nil
+}
+
+func PrintRoles(roles []*rbacv1.Role) {
+	for _, role := range roles {
+		result, _ := yaml.Marshal(role)
+		fmt.Printf("%s\n", string(result))
+	}
+}
+
+func ApplyRoles(ctx context.Context, kubeConfig *rest.Config, roles []*rbacv1.Role) (Results, error) {
+	roleClients := map[string]*k8s_resources.Role{}
+	for _, role := range roles {
+		namespace := namespaceOf(role.Namespace)
+		if _, ok := roleClients[namespace]; !ok {
+			r, err := k8s_resources.NewRole(kubeConfig, namespace)
+			if err != nil {
+				return nil, err
+			}
+			roleClients[namespace] = r
+		}
+	}
+
+	results := applyEach(ctx, len(roles), func(i int) Result {
+		role := roles[i]
+		if utils.Interrupted(ctx) {
+			return skippedResult("Role", namespaceOf(role.Namespace), role.Name, reasonInterrupted)
+		}
+
+		namespace := namespaceOf(role.Namespace)
+		klog.Infof("Applying role: %s/%s ...", namespace, role.Name)
+		op, err := roleClients[namespace].ApplyRole(ctx, role)
+		if err != nil {
+			klog.Errorf("Failed to apply role. Err was: %s", err)
+			return operationResult("Role", namespace, role.Name, op, err)
+		}
+		klog.Infoln("Done.")
+
+		return operationResult("Role", namespace, role.Name, op, nil)
+	})
+
+	return results, nil
+}
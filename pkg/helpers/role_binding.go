@@ -0,0 +1,176 @@
+package helpers
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/klog/v2"
+
+	"github.com/mwlng/k8s_resources_sync/pkg/k8s_resources"
+	"github.com/mwlng/k8s_resources_sync/pkg/utils"
+)
+
+func LoadRoleBindingYamlFiles(rootDir string) []*rbacv1.RoleBinding {
+	roleBindings := []*rbacv1.RoleBinding{}
+	err := filepath.Walk(rootDir, func(path string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !info.IsDir() {
+			ext := strings.ToLower(filepath.Ext(path))
+			if ext == ".yml" || ext == ".yaml" {
+				data, err := ioutil.ReadFile(path)
+				if err != nil {
+					klog.Errorf("Error while reading YAML file. Err was: %s", err)
+					return err
+				}
+
+				decode := scheme.Codecs.UniversalDeserializer().Decode
+				obj, _, err := decode([]byte(data), nil, nil)
+
+				if err != nil {
+					klog.Errorf("Error while decoding YAML file: %s. Err was: %s", path, err)
+					return nil
+				}
+
+				switch obj.(type) {
+				case *rbacv1.RoleBinding:
+					roleBindings = append(roleBindings, obj.(*rbacv1.RoleBinding))
+				}
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
+		klog.Errorf("Error while reading YAML files. Err was: %s", err)
+	}
+
+	return roleBindings
+}
+
+// SyncRoleBindings copies the subjects and role ref of each role binding
+// from the source cluster. The binding and the namespaces of its subjects
+// are moved to their target namespaces according to namespaceMap.
+func SyncRoleBindings(ctx context.Context, kubeConfig *rest.Config, roleBindings []*rbacv1.RoleBinding, namespaceMap map[string]string, filter *Filter) ([]*rbacv1.RoleBinding, Results, error) {
+	klog.Infof("Syncing role bindings from cluster: %s\n", kubeConfig.Host)
+	roleBindingGetters := map[string]func(context.Context, string) (*rbacv1.RoleBinding, error){}
+	counts := map[string]int{}
+	for _, roleBinding := range roleBindings {
+		counts[namespaceOf(roleBinding.Namespace)]++
+	}
+
+	results := Results{}
+	synced_roleBindings := []*rbacv1.RoleBinding{}
+	for _, roleBinding := range roleBindings {
+		if utils.Interrupted(ctx) {
+			results = append(results, skippedResult("RoleBinding", namespaceOf(roleBinding.Namespace), roleBinding.Name, reasonInterrupted))
+			continue
+		}
+
+		if !filter.Matches(roleBinding) {
+			results = append(results, filteredResult("RoleBinding", namespaceOf(roleBinding.Namespace), roleBinding.Name))
+			continue
+		}
+
+		namespace := namespaceOf(roleBinding.Namespace)
+		if _, ok := roleBindingGetters[namespace]; !ok {
+			rb, err := k8s_resources.NewRoleBinding(kubeConfig, namespace)
+			if err != nil {
+				results = append(results, failedResult("RoleBinding", namespace, roleBinding.Name, err))
+				continue
+			}
+			roleBindingGetters[namespace] = rb.GetRoleBinding
+			if counts[namespace] >= listThreshold {
+				index, err := rb.IndexRoleBindings(ctx)
+				if err != nil {
+					klog.Warningf("Failed to list role bindings in %s, falling back to one get per object. Err was: %s", namespace, err)
+				} else {
+					roleBindingGetters[namespace] = index.GetRoleBinding
+				}
+			}
+		}
+
+		src_roleBinding, err := roleBindingGetters[namespace](ctx, roleBinding.Name)
+		if err != nil {
+			klog.Errorf("Failed to get role binding: %s/%s. Err was: %s", namespace, roleBinding.Name, err)
+			results = append(results, sourceErrorResult("RoleBinding", namespace, roleBinding.Name, err))
+			continue
+		}
+
+		if src_roleBinding != nil {
+			if !filter.Matches(src_roleBinding) {
+				results = append(results, filteredResult("RoleBinding", namespaceOf(roleBinding.Namespace), roleBinding.Name))
+				continue
+			}
+
+			subjects := make([]rbacv1.Subject, len(src_roleBinding.Subjects))
+			for i, subject := range src_roleBinding.Subjects {
+				if len(subject.Namespace) > 0 {
+					subject.Namespace = mapNamespace(namespaceMap, subject.Namespace)
+				}
+				subjects[i] = subject
+			}
+
+			roleBinding.Subjects = subjects
+			roleBinding.RoleRef = src_roleBinding.RoleRef
+			roleBinding.Namespace = mapNamespace(namespaceMap, namespace)
+
+			synced_roleBindings = append(synced_roleBindings, roleBinding)
+		}
+	}
+
+	return synced_roleBindings, results, nil
+}
+
+func PrintRoleBindings(roleBindings []*rbacv1.RoleBinding) {
+	for _, roleBinding := range roleBindings {
+		result, _ := yaml.Marshal(roleBinding)
+		fmt.Printf("%s\n", string(result))
+	}
+}
+
+func ApplyRoleBindings(ctx context.Context, kubeConfig *rest.Config, roleBindings []*rbacv1.RoleBinding) (Results, error) {
+	roleBindingClients := map[string]*k8s_resources.RoleBinding{}
+	for _, roleBinding := range roleBindings {
+		namespace := namespaceOf(roleBinding.Namespace)
+		if _, ok := roleBindingClients[namespace]; !ok {
+			rb, err := k8s_resources.NewRoleBinding(kubeConfig, namespace)
+			if err != nil {
+				return nil, err
+			}
+			roleBindingClients[namespace] = rb
+		}
+	}
+
+	results := applyEach(ctx, len(roleBindings), func(i int) Result {
+		roleBinding := roleBindings[i]
+		if utils.Interrupted(ctx) {
+			return skippedResult("RoleBinding", namespaceOf(roleBinding.Namespace), roleBinding.Name, reasonInterrupted)
+		}
+
+		namespace := namespaceOf(roleBinding.Namespace)
+		klog.Infof("Applying role binding: %s/%s ...", namespace, roleBinding.Name)
+		op, err := roleBindingClients[namespace].ApplyRoleBinding(ctx, roleBinding)
+		if err != nil {
+			klog.Errorf("Failed to apply role binding. Err was: %s", err)
+			return operationResult("RoleBinding", namespace, roleBinding.Name, op, err)
+		}
+		klog.Infoln("Done.")
+
+		return operationResult("RoleBinding", namespace, roleBinding.Name, op, nil)
+	})
+
+	return results, nil
+}
@@ -1,6 +1,7 @@
 package helpers
 
 import (
+	"context"
 	"fmt"
 	"io/fs"
 	"io/ioutil"
@@ -16,6 +17,7 @@ import (
 	"k8s.io/klog/v2"
 
 	"github.com/mwlng/k8s_resources_sync/pkg/k8s_resources"
+	"github.com/mwlng/k8s_resources_sync/pkg/utils"
 )
 
 var (
@@ -68,22 +70,49 @@ func LoadServiceYamlFiles(rootDir string) []*corev1.Service {
 	return services
 }
 
-func SyncServices(kubeConfig *rest.Config, services []*corev1.Service, environ string) []*corev1.Service {
+func SyncServices(ctx context.Context, kubeConfig *rest.Config, services []*corev1.Service, environ string, filter *Filter) ([]*corev1.Service, Results, error) {
 	klog.Infof("Syncing services from cluster: %s, namespace: %s\n", kubeConfig.Host, corev1.NamespaceDefault)
 	service, err := k8s_resources.NewService(kubeConfig, corev1.NamespaceDefault)
 	if err != nil {
-		panic(err)
+		return nil, nil, err
 	}
 
+	getService := service.GetService
+	if len(services) >= listThreshold {
+		index, err := service.IndexServices(ctx)
+		if err != nil {
+			klog.Warningf("Failed to list services, falling back to one get per object. Err was: %s", err)
+		} else {
+			getService = index.GetService
+		}
+	}
+
+	results := Results{}
 	synced_services := []*corev1.Service{}
 	for _, s := range services {
-		src_service, err := service.GetService(s.Name)
+		if utils.Interrupted(ctx) {
+			results = append(results, skippedResult("Service", corev1.NamespaceDefault, s.Name, reasonInterrupted))
+			continue
+		}
+
+		if !filter.Matches(s) {
+			results = append(results, filteredResult("Service", corev1.NamespaceDefault, s.Name))
+			continue
+		}
+
+		src_service, err := getService(ctx, s.Name)
 		if err != nil {
 			klog.Errorf("Failed to get service: %s. Err was: %s", s.Name, err)
+			results = append(results, sourceErrorResult("Service", corev1.NamespaceDefault, s.Name, err))
 			continue
 		}
 
 		if src_service != nil {
+			if !filter.Matches(src_service) {
+				results = append(results, filteredResult("Service", corev1.NamespaceDefault, s.Name))
+				continue
+			}
+
 			annotations := s.GetAnnotations()
 
 			if externalDns, ok := annotations["external-dns.alpha.kubernetes.io/hostname"]; ok {
@@ -107,7 +136,7 @@ func SyncServices(kubeConfig *rest.Config, services []*corev1.Service, environ s
 		}
 	}
 
-	return synced_services
+	return synced_services, results, nil
 }
 
 func PrintServices(services []*corev1.Service) {
@@ -117,19 +146,28 @@ func PrintServices(services []*corev1.Service) {
 	}
 }
 
-func ApplyServices(kubeConfig *rest.Config, services []*corev1.Service) {
+func ApplyServices(ctx context.Context, kubeConfig *rest.Config, services []*corev1.Service) (Results, error) {
 	service, err := k8s_resources.NewService(kubeConfig, corev1.NamespaceDefault)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
-	for _, s := range services {
+	results := applyEach(ctx, len(services), func(i int) Result {
+		s := services[i]
+		if utils.Interrupted(ctx) {
+			return skippedResult("Service", corev1.NamespaceDefault, s.Name, reasonInterrupted)
+		}
+
 		klog.Infof("Applying service: %s ...", s.Name)
-		err := service.ApplyService(s)
+		op, err := service.ApplyService(ctx, s)
 		if err != nil {
 			klog.Errorf("Failed to apply service. Err was: %s", err)
-			continue
+			return operationResult("Service", corev1.NamespaceDefault, s.Name, op, err)
 		}
 		klog.Infoln("Done.")
-	}
+
+		return operationResult("Service", corev1.NamespaceDefault, s.Name, op, nil)
+	})
+
+	return results, nil
 }
@@ -1,6 +1,7 @@
 package helpers
 
 import (
+	"context"
 	"fmt"
 	"io/fs"
 	"io/ioutil"
@@ -16,6 +17,7 @@ import (
 	"k8s.io/klog/v2"
 
 	"github.com/mwlng/k8s_resources_sync/pkg/k8s_resources"
+	"github.com/mwlng/k8s_resources_sync/pkg/utils"
 )
 
 func LoadServiceAccountYamlFiles(rootDir string) []*corev1.ServiceAccount {
@@ -58,28 +60,55 @@ func LoadServiceAccountYamlFiles(rootDir string) []*corev1.ServiceAccount {
 	return accounts
 }
 
-func SyncServiceAccounts(kubeConfig *rest.Config, serviceAccounts []*corev1.ServiceAccount) []*corev1.ServiceAccount {
+func SyncServiceAccounts(ctx context.Context, kubeConfig *rest.Config, serviceAccounts []*corev1.ServiceAccount, filter *Filter) ([]*corev1.ServiceAccount, Results, error) {
 	klog.Infof("Syncing service accounts from cluster: %s, namespace: %s\n", kubeConfig.Host, corev1.NamespaceDefault)
 	serviceAccount, err := k8s_resources.NewServiceAccount(kubeConfig, corev1.NamespaceDefault)
 	if err != nil {
-		panic(err)
+		return nil, nil, err
 	}
 
+	getServiceAccount := serviceAccount.GetServiceAccount
+	if len(serviceAccounts) >= listThreshold {
+		index, err := serviceAccount.IndexServiceAccounts(ctx)
+		if err != nil {
+			klog.Warningf("Failed to list service accounts, falling back to one get per object. Err was: %s", err)
+		} else {
+			getServiceAccount = index.GetServiceAccount
+		}
+	}
+
+	results := Results{}
 	synced_serviceAccounts := []*corev1.ServiceAccount{}
 	for _, account := range serviceAccounts {
-		src_serviceAccount, err := serviceAccount.GetServiceAccount(account.Name)
+		if utils.Interrupted(ctx) {
+			results = append(results, skippedResult("ServiceAccount", corev1.NamespaceDefault, account.Name, reasonInterrupted))
+			continue
+		}
+
+		if !filter.Matches(account) {
+			results = append(results, filteredResult("ServiceAccount", corev1.NamespaceDefault, account.Name))
+			continue
+		}
+
+		src_serviceAccount, err := getServiceAccount(ctx, account.Name)
 		if err != nil {
 			klog.Errorf("Failed to get service account: %s. Err was: %s", account.Name, err)
+			results = append(results, sourceErrorResult("ServiceAccount", corev1.NamespaceDefault, account.Name, err))
 			continue
 		}
 
 		if src_serviceAccount != nil {
+			if !filter.Matches(src_serviceAccount) {
+				results = append(results, filteredResult("ServiceAccount", corev1.NamespaceDefault, account.Name))
+				continue
+			}
+
 			synced_serviceAccounts = append(synced_serviceAccounts, src_serviceAccount)
 
 		}
 	}
 
-	return synced_serviceAccounts
+	return synced_serviceAccounts, results, nil
 }
 
 func PrintServiceAccounts(serviceAccounts []*corev1.Service) {
@@ -89,19 +118,28 @@ func PrintServiceAccounts(serviceAccounts []*corev1.Service) {
 	}
 }
 
-func ApplyServiceAccounts(kubeConfig *rest.Config, serviceAccounts []*corev1.ServiceAccount) {
+func ApplyServiceAccounts(ctx context.Context, kubeConfig *rest.Config, serviceAccounts []*corev1.ServiceAccount) (Results, error) {
 	serviceAccount, err := k8s_resources.NewServiceAccount(kubeConfig, corev1.NamespaceDefault)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
-	for _, account := range serviceAccounts {
+	results := applyEach(ctx, len(serviceAccounts), func(i int) Result {
+		account := serviceAccounts[i]
+		if utils.Interrupted(ctx) {
+			return skippedResult("ServiceAccount", corev1.NamespaceDefault, account.Name, reasonInterrupted)
+		}
+
 		klog.Infof("Applying service account: %s ...", account.Name)
-		err := serviceAccount.ApplyServiceAccount(account)
+		op, err := serviceAccount.ApplyServiceAccount(ctx, account)
 		if err != nil {
 			klog.Errorf("Failed to apply service. Err was: %s", err)
-			continue
+			return operationResult("ServiceAccount", corev1.NamespaceDefault, account.Name, op, err)
 		}
 		klog.Infoln("Done.")
-	}
+
+		return operationResult("ServiceAccount", corev1.NamespaceDefault, account.Name, op, nil)
+	})
+
+	return results, nil
 }
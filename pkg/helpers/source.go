@@ -0,0 +1,6 @@
+package helpers
+
+// listThreshold is the number of manifests of a kind in a namespace from
+// which Sync* fetches the source objects with one paginated List instead
+// of one Get per manifest.
+const listThreshold = 5
@@ -0,0 +1,163 @@
+package helpers
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/klog/v2"
+
+	"github.com/mwlng/k8s_resources_sync/pkg/k8s_resources"
+	"github.com/mwlng/k8s_resources_sync/pkg/utils"
+)
+
+func LoadStatefulSetYamlFiles(rootDir string) []*appsv1.StatefulSet {
+	statefulSets := []*appsv1.StatefulSet{}
+	err := filepath.Walk(rootDir, func(path string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !info.IsDir() {
+			ext := strings.ToLower(filepath.Ext(path))
+			if ext == ".yml" || ext == ".yaml" {
+				data, err := ioutil.ReadFile(path)
+				if err != nil {
+					klog.Errorf("Error while reading YAML file. Err was: %s", err)
+					return err
+				}
+
+				decode := scheme.Codecs.UniversalDeserializer().Decode
+				obj, _, err := decode([]byte(data), nil, nil)
+
+				if err != nil {
+					klog.Errorf("Error while decoding YAML file: %s. Err was: %s", path, err)
+					return nil
+				}
+
+				switch obj.(type) {
+				case *appsv1.StatefulSet:
+					statefulSets = append(statefulSets, obj.(*appsv1.StatefulSet))
+				}
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
+		klog.Errorf("Error while reading YAML files. Err was: %s", err)
+	}
+
+	return statefulSets
+}
+
+func SyncStatefulSets(ctx context.Context, kubeConfig *rest.Config, statefulSets []*appsv1.StatefulSet, images *ImageRewriter, filter *Filter) ([]*appsv1.StatefulSet, Results, error) {
+	klog.Infof("Syncing stateful sets from cluster: %s, namespace: %s\n", kubeConfig.Host, corev1.NamespaceDefault)
+	statefulSet, err := k8s_resources.NewStatefulSet(kubeConfig, corev1.NamespaceDefault)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	getStatefulSet := statefulSet.GetStatefulSet
+	if len(statefulSets) >= listThreshold {
+		index, err := statefulSet.IndexStatefulSets(ctx)
+		if err != nil {
+			klog.Warningf("Failed to list stateful sets, falling back to one get per object. Err was: %s", err)
+		} else {
+			getStatefulSet = index.GetStatefulSet
+		}
+	}
+
+	results := Results{}
+	synced_statefulSets := []*appsv1.StatefulSet{}
+	for _, s := range statefulSets {
+		if utils.Interrupted(ctx) {
+			results = append(results, skippedResult("StatefulSet", corev1.NamespaceDefault, s.Name, reasonInterrupted))
+			continue
+		}
+
+		if !filter.Matches(s) {
+			results = append(results, filteredResult("StatefulSet", corev1.NamespaceDefault, s.Name))
+			continue
+		}
+
+		src_statefulSet, err := getStatefulSet(ctx, s.Name)
+		if err != nil {
+			klog.Errorf("Failed to get stateful set: %s. Err was: %s", s.Name, err)
+			results = append(results, sourceErrorResult("StatefulSet", corev1.NamespaceDefault, s.Name, err))
+			continue
+		}
+
+		if src_statefulSet != nil {
+			if !filter.Matches(src_statefulSet) {
+				results = append(results, filteredResult("StatefulSet", corev1.NamespaceDefault, s.Name))
+				continue
+			}
+
+			containerImageMap := map[string]string{}
+			for _, c := range src_statefulSet.Spec.Template.Spec.Containers {
+				containerImageMap[c.Name] = c.Image
+			}
+
+			for i, c := range s.Spec.Template.Spec.Containers {
+				s.Spec.Template.Spec.Containers[i].Image = containerImageMap[c.Name]
+			}
+
+			err = images.Rewrite(ctx, "StatefulSet", corev1.NamespaceDefault, &s.ObjectMeta, &s.Spec.Template.Spec, src_statefulSet.Spec.Selector)
+			if err != nil {
+				klog.Errorf("Failed to rewrite the images of stateful set: %s. Err was: %s", s.Name, err)
+				results = append(results, failedResult("StatefulSet", corev1.NamespaceDefault, s.Name, err))
+				continue
+			}
+
+			s.Spec.Replicas = src_statefulSet.Spec.Replicas
+
+			synced_statefulSets = append(synced_statefulSets, s)
+		}
+	}
+
+	return synced_statefulSets, results, nil
+}
+
+func PrintStatefulSets(statefulSets []*appsv1.StatefulSet) {
+	for _, s := range statefulSets {
+		result, _ := yaml.Marshal(s)
+		fmt.Printf("%s\n", string(result))
+	}
+}
+
+func ApplyStatefulSets(ctx context.Context, kubeConfig *rest.Config, statefulSets []*appsv1.StatefulSet) (Results, error) {
+	statefulSet, err := k8s_resources.NewStatefulSet(kubeConfig, corev1.NamespaceDefault)
+	if err != nil {
+		return nil, err
+	}
+
+	results := applyEach(ctx, len(statefulSets), func(i int) Result {
+		s := statefulSets[i]
+		if utils.Interrupted(ctx) {
+			return skippedResult("StatefulSet", corev1.NamespaceDefault, s.Name, reasonInterrupted)
+		}
+
+		klog.Infof("Applying stateful set %s ...", s.Name)
+		op, err := statefulSet.ApplyStatefulSet(ctx, s)
+		if err != nil {
+			klog.Errorf("Failed to apply stateful set. Err was: %s", err)
+			return operationResult("StatefulSet", corev1.NamespaceDefault, s.Name, op, err)
+		}
+		klog.Infoln("Done.")
+
+		return operationResult("StatefulSet", corev1.NamespaceDefault, s.Name, op, nil)
+	})
+
+	return results, nil
+}
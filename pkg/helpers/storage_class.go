@@ -0,0 +1,152 @@
+package helpers
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	storagev1 "k8s.io/api/storage/v1"
+
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/klog/v2"
+
+	"github.com/mwlng/k8s_resources_sync/pkg/k8s_resources"
+	"github.com/mwlng/k8s_resources_sync/pkg/utils"
+)
+
+func LoadStorageClassYamlFiles(rootDir string) []*storagev1.StorageClass {
+	classes := []*storagev1.StorageClass{}
+	err := filepath.Walk(rootDir, func(path string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !info.IsDir() {
+			ext := strings.ToLower(filepath.Ext(path))
+			if ext == ".yml" || ext == ".yaml" {
+				data, err := ioutil.ReadFile(path)
+				if err != nil {
+					klog.Errorf("Error while reading YAML file. Err was: %s", err)
+					return err
+				}
+
+				decode := scheme.Codecs.UniversalDeserializer().Decode
+				obj, _, err := decode([]byte(data), nil, nil)
+
+				if err != nil {
+					klog.Errorf("Error while decoding YAML file: %s. Err was: %s", path, err)
+					return nil
+				}
+
+				switch obj.(type) {
+				case *storagev1.StorageClass:
+					classes = append(classes, obj.(*storagev1.StorageClass))
+				}
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
+		klog.Errorf("Error while reading YAML files. Err was: %s", err)
+	}
+
+	return classes
+}
+
+func SyncStorageClasses(ctx context.Context, kubeConfig *rest.Config, storageClasses []*storagev1.StorageClass, filter *Filter) ([]*storagev1.StorageClass, Results, error) {
+	klog.Infof("Syncing storage classes from cluster: %s\n", kubeConfig.Host)
+	storageClass, err := k8s_resources.NewStorageClass(kubeConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	getStorageClass := storageClass.GetStorageClass
+	if len(storageClasses) >= listThreshold {
+		index, err := storageClass.IndexStorageClasses(ctx)
+		if err != nil {
+			klog.Warningf("Failed to list storage classes, falling back to one get per object. Err was: %s", err)
+		} else {
+			getStorageClass = index.GetStorageClass
+		}
+	}
+
+	results := Results{}
+	synced_storageClasses := []*storagev1.StorageClass{}
+	for _, class := range storageClasses {
+		if utils.Interrupted(ctx) {
+			results = append(results, skippedResult("StorageClass", "", class.Name, reasonInterrupted))
+			continue
+		}
+
+		if !filter.Matches(class) {
+			results = append(results, filteredResult("StorageClass", "", class.Name))
+			continue
+		}
+
+		src_storageClass, err := getStorageClass(ctx, class.Name)
+		if err != nil {
+			klog.Errorf("Failed to get storage class: %s. Err was: %s", class.Name, err)
+			results = append(results, sourceErrorResult("StorageClass", "", class.Name, err))
+			continue
+		}
+
+		if src_storageClass != nil {
+			if !filter.Matches(src_storageClass) {
+				results = append(results, filteredResult("StorageClass", "", class.Name))
+				continue
+			}
+
+			class.Provisioner = src_storageClass.Provisioner
+			class.Parameters = src_storageClass.Parameters
+			class.ReclaimPolicy = src_storageClass.ReclaimPolicy
+			class.MountOptions = src_storageClass.MountOptions
+			class.AllowVolumeExpansion = src_storageClass.AllowVolumeExpansion
+			class.VolumeBindingMode = src_storageClass.VolumeBindingMode
+			class.AllowedTopologies = src_storageClass.AllowedTopologies
+
+			synced_storageClasses = append(synced_storageClasses, class)
+		}
+	}
+
+	return synced_storageClasses, results, nil
+}
+
+func PrintStorageClasses(storageClasses []*storagev1.StorageClass) {
+	for _, class := range storageClasses {
+		result, _ := yaml.Marshal(class)
+		fmt.Printf("%s\n", string(result))
+	}
+}
+
+func ApplyStorageClasses(ctx context.Context, kubeConfig *rest.Config, storageClasses []*storagev1.StorageClass) (Results, error) {
+	storageClass, err := k8s_resources.NewStorageClass(kubeConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	results := applyEach(ctx, len(storageClasses), func(i int) Result {
+		class := storageClasses[i]
+		if utils.Interrupted(ctx) {
+			return skippedResult("StorageClass", "", class.Name, reasonInterrupted)
+		}
+
+		klog.Infof("Applying storage class: %s ...", class.Name)
+		op, err := storageClass.ApplyStorageClass(ctx, class)
+		if err != nil {
+			klog.Errorf("Failed to apply storage class. Err was: %s", err)
+			return operationResult("StorageClass", "", class.Name, op, err)
+		}
+		klog.Infoln("Done.")
+
+		return operationResult("StorageClass", "", class.Name, op, nil)
+	})
+
+	return results, nil
+}
@@ -0,0 +1,298 @@
+package helpers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/rest"
+	"k8s.io/klog/v2"
+
+	"github.com/mwlng/k8s_resources_sync/pkg/k8s_resources"
+	"github.com/mwlng/k8s_resources_sync/pkg/openapi"
+)
+
+// ValidationIssue is a problem found in a manifest file.
+type ValidationIssue struct {
+	File      string
+	Line      int
+	Kind      string
+	Namespace string
+	Name      string
+	Message   string
+}
+
+func (i ValidationIssue) String() string {
+	name := i.Name
+	if len(i.Namespace) > 0 {
+		name = i.Namespace + "/" + i.Name
+	}
+
+	return fmt.Sprintf("%s:%d: %s %s: %s", i.File, i.Line, i.Kind, name, i.Message)
+}
+
+// manifest is a manifest file decoded for validation. Numbers are decoded as
+// float64, like the OpenAPI validator expects. Only the first YAML document
+// of a file is decoded, as the sync steps do, the kinds of the others are
+// kept in extra.
+type manifest struct {
+	file  string
+	data  []byte
+	obj   map[string]interface{}
+	gvk   schema.GroupVersionKind
+	extra []document
+}
+
+// document is a YAML document of a manifest file after the first one.
+type document struct {
+	line int
+	gvk  schema.GroupVersionKind
+}
+
+// ValidateManifests checks the manifest files under rootDir, of the kinds
+// matched by match and the objects matched by filter, against the target
+// cluster: their API version must be served, and they must conform to its
+// OpenAPI v3 schema. Custom resources of CRDs that are defined in rootDir
+// but not applied yet are only checked once their CRD is. If the target
+// doesn't serve OpenAPI v3, only the API versions are checked. Files with
+// several YAML documents are reported, since only their first document is
+// synced.
+func ValidateManifests(ctx context.Context, kubeConfig *rest.Config, rootDir string, match func(gvk schema.GroupVersionKind) bool, filter *Filter) ([]ValidationIssue, error) {
+	cluster, err := k8s_resources.ClusterFor(kubeConfig)
+	if err != nil {
+		return nil, err
+	}
+	disco := cluster.Clientset.Discovery()
+
+	schemas, err := openapi.NewClient(ctx, disco.RESTClient())
+	if err == openapi.ErrNotServed {
+		klog.Warningf("Target cluster %s doesn't serve OpenAPI v3, only checking API versions", kubeConfig.Host)
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get the OpenAPI v3 schema: %s", err)
+	}
+
+	manifests, err := loadManifests(rootDir)
+	if err != nil {
+		return nil, err
+	}
+
+	pending := map[schema.GroupKind]bool{}
+	for _, m := range manifests {
+		if m.gvk.GroupKind() == crdGroupKind {
+			group, _, _ := unstructured.NestedString(m.obj, "spec", "group")
+			kind, _, _ := unstructured.NestedString(m.obj, "spec", "names", "kind")
+			pending[schema.GroupKind{Group: group, Kind: kind}] = true
+		}
+	}
+
+	served := servedKinds{disco: disco, kinds: map[schema.GroupVersion]map[string]bool{}}
+	issues := []ValidationIssue{}
+	for _, m := range manifests {
+		issue := func(line int, message string) ValidationIssue {
+			meta, _ := m.obj["metadata"].(map[string]interface{})
+			name, _ := meta["name"].(string)
+			namespace, _ := meta["namespace"].(string)
+			return ValidationIssue{File: m.file, Line: line, Kind: m.gvk.Kind, Namespace: namespace, Name: name, Message: message}
+		}
+
+		for i, d := range m.extra {
+			if match(d.gvk) {
+				issues = append(issues, issue(d.line, fmt.Sprintf("YAML document %d, a %s, isn't synced, only the first document of a file is: move it to a file of its own", i+2, d.gvk.Kind)))
+			}
+		}
+
+		if !match(m.gvk) || !filter.Matches(&unstructured.Unstructured{Object: m.obj}) {
+			continue
+		}
+
+		ok, err := served.has(m.gvk)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			if pending[m.gvk.GroupKind()] {
+				continue
+			}
+
+			message := fmt.Sprintf("apiVersion %s is not served by the target cluster", m.gvk.GroupVersion())
+			if alternative, err := served.alternative(m.gvk); err == nil && len(alternative) > 0 {
+				message += ", use " + alternative
+			}
+			issues = append(issues, issue(openapi.LineOf(m.data, openapi.Path{"apiVersion"}), message))
+			continue
+		}
+
+		if schemas == nil {
+			continue
+		}
+
+		doc, err := schemas.Document(ctx, m.gvk.GroupVersion())
+		if err != nil {
+			return nil, fmt.Errorf("failed to get the OpenAPI v3 schema of %s: %s", m.gvk.GroupVersion(), err)
+		}
+		if doc == nil {
+			continue
+		}
+
+		kindSchema := doc.KindSchema(m.gvk)
+		if kindSchema == nil {
+			continue
+		}
+
+		for _, fieldErr := range doc.Validate(kindSchema, m.obj) {
+			issues = append(issues, issue(openapi.LineOf(m.data, fieldErr.Path), fieldErr.Error()))
+		}
+	}
+
+	return issues, nil
+}
+
+func loadManifests(rootDir string) ([]manifest, error) {
+	manifests := []manifest{}
+	err := filepath.Walk(rootDir, func(path string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		ext := strings.ToLower(filepath.Ext(path))
+		if info.IsDir() || (ext != ".yml" && ext != ".yaml") {
+			return nil
+		}
+
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		m := manifest{file: path, data: data}
+		jsonData, err := yaml.ToJSON(data)
+		if err == nil {
+			err = json.Unmarshal(jsonData, &m.obj)
+		}
+		if err != nil {
+			klog.Errorf("Error while decoding YAML file: %s. Err was: %s", path, err)
+			return nil
+		}
+
+		apiVersion, _ := m.obj["apiVersion"].(string)
+		kind, _ := m.obj["kind"].(string)
+		if len(apiVersion) == 0 || len(kind) == 0 {
+			return nil
+		}
+		m.gvk = schema.FromAPIVersionAndKind(apiVersion, kind)
+		m.extra = extraDocuments(data)
+
+		manifests = append(manifests, m)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(manifests, func(i, j int) bool { return manifests[i].file < manifests[j].file })
+
+	return manifests, nil
+}
+
+// extraDocuments returns the YAML documents of data after the first one
+// that declare a kind, with the line of their separator.
+func extraDocuments(data []byte) []document {
+	extra := []document{}
+	lines := strings.Split(string(data), "\n")
+	seen, start := false, 0
+	for i := 0; i <= len(lines); i++ {
+		if i < len(lines) && strings.TrimRight(lines[i], " \t\r") != "---" {
+			continue
+		}
+
+		doc := strings.Join(lines[start:i], "\n")
+		line := start
+		start = i + 1
+
+		obj := map[string]interface{}{}
+		jsonData, err := yaml.ToJSON([]byte(doc))
+		if err != nil || json.Unmarshal(jsonData, &obj) != nil || len(obj) == 0 {
+			continue
+		}
+		if !seen {
+			seen = true
+			continue
+		}
+
+		apiVersion, _ := obj["apiVersion"].(string)
+		kind, _ := obj["kind"].(string)
+		if len(kind) > 0 {
+			extra = append(extra, document{line: line, gvk: schema.FromAPIVersionAndKind(apiVersion, kind)})
+		}
+	}
+
+	return extra
+}
+
+// servedKinds caches the kinds served by the target cluster per group
+// version.
+type servedKinds struct {
+	disco discovery.DiscoveryInterface
+	kinds map[schema.GroupVersion]map[string]bool
+}
+
+func (s *servedKinds) has(gvk schema.GroupVersionKind) (bool, error) {
+	gv := gvk.GroupVersion()
+	kinds, ok := s.kinds[gv]
+	if !ok {
+		kinds = map[string]bool{}
+		resources, err := s.disco.ServerResourcesForGroupVersion(gv.String())
+		if err != nil && !apierrors.IsNotFound(err) {
+			return false, fmt.Errorf("failed to discover %s: %s", gv, err)
+		}
+		if err == nil {
+			for _, r := range resources.APIResources {
+				kinds[r.Kind] = true
+			}
+		}
+		s.kinds[gv] = kinds
+	}
+
+	return kinds[gvk.Kind], nil
+}
+
+// alternative returns a served apiVersion of the group and kind of gvk,
+// preferring the preferred version of the group.
+func (s *servedKinds) alternative(gvk schema.GroupVersionKind) (string, error) {
+	groups, err := s.disco.ServerGroups()
+	if err != nil {
+		return "", err
+	}
+
+	for _, group := range groups.Groups {
+		if group.Name != gvk.Group {
+			continue
+		}
+
+		versions := []string{group.PreferredVersion.GroupVersion}
+		for _, v := range group.Versions {
+			versions = append(versions, v.GroupVersion)
+		}
+		for _, v := range versions {
+			gv, err := schema.ParseGroupVersion(v)
+			if err != nil {
+				continue
+			}
+			if ok, err := s.has(gv.WithKind(gvk.Kind)); err == nil && ok {
+				return v, nil
+			}
+		}
+	}
+
+	return "", nil
+}
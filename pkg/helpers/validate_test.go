@@ -0,0 +1,158 @@
+package helpers
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/rest"
+)
+
+func TestExtraDocuments(t *testing.T) {
+	configMap := schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}
+	service := schema.GroupVersionKind{Version: "v1", Kind: "Service"}
+
+	tests := []struct {
+		name string
+		data string
+		want []document
+	}{
+		{"single", "apiVersion: v1\nkind: ConfigMap\n", []document{}},
+		{"leading separator", "---\napiVersion: v1\nkind: ConfigMap\n", []document{}},
+		{
+			"second document",
+			"apiVersion: v1\nkind: ConfigMap\n---\napiVersion: v1\nkind: Service\n",
+			[]document{{line: 3, gvk: service}},
+		},
+		{
+			"leading separator and second document",
+			"---\napiVersion: v1\nkind: ConfigMap\n---\napiVersion: v1\nkind: Service\n",
+			[]document{{line: 4, gvk: service}},
+		},
+		{
+			"comment-only documents",
+			"# Generated.\n---\napiVersion: v1\nkind: Service\n---\n# Nothing here.\n---\napiVersion: v1\nkind: ConfigMap\n",
+			[]document{{line: 7, gvk: configMap}},
+		},
+		{
+			"trailing separator",
+			"apiVersion: v1\nkind: ConfigMap\n---\n",
+			[]document{},
+		},
+		{
+			"document without kind",
+			"apiVersion: v1\nkind: ConfigMap\n---\nvalues:\n  a: 1\n---\napiVersion: v1\nkind: Service\n",
+			[]document{{line: 6, gvk: service}},
+		},
+		{
+			"separator with trailing spaces and CRLF",
+			"apiVersion: v1\r\nkind: ConfigMap\r\n--- \r\napiVersion: v1\r\nkind: Service\r\n",
+			[]document{{line: 3, gvk: service}},
+		},
+		{
+			"separator in a block scalar",
+			"apiVersion: v1\nkind: ConfigMap\ndata:\n  a: |\n    ---\n",
+			[]document{},
+		},
+	}
+
+	for _, test := range tests {
+		if got := extraDocuments([]byte(test.data)); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: extraDocuments() = %+v, want %+v", test.name, got, test.want)
+		}
+	}
+}
+
+// testAPIServer serves responses, by path, like an API server, and answers
+// NotFound to the other requests.
+func testAPIServer(t *testing.T, responses map[string]string) *rest.Config {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		body, ok := responses[req.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"kind": "Status", "apiVersion": "v1", "status": "Failure", "reason": "NotFound", "code": 404}`))
+			return
+		}
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+
+	return &rest.Config{Host: server.URL}
+}
+
+func TestValidateManifests(t *testing.T) {
+	// The target serves Services and apps/v1 Deployments.
+	serviceSchema := `{"components": {"schemas": {
+		"io.k8s.api.core.v1.Service": {
+			"type": "object",
+			"properties": {
+				"apiVersion": {"type": "string"},
+				"kind": {"type": "string"},
+				"metadata": {"type": "object"},
+				"spec": {"type": "object", "properties": {
+					"ports": {"type": "array", "items": {"type": "object", "properties": {
+						"port": {"type": "integer"},
+						"targetPort": {"allOf": [{"$ref": "#/components/schemas/io.k8s.apimachinery.pkg.util.intstr.IntOrString"}]}
+					}}}
+				}}
+			},
+			"x-kubernetes-group-version-kind": [{"group": "", "version": "v1", "kind": "Service"}]
+		},
+		"io.k8s.apimachinery.pkg.util.intstr.IntOrString": {"type": "string", "format": "int-or-string"}
+	}}}`
+
+	responses := map[string]string{
+		"/api":               `{"kind": "APIVersions", "versions": ["v1"]}`,
+		"/api/v1":            `{"kind": "APIResourceList", "groupVersion": "v1", "resources": [{"name": "services", "kind": "Service", "namespaced": true, "verbs": ["get"]}]}`,
+		"/apis":              `{"kind": "APIGroupList", "groups": [{"name": "apps", "versions": [{"groupVersion": "apps/v1", "version": "v1"}], "preferredVersion": {"groupVersion": "apps/v1", "version": "v1"}}]}`,
+		"/apis/apps/v1":      `{"kind": "APIResourceList", "groupVersion": "apps/v1", "resources": [{"name": "deployments", "kind": "Deployment", "namespaced": true, "verbs": ["get"]}]}`,
+		"/openapi/v3":        `{"paths": {"api/v1": {"serverRelativeURL": "/openapi/v3/api/v1?hash=abc"}}}`,
+		"/openapi/v3/api/v1": serviceSchema,
+	}
+
+	dir := t.TempDir()
+	for name, data := range map[string]string{
+		// An integer targetPort is valid.
+		"service.yaml": "apiVersion: v1\nkind: Service\nmetadata:\n  name: web\nspec:\n  ports:\n  - port: 80\n    targetPort: 8080\n",
+		"invalid.yaml": "apiVersion: v1\nkind: Service\nmetadata:\n  name: api\nspec:\n  ports:\n  - port: \"80\"\n    targetPort: true\n",
+		"old.yaml":     "apiVersion: apps/v1beta1\nkind: Deployment\nmetadata:\n  name: web\n",
+		"multi.yaml":   "---\napiVersion: v1\nkind: Service\nmetadata:\n  name: multi\n---\napiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: extra\n",
+		"other.yaml":   "apiVersion: v1\nkind: Service\nmetadata:\n  name: other\nspec:\n  ports: {}\n",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	filter, err := NewFilter("", nil, []string{"other"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	match := func(gvk schema.GroupVersionKind) bool { return true }
+
+	issues, err := ValidateManifests(context.Background(), testAPIServer(t, responses), dir, match, filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := []string{}
+	for _, issue := range issues {
+		got = append(got, strings.TrimPrefix(issue.String(), dir+string(filepath.Separator)))
+	}
+	want := []string{
+		`invalid.yaml:7: Service api: spec.ports[0].port: expected integer, got string "80"`,
+		"invalid.yaml:8: Service api: spec.ports[0].targetPort: expected integer or string, got boolean true",
+		"multi.yaml:6: Service multi: YAML document 2, a ConfigMap, isn't synced, only the first document of a file is: move it to a file of its own",
+		"old.yaml:1: Deployment web: apiVersion apps/v1beta1 is not served by the target cluster, use apps/v1",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ValidateManifests() =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
@@ -0,0 +1,61 @@
+package k8s_resources
+
+import (
+	"sync"
+
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"github.com/mwlng/k8s_resources_sync/pkg/dyna_client"
+)
+
+// Cluster owns the clients of one cluster: a clientset, a dynamic client
+// and a discovery cache. The kind wrappers are built from it, so that a
+// multi-kind run sets up connections and discovers the API only once.
+type Cluster struct {
+	Config     *rest.Config
+	Clientset  kubernetes.Interface
+	Discovery  discovery.CachedDiscoveryInterface
+	DynaClient *dyna_client.DynaClient
+}
+
+var (
+	clustersLock sync.Mutex
+	clusters     = map[*rest.Config]*Cluster{}
+)
+
+// ClusterFor returns the Cluster of config, creating it on first use.
+// Clusters are cached by config pointer, so config must not be modified
+// once it has been passed in.
+func ClusterFor(config *rest.Config) (*Cluster, error) {
+	clustersLock.Lock()
+	defer clustersLock.Unlock()
+
+	if cluster, ok := clusters[config]; ok {
+		return cluster, nil
+	}
+
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	dyn, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	cached := memory.NewMemCacheClient(clientset.Discovery())
+	cluster := &Cluster{
+		Config:     config,
+		Clientset:  clientset,
+		Discovery:  cached,
+		DynaClient: dyna_client.NewDynaClientWith(dyn, cached),
+	}
+	clusters[config] = cluster
+
+	return cluster, nil
+}
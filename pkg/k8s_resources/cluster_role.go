@@ -4,40 +4,81 @@ import (
 	"context"
 
 	rbacv1 "k8s.io/api/rbac/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	typedv1 "k8s.io/client-go/kubernetes/typed/rbac/v1"
 
-	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 )
 
 type ClusterRole struct {
-	client typedv1.ClusterRoleInterface
+	client    typedv1.ClusterRoleInterface
+	namespace string
 }
 
 func NewClusterRole(config *rest.Config) (*ClusterRole, error) {
-	clientset, err := kubernetes.NewForConfig(config)
+	cluster, err := ClusterFor(config)
 	if err != nil {
 		return nil, err
 	}
 
 	return &ClusterRole{
-		client: clientset.RbacV1().ClusterRoles(),
+		client:    cluster.Clientset.RbacV1().ClusterRoles(),
+		namespace: "",
 	}, nil
 }
 
-func (cr *ClusterRole) ListClusterRoles() (*rbacv1.ClusterRoleList, error) {
-	list, err := cr.client.List(context.TODO(), metav1.ListOptions{})
+// ListClusterRoles lists all cluster roles in pages of ListPageSize.
+func (cr *ClusterRole) ListClusterRoles(ctx context.Context) (*rbacv1.ClusterRoleList, error) {
+	result := &rbacv1.ClusterRoleList{}
+	err := listPages(func(opts metav1.ListOptions) (string, error) {
+		list, err := cr.client.List(ctx, opts)
+		if err != nil {
+			return "", err
+		}
+
+		result.Items = append(result.Items, list.Items...)
+		return list.Continue, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// ClusterRoleIndex holds the cluster roles of one List, indexed by name.
+type ClusterRoleIndex map[string]*rbacv1.ClusterRole
+
+// IndexClusterRoles lists all cluster roles and indexes them by name.
+func (cr *ClusterRole) IndexClusterRoles(ctx context.Context) (ClusterRoleIndex, error) {
+	list, err := cr.ListClusterRoles(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	return list, nil
+	index := ClusterRoleIndex{}
+	for i := range list.Items {
+		index[list.Items[i].Name] = &list.Items[i]
+	}
+
+	return index, nil
+}
+
+// GetClusterRole looks up a cluster role in the index, returning a NotFound error
+// like the API server if it isn't there.
+func (index ClusterRoleIndex) GetClusterRole(ctx context.Context, name string) (*rbacv1.ClusterRole, error) {
+	if result, ok := index[name]; ok {
+		return result, nil
+	}
+
+	return nil, apierrors.NewNotFound(rbacv1.Resource("clusterroles"), name)
 }
 
-func (cr *ClusterRole) GetClusterRole(name string) (*rbacv1.ClusterRole, error) {
-	role, err := cr.client.Get(context.TODO(), name, metav1.GetOptions{})
+func (cr *ClusterRole) GetClusterRole(ctx context.Context, name string) (*rbacv1.ClusterRole, error) {
+	role, err := cr.client.Get(ctx, name, metav1.GetOptions{})
 	if err != nil {
 		return nil, err
 	}
@@ -45,8 +86,8 @@ func (cr *ClusterRole) GetClusterRole(name string) (*rbacv1.ClusterRole, error)
 	return role, nil
 }
 
-func (cr *ClusterRole) CreateClusterRole(clusterRole *rbacv1.ClusterRole) error {
-	_, err := cr.client.Create(context.TODO(), clusterRole, metav1.CreateOptions{})
+func (cr *ClusterRole) CreateClusterRole(ctx context.Context, clusterRole *rbacv1.ClusterRole) error {
+	_, err := cr.client.Create(ctx, clusterRole, metav1.CreateOptions{})
 	if err != nil {
 		return err
 	}
@@ -54,8 +95,8 @@ func (cr *ClusterRole) CreateClusterRole(clusterRole *rbacv1.ClusterRole) error
 	return nil
 }
 
-func (cr *ClusterRole) UpdateClusterRole(clusterRole *rbacv1.ClusterRole) error {
-	_, err := cr.client.Update(context.TODO(), clusterRole, metav1.UpdateOptions{})
+func (cr *ClusterRole) UpdateClusterRole(ctx context.Context, clusterRole *rbacv1.ClusterRole) error {
+	_, err := cr.client.Update(ctx, clusterRole, metav1.UpdateOptions{})
 	if err != nil {
 		return err
 	}
@@ -63,20 +104,62 @@ func (cr *ClusterRole) UpdateClusterRole(clusterRole *rbacv1.ClusterRole) error
 	return nil
 }
 
-func (cr *ClusterRole) ApplyClusterRole(clusterRole *rbacv1.ClusterRole) error {
-	result, _ := cr.GetClusterRole(clusterRole.Name)
+// ApplyClusterRole creates or updates a cluster role. Conflicts and transient
+// API errors are retried according to the options of ctx.
+func (cr *ClusterRole) ApplyClusterRole(ctx context.Context, clusterRole *rbacv1.ClusterRole) (Operation, error) {
+	return retryApply(ctx, "cluster role "+clusterRole.Name, func() (Operation, error) {
+		return cr.applyClusterRole(ctx, clusterRole)
+	})
+}
+
+func (cr *ClusterRole) applyClusterRole(ctx context.Context, clusterRole *rbacv1.ClusterRole) (Operation, error) {
+	result, err := cr.GetClusterRole(ctx, clusterRole.Name)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return "", err
+	}
+
 	if result != nil {
+		err = Admit(ctx, rbacv1.SchemeGroupVersion.WithKind("ClusterRole"), cr.namespace, result.Name, result.Labels, clusterRole.Labels)
+	} else {
+		err = Admit(ctx, rbacv1.SchemeGroupVersion.WithKind("ClusterRole"), cr.namespace, clusterRole.Name, clusterRole.Labels)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if result != nil {
+		before := result.DeepCopy()
+
 		result.Rules = clusterRole.Rules
-		err := cr.UpdateClusterRole(result)
-		if err != nil {
-			return err
+		if apiequality.Semantic.DeepEqual(before, result) {
+			return OperationUnchanged, nil
 		}
-	} else {
-		err := cr.CreateClusterRole(clusterRole)
+		if IsDryRun(ctx) {
+			return OperationUpdated, nil
+		}
+		if err := Snapshot(ctx, rbacv1.SchemeGroupVersion.WithKind("ClusterRole"), cr.namespace, result.Name, before); err != nil {
+			return "", err
+		}
+
+		err := cr.UpdateClusterRole(ctx, result)
 		if err != nil {
-			return err
+			return "", err
 		}
+
+		return OperationUpdated, nil
 	}
 
-	return nil
+	if IsDryRun(ctx) {
+		return OperationCreated, nil
+	}
+	if err := Snapshot(ctx, rbacv1.SchemeGroupVersion.WithKind("ClusterRole"), cr.namespace, clusterRole.Name, nil); err != nil {
+		return "", err
+	}
+
+	err = cr.CreateClusterRole(ctx, clusterRole)
+	if err != nil {
+		return "", err
+	}
+
+	return OperationCreated, nil
 }
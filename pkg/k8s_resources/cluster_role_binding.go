@@ -4,40 +4,81 @@ import (
 	"context"
 
 	rbacv1 "k8s.io/api/rbac/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	typedv1 "k8s.io/client-go/kubernetes/typed/rbac/v1"
 
-	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 )
 
 type ClusterRoleBinding struct {
-	client typedv1.ClusterRoleBindingInterface
+	client    typedv1.ClusterRoleBindingInterface
+	namespace string
 }
 
 func NewClusterRoleBinding(config *rest.Config) (*ClusterRoleBinding, error) {
-	clientset, err := kubernetes.NewForConfig(config)
+	cluster, err := ClusterFor(config)
 	if err != nil {
 		return nil, err
 	}
 
 	return &ClusterRoleBinding{
-		client: clientset.RbacV1().ClusterRoleBindings(),
+		client:    cluster.Clientset.RbacV1().ClusterRoleBindings(),
+		namespace: "",
 	}, nil
 }
 
-func (crb *ClusterRoleBinding) ListClusterRoleBindings() (*rbacv1.ClusterRoleBindingList, error) {
-	list, err := crb.client.List(context.TODO(), metav1.ListOptions{})
+// ListClusterRoleBindings lists all cluster role bindings in pages of ListPageSize.
+func (crb *ClusterRoleBinding) ListClusterRoleBindings(ctx context.Context) (*rbacv1.ClusterRoleBindingList, error) {
+	result := &rbacv1.ClusterRoleBindingList{}
+	err := listPages(func(opts metav1.ListOptions) (string, error) {
+		list, err := crb.client.List(ctx, opts)
+		if err != nil {
+			return "", err
+		}
+
+		result.Items = append(result.Items, list.Items...)
+		return list.Continue, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// ClusterRoleBindingIndex holds the cluster role bindings of one List, indexed by name.
+type ClusterRoleBindingIndex map[string]*rbacv1.ClusterRoleBinding
+
+// IndexClusterRoleBindings lists all cluster role bindings and indexes them by name.
+func (crb *ClusterRoleBinding) IndexClusterRoleBindings(ctx context.Context) (ClusterRoleBindingIndex, error) {
+	list, err := crb.ListClusterRoleBindings(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	return list, nil
+	index := ClusterRoleBindingIndex{}
+	for i := range list.Items {
+		index[list.Items[i].Name] = &list.Items[i]
+	}
+
+	return index, nil
+}
+
+// GetClusterRoleBinding looks up a cluster role binding in the index, returning a NotFound error
+// like the API server if it isn't there.
+func (index ClusterRoleBindingIndex) GetClusterRoleBinding(ctx context.Context, name string) (*rbacv1.ClusterRoleBinding, error) {
+	if result, ok := index[name]; ok {
+		return result, nil
+	}
+
+	return nil, apierrors.NewNotFound(rbacv1.Resource("clusterrolebindings"), name)
 }
 
-func (crb *ClusterRoleBinding) GetClusterRoleBinding(name string) (*rbacv1.ClusterRoleBinding, error) {
-	roleBinding, err := crb.client.Get(context.TODO(), name, metav1.GetOptions{})
+func (crb *ClusterRoleBinding) GetClusterRoleBinding(ctx context.Context, name string) (*rbacv1.ClusterRoleBinding, error) {
+	roleBinding, err := crb.client.Get(ctx, name, metav1.GetOptions{})
 	if err != nil {
 		return nil, err
 	}
@@ -45,8 +86,8 @@ func (crb *ClusterRoleBinding) GetClusterRoleBinding(name string) (*rbacv1.Clust
 	return roleBinding, nil
 }
 
-func (crb *ClusterRoleBinding) CreateClusterRoleBinding(clusterRoleBinding *rbacv1.ClusterRoleBinding) error {
-	_, err := crb.client.Create(context.TODO(), clusterRoleBinding, metav1.CreateOptions{})
+func (crb *ClusterRoleBinding) CreateClusterRoleBinding(ctx context.Context, clusterRoleBinding *rbacv1.ClusterRoleBinding) error {
+	_, err := crb.client.Create(ctx, clusterRoleBinding, metav1.CreateOptions{})
 	if err != nil {
 		return err
 	}
@@ -54,8 +95,8 @@ func (crb *ClusterRoleBinding) CreateClusterRoleBinding(clusterRoleBinding *rbac
 	return nil
 }
 
-func (crb *ClusterRoleBinding) UpdateClusterRoleBinding(clusterRoleBinding *rbacv1.ClusterRoleBinding) error {
-	_, err := crb.client.Update(context.TODO(), clusterRoleBinding, metav1.UpdateOptions{})
+func (crb *ClusterRoleBinding) UpdateClusterRoleBinding(ctx context.Context, clusterRoleBinding *rbacv1.ClusterRoleBinding) error {
+	_, err := crb.client.Update(ctx, clusterRoleBinding, metav1.UpdateOptions{})
 	if err != nil {
 		return err
 	}
@@ -63,21 +104,63 @@ func (crb *ClusterRoleBinding) UpdateClusterRoleBinding(clusterRoleBinding *rbac
 	return nil
 }
 
-func (crb *ClusterRoleBinding) ApplyClusterRoleBinding(clusterRoleBinding *rbacv1.ClusterRoleBinding) error {
-	result, _ := crb.GetClusterRoleBinding(clusterRoleBinding.Name)
+// ApplyClusterRoleBinding creates or updates a cluster role binding. Conflicts and transient
+// API errors are retried according to the options of ctx.
+func (crb *ClusterRoleBinding) ApplyClusterRoleBinding(ctx context.Context, clusterRoleBinding *rbacv1.ClusterRoleBinding) (Operation, error) {
+	return retryApply(ctx, "cluster role binding "+clusterRoleBinding.Name, func() (Operation, error) {
+		return crb.applyClusterRoleBinding(ctx, clusterRoleBinding)
+	})
+}
+
+func (crb *ClusterRoleBinding) applyClusterRoleBinding(ctx context.Context, clusterRoleBinding *rbacv1.ClusterRoleBinding) (Operation, error) {
+	result, err := crb.GetClusterRoleBinding(ctx, clusterRoleBinding.Name)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return "", err
+	}
+
 	if result != nil {
+		err = Admit(ctx, rbacv1.SchemeGroupVersion.WithKind("ClusterRoleBinding"), crb.namespace, result.Name, result.Labels, clusterRoleBinding.Labels)
+	} else {
+		err = Admit(ctx, rbacv1.SchemeGroupVersion.WithKind("ClusterRoleBinding"), crb.namespace, clusterRoleBinding.Name, clusterRoleBinding.Labels)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if result != nil {
+		before := result.DeepCopy()
+
 		result.Subjects = clusterRoleBinding.Subjects
 		result.RoleRef = clusterRoleBinding.RoleRef
-		err := crb.UpdateClusterRoleBinding(result)
-		if err != nil {
-			return err
+		if apiequality.Semantic.DeepEqual(before, result) {
+			return OperationUnchanged, nil
 		}
-	} else {
-		err := crb.CreateClusterRoleBinding(clusterRoleBinding)
+		if IsDryRun(ctx) {
+			return OperationUpdated, nil
+		}
+		if err := Snapshot(ctx, rbacv1.SchemeGroupVersion.WithKind("ClusterRoleBinding"), crb.namespace, result.Name, before); err != nil {
+			return "", err
+		}
+
+		err := crb.UpdateClusterRoleBinding(ctx, result)
 		if err != nil {
-			return err
+			return "", err
 		}
+
+		return OperationUpdated, nil
 	}
 
-	return nil
+	if IsDryRun(ctx) {
+		return OperationCreated, nil
+	}
+	if err := Snapshot(ctx, rbacv1.SchemeGroupVersion.WithKind("ClusterRoleBinding"), crb.namespace, clusterRoleBinding.Name, nil); err != nil {
+		return "", err
+	}
+
+	err = crb.CreateClusterRoleBinding(ctx, clusterRoleBinding)
+	if err != nil {
+		return "", err
+	}
+
+	return OperationCreated, nil
 }
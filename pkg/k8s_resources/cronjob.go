@@ -4,40 +4,81 @@ import (
 	"context"
 
 	batchv1 "k8s.io/api/batch/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	typedv1 "k8s.io/client-go/kubernetes/typed/batch/v1"
 
-	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 )
 
 type CronJob struct {
-	client typedv1.CronJobInterface
+	client    typedv1.CronJobInterface
+	namespace string
 }
 
 func NewCronJob(config *rest.Config, namespace string) (*CronJob, error) {
-	clientset, err := kubernetes.NewForConfig(config)
+	cluster, err := ClusterFor(config)
 	if err != nil {
 		return nil, err
 	}
 
 	return &CronJob{
-		client: clientset.BatchV1().CronJobs(namespace),
+		client:    cluster.Clientset.BatchV1().CronJobs(namespace),
+		namespace: namespace,
 	}, nil
 }
 
-func (cj *CronJob) ListCronJobs() (*batchv1.CronJobList, error) {
-	list, err := cj.client.List(context.TODO(), metav1.ListOptions{})
+// ListCronJobs lists all cron jobs in pages of ListPageSize.
+func (cj *CronJob) ListCronJobs(ctx context.Context) (*batchv1.CronJobList, error) {
+	result := &batchv1.CronJobList{}
+	err := listPages(func(opts metav1.ListOptions) (string, error) {
+		list, err := cj.client.List(ctx, opts)
+		if err != nil {
+			return "", err
+		}
+
+		result.Items = append(result.Items, list.Items...)
+		return list.Continue, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// CronJobIndex holds the cron jobs of one List, indexed by name.
+type CronJobIndex map[string]*batchv1.CronJob
+
+// IndexCronJobs lists all cron jobs and indexes them by name.
+func (cj *CronJob) IndexCronJobs(ctx context.Context) (CronJobIndex, error) {
+	list, err := cj.ListCronJobs(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	return list, nil
+	index := CronJobIndex{}
+	for i := range list.Items {
+		index[list.Items[i].Name] = &list.Items[i]
+	}
+
+	return index, nil
+}
+
+// GetCronJob looks up a cron job in the index, returning a NotFound error
+// like the API server if it isn't there.
+func (index CronJobIndex) GetCronJob(ctx context.Context, name string) (*batchv1.CronJob, error) {
+	if result, ok := index[name]; ok {
+		return result, nil
+	}
+
+	return nil, apierrors.NewNotFound(batchv1.Resource("cronjobs"), name)
 }
 
-func (cj *CronJob) GetCronJob(name string) (*batchv1.CronJob, error) {
-	job, err := cj.client.Get(context.TODO(), name, metav1.GetOptions{})
+func (cj *CronJob) GetCronJob(ctx context.Context, name string) (*batchv1.CronJob, error) {
+	job, err := cj.client.Get(ctx, name, metav1.GetOptions{})
 	if err != nil {
 		return nil, err
 	}
@@ -45,8 +86,8 @@ func (cj *CronJob) GetCronJob(name string) (*batchv1.CronJob, error) {
 	return job, nil
 }
 
-func (cj *CronJob) CreateCronJob(job *batchv1.CronJob) error {
-	_, err := cj.client.Create(context.TODO(), job, metav1.CreateOptions{})
+func (cj *CronJob) CreateCronJob(ctx context.Context, job *batchv1.CronJob) error {
+	_, err := cj.client.Create(ctx, job, metav1.CreateOptions{})
 	if err != nil {
 		return err
 	}
@@ -54,8 +95,8 @@ func (cj *CronJob) CreateCronJob(job *batchv1.CronJob) error {
 	return nil
 }
 
-func (cj *CronJob) UpdateCronJob(job *batchv1.CronJob) error {
-	_, err := cj.client.Update(context.TODO(), job, metav1.UpdateOptions{})
+func (cj *CronJob) UpdateCronJob(ctx context.Context, job *batchv1.CronJob) error {
+	_, err := cj.client.Update(ctx, job, metav1.UpdateOptions{})
 	if err != nil {
 		return err
 	}
@@ -63,9 +104,32 @@ func (cj *CronJob) UpdateCronJob(job *batchv1.CronJob) error {
 	return nil
 }
 
-func (cj *CronJob) ApplyCronJob(cronJob *batchv1.CronJob) error {
-	result, _ := cj.GetCronJob(cronJob.Name)
+// ApplyCronJob creates or updates a cron job. Conflicts and transient
+// API errors are retried according to the options of ctx.
+func (cj *CronJob) ApplyCronJob(ctx context.Context, cronJob *batchv1.CronJob) (Operation, error) {
+	return retryApply(ctx, "cron job "+cronJob.Name, func() (Operation, error) {
+		return cj.applyCronJob(ctx, cronJob)
+	})
+}
+
+func (cj *CronJob) applyCronJob(ctx context.Context, cronJob *batchv1.CronJob) (Operation, error) {
+	result, err := cj.GetCronJob(ctx, cronJob.Name)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return "", err
+	}
+
 	if result != nil {
+		err = Admit(ctx, batchv1.SchemeGroupVersion.WithKind("CronJob"), cj.namespace, result.Name, result.Labels, cronJob.Labels)
+	} else {
+		err = Admit(ctx, batchv1.SchemeGroupVersion.WithKind("CronJob"), cj.namespace, cronJob.Name, cronJob.Labels)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if result != nil {
+		before := result.DeepCopy()
+
 		containerImageMap := map[string]string{}
 		for _, c := range cronJob.Spec.JobTemplate.Spec.Template.Spec.Containers {
 			containerImageMap[c.Name] = c.Image
@@ -74,21 +138,42 @@ func (cj *CronJob) ApplyCronJob(cronJob *batchv1.CronJob) error {
 		for i, c := range result.Spec.JobTemplate.Spec.Template.Spec.Containers {
 			result.Spec.JobTemplate.Spec.Template.Spec.Containers[i].Image = containerImageMap[c.Name]
 		}
+		copyInitContainerImages(&result.Spec.JobTemplate.Spec.Template.Spec, &cronJob.Spec.JobTemplate.Spec.Template.Spec)
 
 		result.Spec.Schedule = cronJob.Spec.Schedule
+		copyAnnotation(&result.ObjectMeta, &cronJob.ObjectMeta, PinnedImagesAnnotation)
 
-		err := cj.UpdateCronJob(result)
-		if err != nil {
-			return err
+		if apiequality.Semantic.DeepEqual(before, result) {
+			return OperationUnchanged, nil
 		}
-	} else {
-		err := cj.CreateCronJob(cronJob)
+		if IsDryRun(ctx) {
+			return OperationUpdated, nil
+		}
+		if err := Snapshot(ctx, batchv1.SchemeGroupVersion.WithKind("CronJob"), cj.namespace, result.Name, before); err != nil {
+			return "", err
+		}
+
+		err := cj.UpdateCronJob(ctx, result)
 		if err != nil {
-			return err
+			return "", err
 		}
+
+		return OperationUpdated, nil
 	}
 
-	return nil
+	if IsDryRun(ctx) {
+		return OperationCreated, nil
+	}
+	if err := Snapshot(ctx, batchv1.SchemeGroupVersion.WithKind("CronJob"), cj.namespace, cronJob.Name, nil); err != nil {
+		return "", err
+	}
+
+	err = cj.CreateCronJob(ctx, cronJob)
+	if err != nil {
+		return "", err
+	}
+
+	return OperationCreated, nil
 }
 
 /* Experimental
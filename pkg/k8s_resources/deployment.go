@@ -4,40 +4,81 @@ import (
 	"context"
 
 	appsv1 "k8s.io/api/apps/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	typedv1 "k8s.io/client-go/kubernetes/typed/apps/v1"
 
-	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 )
 
 type Deployment struct {
-	client typedv1.DeploymentInterface
+	client    typedv1.DeploymentInterface
+	namespace string
 }
 
 func NewDeployment(config *rest.Config, namespace string) (*Deployment, error) {
-	clientset, err := kubernetes.NewForConfig(config)
+	cluster, err := ClusterFor(config)
 	if err != nil {
 		return nil, err
 	}
 
 	return &Deployment{
-		client: clientset.AppsV1().Deployments(namespace),
+		client:    cluster.Clientset.AppsV1().Deployments(namespace),
+		namespace: namespace,
 	}, nil
 }
 
-func (d *Deployment) ListDeployments() (*appsv1.DeploymentList, error) {
-	list, err := d.client.List(context.TODO(), metav1.ListOptions{})
+// ListDeployments lists all deployments in pages of ListPageSize.
+func (d *Deployment) ListDeployments(ctx context.Context) (*appsv1.DeploymentList, error) {
+	result := &appsv1.DeploymentList{}
+	err := listPages(func(opts metav1.ListOptions) (string, error) {
+		list, err := d.client.List(ctx, opts)
+		if err != nil {
+			return "", err
+		}
+
+		result.Items = append(result.Items, list.Items...)
+		return list.Continue, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// DeploymentIndex holds the deployments of one List, indexed by name.
+type DeploymentIndex map[string]*appsv1.Deployment
+
+// IndexDeployments lists all deployments and indexes them by name.
+func (d *Deployment) IndexDeployments(ctx context.Context) (DeploymentIndex, error) {
+	list, err := d.ListDeployments(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	return list, nil
+	index := DeploymentIndex{}
+	for i := range list.Items {
+		index[list.Items[i].Name] = &list.Items[i]
+	}
+
+	return index, nil
+}
+
+// GetDeployment looks up a deployment in the index, returning a NotFound error
+// like the API server if it isn't there.
+func (index DeploymentIndex) GetDeployment(ctx context.Context, name string) (*appsv1.Deployment, error) {
+	if result, ok := index[name]; ok {
+		return result, nil
+	}
+
+	return nil, apierrors.NewNotFound(appsv1.Resource("deployments"), name)
 }
 
-func (d *Deployment) GetDeployment(name string) (*appsv1.Deployment, error) {
-	deployment, err := d.client.Get(context.TODO(), name, metav1.GetOptions{})
+func (d *Deployment) GetDeployment(ctx context.Context, name string) (*appsv1.Deployment, error) {
+	deployment, err := d.client.Get(ctx, name, metav1.GetOptions{})
 	if err != nil {
 		return nil, err
 	}
@@ -45,8 +86,8 @@ func (d *Deployment) GetDeployment(name string) (*appsv1.Deployment, error) {
 	return deployment, nil
 }
 
-func (d *Deployment) CreateDeployment(deployment *appsv1.Deployment) error {
-	_, err := d.client.Create(context.TODO(), deployment, metav1.CreateOptions{})
+func (d *Deployment) CreateDeployment(ctx context.Context, deployment *appsv1.Deployment) error {
+	_, err := d.client.Create(ctx, deployment, metav1.CreateOptions{})
 	if err != nil {
 		return err
 	}
@@ -54,8 +95,8 @@ func (d *Deployment) CreateDeployment(deployment *appsv1.Deployment) error {
 	return nil
 }
 
-func (d *Deployment) UpdateDeployment(deployment *appsv1.Deployment) error {
-	_, err := d.client.Update(context.TODO(), deployment, metav1.UpdateOptions{})
+func (d *Deployment) UpdateDeployment(ctx context.Context, deployment *appsv1.Deployment) error {
+	_, err := d.client.Update(ctx, deployment, metav1.UpdateOptions{})
 	if err != nil {
 		return err
 	}
@@ -63,9 +104,32 @@ func (d *Deployment) UpdateDeployment(deployment *appsv1.Deployment) error {
 	return nil
 }
 
-func (d *Deployment) ApplyDeployment(deployment *appsv1.Deployment) error {
-	result, _ := d.GetDeployment(deployment.Name)
+// ApplyDeployment creates or updates a deployment. Conflicts and transient
+// API errors are retried according to the options of ctx.
+func (d *Deployment) ApplyDeployment(ctx context.Context, deployment *appsv1.Deployment) (Operation, error) {
+	return retryApply(ctx, "deployment "+deployment.Name, func() (Operation, error) {
+		return d.applyDeployment(ctx, deployment)
+	})
+}
+
+func (d *Deployment) applyDeployment(ctx context.Context, deployment *appsv1.Deployment) (Operation, error) {
+	result, err := d.GetDeployment(ctx, deployment.Name)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return "", err
+	}
+
 	if result != nil {
+		err = Admit(ctx, appsv1.SchemeGroupVersion.WithKind("Deployment"), d.namespace, result.Name, result.Labels, deployment.Labels)
+	} else {
+		err = Admit(ctx, appsv1.SchemeGroupVersion.WithKind("Deployment"), d.namespace, deployment.Name, deployment.Labels)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if result != nil {
+		before := result.DeepCopy()
+
 		containerImageMap := map[string]string{}
 		for _, c := range deployment.Spec.Template.Spec.Containers {
 			containerImageMap[c.Name] = c.Image
@@ -74,19 +138,40 @@ func (d *Deployment) ApplyDeployment(deployment *appsv1.Deployment) error {
 		for i, c := range result.Spec.Template.Spec.Containers {
 			result.Spec.Template.Spec.Containers[i].Image = containerImageMap[c.Name]
 		}
+		copyInitContainerImages(&result.Spec.Template.Spec, &deployment.Spec.Template.Spec)
 
 		result.Spec.Replicas = deployment.Spec.Replicas
+		copyAnnotation(&result.ObjectMeta, &deployment.ObjectMeta, PinnedImagesAnnotation)
 
-		err := d.UpdateDeployment(result)
-		if err != nil {
-			return err
+		if apiequality.Semantic.DeepEqual(before, result) {
+			return OperationUnchanged, nil
 		}
-	} else {
-		err := d.CreateDeployment(deployment)
+		if IsDryRun(ctx) {
+			return OperationUpdated, nil
+		}
+		if err := Snapshot(ctx, appsv1.SchemeGroupVersion.WithKind("Deployment"), d.namespace, result.Name, before); err != nil {
+			return "", err
+		}
+
+		err := d.UpdateDeployment(ctx, result)
 		if err != nil {
-			return err
+			return "", err
 		}
+
+		return OperationUpdated, nil
 	}
 
-	return nil
+	if IsDryRun(ctx) {
+		return OperationCreated, nil
+	}
+	if err := Snapshot(ctx, appsv1.SchemeGroupVersion.WithKind("Deployment"), d.namespace, deployment.Name, nil); err != nil {
+		return "", err
+	}
+
+	err = d.CreateDeployment(ctx, deployment)
+	if err != nil {
+		return "", err
+	}
+
+	return OperationCreated, nil
 }
@@ -0,0 +1,17 @@
+package k8s_resources
+
+import "context"
+
+type dryRunKey struct{}
+
+// WithDryRun returns a context under which the Apply* methods only work out
+// the Operation they would perform, without changing the cluster.
+func WithDryRun(parent context.Context) context.Context {
+	return context.WithValue(parent, dryRunKey{}, true)
+}
+
+// IsDryRun reports whether ctx was returned by WithDryRun.
+func IsDryRun(ctx context.Context) bool {
+	dryRun, _ := ctx.Value(dryRunKey{}).(bool)
+	return dryRun
+}
@@ -0,0 +1,27 @@
+package k8s_resources
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// Guard decides which objects of the target cluster may be changed at all.
+type Guard interface {
+	// Admit is called before an object is created, updated or deleted, with
+	// the labels of its current state and of the state it is about to get,
+	// whichever are known. An error refuses the change.
+	Admit(gvk schema.GroupVersionKind, namespace, name string, labels ...map[string]string) error
+}
+
+// Admit asks the Guards of the options of ctx whether an object may be
+// changed. It is called by the Apply* methods, and must be called by any
+// other code changing the target cluster.
+func Admit(ctx context.Context, gvk schema.GroupVersionKind, namespace, name string, labels ...map[string]string) error {
+	guards := OptionsFrom(ctx).Guards
+	if guards == nil {
+		return nil
+	}
+
+	return guards.Admit(gvk, namespace, name, labels...)
+}
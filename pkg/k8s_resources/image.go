@@ -0,0 +1,42 @@
+package k8s_resources
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// PinnedImagesAnnotation records the images of the containers of a workload
+// before they were pinned to digests, as comma separated container=image
+// pairs.
+const PinnedImagesAnnotation = "k8s-resources-sync/pinned-images"
+
+// copyAnnotation sets the annotation key of current to its value in desired,
+// or removes it if desired doesn't have it.
+func copyAnnotation(current, desired *metav1.ObjectMeta, key string) {
+	value, ok := desired.Annotations[key]
+	if !ok {
+		delete(current.Annotations, key)
+		return
+	}
+
+	if current.Annotations == nil {
+		current.Annotations = map[string]string{}
+	}
+	current.Annotations[key] = value
+}
+
+// copyInitContainerImages sets the image of each init container of current to
+// the one of the init container of the same name in desired, if any, so that
+// rewritten registries apply to them as well.
+func copyInitContainerImages(current, desired *corev1.PodSpec) {
+	images := map[string]string{}
+	for _, c := range desired.InitContainers {
+		images[c.Name] = c.Image
+	}
+
+	for i, c := range current.InitContainers {
+		if image, ok := images[c.Name]; ok {
+			current.InitContainers[i].Image = image
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package k8s_resources
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	typedv1 "k8s.io/client-go/kubernetes/typed/batch/v1"
+
+	"k8s.io/client-go/rest"
+)
+
+const jobPollInterval = 2 * time.Second
+
+type Job struct {
+	client    typedv1.JobInterface
+	namespace string
+}
+
+func NewJob(config *rest.Config, namespace string) (*Job, error) {
+	cluster, err := ClusterFor(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Job{
+		client:    cluster.Clientset.BatchV1().Jobs(namespace),
+		namespace: namespace,
+	}, nil
+}
+
+// ListJobs lists all jobs in pages of ListPageSize.
+func (j *Job) ListJobs(ctx context.Context) (*batchv1.JobList, error) {
+	result := &batchv1.JobList{}
+	err := listPages(func(opts metav1.ListOptions) (string, error) {
+		list, err := j.client.List(ctx, opts)
+		if err != nil {
+			return "", err
+		}
+
+		result.Items = append(result.Items, list.Items...)
+		return list.Continue, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// JobIndex holds the jobs of one List, indexed by name.
+type JobIndex map[string]*batchv1.Job
+
+// IndexJobs lists all jobs and indexes them by name.
+func (j *Job) IndexJobs(ctx context.Context) (JobIndex, error) {
+	list, err := j.ListJobs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	index := JobIndex{}
+	for i := range list.Items {
+		index[list.Items[i].Name] = &list.Items[i]
+	}
+
+	return index, nil
+}
+
+// GetJob looks up a job in the index, returning a NotFound error
+// like the API server if it isn't there.
+func (index JobIndex) GetJob(ctx context.Context, name string) (*batchv1.Job, error) {
+	if result, ok := index[name]; ok {
+		return result, nil
+	}
+
+	return nil, apierrors.NewNotFound(batchv1.Resource("jobs"), name)
+}
+
+func (j *Job) GetJob(ctx context.Context, name string) (*batchv1.Job, error) {
+	job, err := j.client.Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	return job, nil
+}
+
+func (j *Job) CreateJob(ctx context.Context, job *batchv1.Job) error {
+	_, err := j.client.Create(ctx, job, metav1.CreateOptions{})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// CreateNewJob creates a job that must not exist yet, e.g. under a suffixed
+// name. Transient API errors are retried according to the options of ctx,
+// and a job found by a retry is the one an earlier attempt created.
+func (j *Job) CreateNewJob(ctx context.Context, job *batchv1.Job) (Operation, error) {
+	err := Admit(ctx, batchv1.SchemeGroupVersion.WithKind("Job"), j.namespace, job.Name, job.Labels)
+	if err != nil {
+		return "", err
+	}
+
+	if IsDryRun(ctx) {
+		return OperationCreated, nil
+	}
+
+	err = Snapshot(ctx, batchv1.SchemeGroupVersion.WithKind("Job"), j.namespace, job.Name, nil)
+	if err != nil {
+		return "", err
+	}
+
+	attempt := 0
+	return retryApply(ctx, "job "+job.Name, func() (Operation, error) {
+		attempt++
+		err := j.CreateJob(ctx, job)
+		if apierrors.IsAlreadyExists(err) {
+			if attempt > 1 {
+				return OperationCreated, nil
+			}
+			return "", fmt.Errorf("job %s already exists", job.Name)
+		}
+		if err != nil {
+			return "", err
+		}
+
+		return OperationCreated, nil
+	})
+}
+
+// DeleteJob deletes a job together with its pods and waits until the job
+// is gone, so that a job with the same name can be created again.
+func (j *Job) DeleteJob(ctx context.Context, name string, timeout time.Duration) error {
+	propagation := metav1.DeletePropagationForeground
+	err := j.client.Delete(ctx, name, metav1.DeleteOptions{PropagationPolicy: &propagation})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+
+	return Poll(ctx, jobPollInterval, timeout, func() (bool, error) {
+		_, err := j.client.Get(ctx, name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return true, nil
+		}
+		return false, err
+	})
+}
+
+// ApplyJob creates a job, deleting any existing job with the same name
+// first since the pod template of a job is immutable. Conflicts and transient
+// API errors are retried according to the options of ctx.
+func (j *Job) ApplyJob(ctx context.Context, job *batchv1.Job, timeout time.Duration) (Operation, error) {
+	return retryApply(ctx, "job "+job.Name, func() (Operation, error) {
+		return j.applyJob(ctx, job, timeout)
+	})
+}
+
+func (j *Job) applyJob(ctx context.Context, job *batchv1.Job, timeout time.Duration) (Operation, error) {
+	result, err := j.GetJob(ctx, job.Name)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return "", err
+	}
+
+	if result != nil {
+		err = Admit(ctx, batchv1.SchemeGroupVersion.WithKind("Job"), j.namespace, result.Name, result.Labels, job.Labels)
+	} else {
+		err = Admit(ctx, batchv1.SchemeGroupVersion.WithKind("Job"), j.namespace, job.Name, job.Labels)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if IsDryRun(ctx) {
+		if result != nil {
+			return OperationUpdated, nil
+		}
+		return OperationCreated, nil
+	}
+
+	if result != nil {
+		if err := Snapshot(ctx, batchv1.SchemeGroupVersion.WithKind("Job"), j.namespace, result.Name, result); err != nil {
+			return "", err
+		}
+
+		err := j.DeleteJob(ctx, job.Name, timeout)
+		if err != nil {
+			return "", err
+		}
+	} else if err := Snapshot(ctx, batchv1.SchemeGroupVersion.WithKind("Job"), j.namespace, job.Name, nil); err != nil {
+		return "", err
+	}
+
+	err = j.CreateJob(ctx, job)
+	if err != nil {
+		return "", err
+	}
+
+	if result != nil {
+		return OperationUpdated, nil
+	}
+
+	return OperationCreated, nil
+}
+
+// JobFinished reports whether a job has completed, returning an error if
+// it has failed.
+func JobFinished(job *batchv1.Job) (bool, error) {
+	for _, c := range job.Status.Conditions {
+		if c.Status != corev1.ConditionTrue {
+			continue
+		}
+
+		switch c.Type {
+		case batchv1.JobComplete:
+			return true, nil
+		case batchv1.JobFailed:
+			return true, fmt.Errorf("job %s failed: %s", job.Name, c.Message)
+		}
+	}
+
+	return false, nil
+}
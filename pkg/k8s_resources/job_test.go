@@ -0,0 +1,49 @@
+package k8s_resources
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestCreateNewJob(t *testing.T) {
+	backoff := DefaultRetryBackoff
+	backoff.Duration = time.Millisecond
+	ctx := WithOptions(context.Background(), Options{RetryBackoff: backoff})
+
+	clientset := fake.NewSimpleClientset()
+	// The first create is throttled.
+	creates := 0
+	clientset.PrependReactor("create", "jobs", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		creates++
+		if creates == 1 {
+			return true, nil, apierrors.NewTooManyRequests("throttled", 1)
+		}
+		return false, nil, nil
+	})
+	job := &Job{client: clientset.BatchV1().Jobs("default"), namespace: "default"}
+
+	op, err := job.CreateNewJob(ctx, &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "migrate-1"}})
+	if err != nil || op != OperationCreated {
+		t.Fatalf("CreateNewJob() = %q, %v, want created", op, err)
+	}
+	if creates != 2 {
+		t.Errorf("created %d times, want 2", creates)
+	}
+
+	// A job that exists before the first attempt isn't taken for ours.
+	_, err = job.CreateNewJob(ctx, &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "migrate-1"}})
+	if err == nil {
+		t.Errorf("CreateNewJob() of an existing job succeeded")
+	}
+	if creates != 3 {
+		t.Errorf("created %d times, want 3: an existing job isn't retried", creates)
+	}
+}
@@ -0,0 +1,58 @@
+package k8s_resources
+
+import (
+	"context"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	typedv1 "k8s.io/client-go/kubernetes/typed/coordination/v1"
+
+	"k8s.io/client-go/rest"
+)
+
+type Lease struct {
+	client    typedv1.LeaseInterface
+	namespace string
+}
+
+func NewLease(config *rest.Config, namespace string) (*Lease, error) {
+	cluster, err := ClusterFor(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Lease{
+		client:    cluster.Clientset.CoordinationV1().Leases(namespace),
+		namespace: namespace,
+	}, nil
+}
+
+func (l *Lease) GetLease(ctx context.Context, name string) (*coordinationv1.Lease, error) {
+	lease, err := l.client.Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	return lease, nil
+}
+
+// CreateLease creates lease and returns it as stored, so that it can be
+// updated without reading it again.
+func (l *Lease) CreateLease(ctx context.Context, lease *coordinationv1.Lease) (*coordinationv1.Lease, error) {
+	return l.client.Create(ctx, lease, metav1.CreateOptions{})
+}
+
+// UpdateLease updates lease and returns it as stored. The update fails with
+// a Conflict error if lease was changed since it was read.
+func (l *Lease) UpdateLease(ctx context.Context, lease *coordinationv1.Lease) (*coordinationv1.Lease, error) {
+	return l.client.Update(ctx, lease, metav1.UpdateOptions{})
+}
+
+// DeleteLease deletes the lease name, provided it is still at
+// resourceVersion.
+func (l *Lease) DeleteLease(ctx context.Context, name, resourceVersion string) error {
+	return l.client.Delete(ctx, name, metav1.DeleteOptions{
+		Preconditions: &metav1.Preconditions{ResourceVersion: &resourceVersion},
+	})
+}
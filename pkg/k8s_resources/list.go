@@ -0,0 +1,25 @@
+package k8s_resources
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ListPageSize is the maximum number of objects fetched per List request.
+const ListPageSize = 500
+
+// listPages calls list for every page of a paginated List. list returns
+// the continue token of the page it fetched.
+func listPages(list func(opts metav1.ListOptions) (string, error)) error {
+	opts := metav1.ListOptions{Limit: ListPageSize}
+	for {
+		next, err := list(opts)
+		if err != nil {
+			return err
+		}
+
+		if len(next) == 0 {
+			return nil
+		}
+		opts.Continue = next
+	}
+}
@@ -0,0 +1,45 @@
+package k8s_resources
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	typedv1 "k8s.io/client-go/kubernetes/typed/core/v1"
+
+	"k8s.io/client-go/rest"
+)
+
+type Namespace struct {
+	client typedv1.NamespaceInterface
+}
+
+func NewNamespace(config *rest.Config) (*Namespace, error) {
+	cluster, err := ClusterFor(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Namespace{
+		client: cluster.Clientset.CoreV1().Namespaces(),
+	}, nil
+}
+
+func (n *Namespace) ListNamespaces(ctx context.Context, labelSelector string) (*corev1.NamespaceList, error) {
+	list, err := n.client.List(ctx, metav1.ListOptions{LabelSelector: labelSelector})
+	if err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+func (n *Namespace) GetNamespace(ctx context.Context, name string) (*corev1.Namespace, error) {
+	namespace, err := n.client.Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	return namespace, nil
+}
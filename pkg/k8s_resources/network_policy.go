@@ -0,0 +1,165 @@
+package k8s_resources
+
+import (
+	"context"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	typedv1 "k8s.io/client-go/kubernetes/typed/networking/v1"
+
+	"k8s.io/client-go/rest"
+)
+
+type NetworkPolicy struct {
+	client    typedv1.NetworkPolicyInterface
+	namespace string
+}
+
+func NewNetworkPolicy(config *rest.Config, namespace string) (*NetworkPolicy, error) {
+	cluster, err := ClusterFor(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &NetworkPolicy{
+		client:    cluster.Clientset.NetworkingV1().NetworkPolicies(namespace),
+		namespace: namespace,
+	}, nil
+}
+
+// ListNetworkPolicies lists all network policies in pages of ListPageSize.
+func (np *NetworkPolicy) ListNetworkPolicies(ctx context.Context) (*networkingv1.NetworkPolicyList, error) {
+	result := &networkingv1.NetworkPolicyList{}
+	err := listPages(func(opts metav1.ListOptions) (string, error) {
+		list, err := np.client.List(ctx, opts)
+		if err != nil {
+			return "", err
+		}
+
+		result.Items = append(result.Items, list.Items...)
+		return list.Continue, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// NetworkPolicyIndex holds the network policies of one List, indexed by name.
+type NetworkPolicyIndex map[string]*networkingv1.NetworkPolicy
+
+// IndexNetworkPolicies lists all network policies and indexes them by name.
+func (np *NetworkPolicy) IndexNetworkPolicies(ctx context.Context) (NetworkPolicyIndex, error) {
+	list, err := np.ListNetworkPolicies(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	index := NetworkPolicyIndex{}
+	for i := range list.Items {
+		index[list.Items[i].Name] = &list.Items[i]
+	}
+
+	return index, nil
+}
+
+// GetNetworkPolicy looks up a network policy in the index, returning a NotFound error
+// like the API server if it isn't there.
+func (index NetworkPolicyIndex) GetNetworkPolicy(ctx context.Context, name string) (*networkingv1.NetworkPolicy, error) {
+	if result, ok := index[name]; ok {
+		return result, nil
+	}
+
+	return nil, apierrors.NewNotFound(networkingv1.Resource("networkpolicies"), name)
+}
+
+func (np *NetworkPolicy) GetNetworkPolicy(ctx context.Context, name string) (*networkingv1.NetworkPolicy, error) {
+	networkPolicy, err := np.client.Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	return networkPolicy, nil
+}
+
+func (np *NetworkPolicy) CreateNetworkPolicy(ctx context.Context, networkPolicy *networkingv1.NetworkPolicy) error {
+	_, err := np.client.Create(ctx, networkPolicy, metav1.CreateOptions{})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (np *NetworkPolicy) UpdateNetworkPolicy(ctx context.Context, networkPolicy *networkingv1.NetworkPolicy) error {
+	_, err := np.client.Update(ctx, networkPolicy, metav1.UpdateOptions{})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ApplyNetworkPolicy creates or updates a network policy. Conflicts and transient
+// API errors are retried according to the options of ctx.
+func (np *NetworkPolicy) ApplyNetworkPolicy(ctx context.Context, networkPolicy *networkingv1.NetworkPolicy) (Operation, error) {
+	return retryApply(ctx, "network policy "+networkPolicy.Name, func() (Operation, error) {
+		return np.applyNetworkPolicy(ctx, networkPolicy)
+	})
+}
+
+func (np *NetworkPolicy) applyNetworkPolicy(ctx context.Context, networkPolicy *networkingv1.NetworkPolicy) (Operation, error) {
+	result, err := np.GetNetworkPolicy(ctx, networkPolicy.Name)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return "", err
+	}
+
+	if result != nil {
+		err = Admit(ctx, networkingv1.SchemeGroupVersion.WithKind("NetworkPolicy"), np.namespace, result.Name, result.Labels, networkPolicy.Labels)
+	} else {
+		err = Admit(ctx, networkingv1.SchemeGroupVersion.WithKind("NetworkPolicy"), np.namespace, networkPolicy.Name, networkPolicy.Labels)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if result != nil {
+		before := result.DeepCopy()
+
+		result.Spec = networkPolicy.Spec
+		if apiequality.Semantic.DeepEqual(before, result) {
+			return OperationUnchanged, nil
+		}
+		if IsDryRun(ctx) {
+			return OperationUpdated, nil
+		}
+		if err := Snapshot(ctx, networkingv1.SchemeGroupVersion.WithKind("NetworkPolicy"), np.namespace, result.Name, before); err != nil {
+			return "", err
+		}
+
+		err := np.UpdateNetworkPolicy(ctx, result)
+		if err != nil {
+			return "", err
+		}
+
+		return OperationUpdated, nil
+	}
+
+	if IsDryRun(ctx) {
+		return OperationCreated, nil
+	}
+	if err := Snapshot(ctx, networkingv1.SchemeGroupVersion.WithKind("NetworkPolicy"), np.namespace, networkPolicy.Name, nil); err != nil {
+		return "", err
+	}
+
+	err = np.CreateNetworkPolicy(ctx, networkPolicy)
+	if err != nil {
+		return "", err
+	}
+
+	return OperationCreated, nil
+}
@@ -0,0 +1,10 @@
+package k8s_resources
+
+// Operation is the change an Apply* method made to the cluster.
+type Operation string
+
+const (
+	OperationCreated   Operation = "created"
+	OperationUpdated   Operation = "updated"
+	OperationUnchanged Operation = "unchanged"
+)
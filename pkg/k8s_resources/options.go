@@ -0,0 +1,48 @@
+package k8s_resources
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+type optionsKey struct{}
+
+// Options configure the Apply* methods, and the helpers built on them, for
+// the calls made under a context returned by WithOptions. Every run sets its
+// own, so that concurrent runs in one process, e.g. in a controller, don't
+// share their backups, policies, retries or concurrency.
+type Options struct {
+	// Snapshots is called by every Apply* method before it changes the
+	// cluster. A nil Snapshots takes no snapshots.
+	Snapshots Snapshotter
+	// Guards is consulted by every Apply* method before it changes the
+	// cluster, also in dry runs. A nil Guards admits every change.
+	Guards Guard
+	// RetryBackoff is the backoff between the attempts of Retry, Steps is
+	// the maximum number of attempts. A zero RetryBackoff is
+	// DefaultRetryBackoff.
+	RetryBackoff wait.Backoff
+	// Concurrency is the number of objects of one kind applied in parallel,
+	// 1 if not set.
+	Concurrency int
+}
+
+// WithOptions returns a context under which the Apply* methods use opts.
+func WithOptions(parent context.Context, opts Options) context.Context {
+	return context.WithValue(parent, optionsKey{}, opts)
+}
+
+// OptionsFrom returns the options of ctx, see WithOptions, with the defaults
+// filled in.
+func OptionsFrom(ctx context.Context) Options {
+	opts, _ := ctx.Value(optionsKey{}).(Options)
+	if opts.RetryBackoff == (wait.Backoff{}) {
+		opts.RetryBackoff = DefaultRetryBackoff
+	}
+	if opts.Concurrency < 1 {
+		opts.Concurrency = 1
+	}
+
+	return opts
+}
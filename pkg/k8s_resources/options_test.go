@@ -0,0 +1,57 @@
+package k8s_resources
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+type denyAll struct{}
+
+func (denyAll) Admit(gvk schema.GroupVersionKind, namespace, name string, labels ...map[string]string) error {
+	return errors.New("denied")
+}
+
+type recorder []string
+
+func (r *recorder) Snapshot(gvk schema.GroupVersionKind, namespace, name string, current runtime.Object) error {
+	*r = append(*r, name)
+	return nil
+}
+
+func TestOptionsPerContext(t *testing.T) {
+	gvk := schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}
+	first, second := &recorder{}, &recorder{}
+	guarded := WithOptions(context.Background(), Options{Guards: denyAll{}, Snapshots: first})
+	open := WithOptions(context.Background(), Options{Snapshots: second, Concurrency: 4})
+
+	if err := Admit(guarded, gvk, "default", "a"); err == nil {
+		t.Errorf("Admit() under the guarded context succeeded")
+	}
+	if err := Admit(open, gvk, "default", "a"); err != nil {
+		t.Errorf("Admit() under the open context failed: %s", err)
+	}
+
+	Snapshot(guarded, gvk, "default", "a", nil)
+	Snapshot(open, gvk, "default", "b", nil)
+	if len(*first) != 1 || (*first)[0] != "a" || len(*second) != 1 || (*second)[0] != "b" {
+		t.Errorf("snapshots = %q, %q, want [a], [b]", *first, *second)
+	}
+
+	if got := OptionsFrom(open).Concurrency; got != 4 {
+		t.Errorf("Concurrency = %d, want 4", got)
+	}
+}
+
+func TestOptionsDefaults(t *testing.T) {
+	opts := OptionsFrom(context.Background())
+	if opts.RetryBackoff != DefaultRetryBackoff || opts.Concurrency != 1 || opts.Guards != nil || opts.Snapshots != nil {
+		t.Errorf("OptionsFrom() = %+v, want the defaults", opts)
+	}
+	if err := Snapshot(context.Background(), schema.GroupVersionKind{Kind: "ConfigMap"}, "", "a", nil); err != nil {
+		t.Errorf("Snapshot() without options failed: %s", err)
+	}
+}
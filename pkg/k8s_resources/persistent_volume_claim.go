@@ -0,0 +1,169 @@
+package k8s_resources
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	typedv1 "k8s.io/client-go/kubernetes/typed/core/v1"
+
+	"k8s.io/client-go/rest"
+)
+
+type PersistentVolumeClaim struct {
+	client    typedv1.PersistentVolumeClaimInterface
+	namespace string
+}
+
+func NewPersistentVolumeClaim(config *rest.Config, namespace string) (*PersistentVolumeClaim, error) {
+	cluster, err := ClusterFor(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PersistentVolumeClaim{
+		client:    cluster.Clientset.CoreV1().PersistentVolumeClaims(namespace),
+		namespace: namespace,
+	}, nil
+}
+
+// ListPersistentVolumeClaims lists all persistent volume claims in pages of ListPageSize.
+func (p *PersistentVolumeClaim) ListPersistentVolumeClaims(ctx context.Context) (*corev1.PersistentVolumeClaimList, error) {
+	result := &corev1.PersistentVolumeClaimList{}
+	err := listPages(func(opts metav1.ListOptions) (string, error) {
+		list, err := p.client.List(ctx, opts)
+		if err != nil {
+			return "", err
+		}
+
+		result.Items = append(result.Items, list.Items...)
+		return list.Continue, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// PersistentVolumeClaimIndex holds the persistent volume claims of one List, indexed by name.
+type PersistentVolumeClaimIndex map[string]*corev1.PersistentVolumeClaim
+
+// IndexPersistentVolumeClaims lists all persistent volume claims and indexes them by name.
+func (p *PersistentVolumeClaim) IndexPersistentVolumeClaims(ctx context.Context) (PersistentVolumeClaimIndex, error) {
+	list, err := p.ListPersistentVolumeClaims(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	index := PersistentVolumeClaimIndex{}
+	for i := range list.Items {
+		index[list.Items[i].Name] = &list.Items[i]
+	}
+
+	return index, nil
+}
+
+// GetPersistentVolumeClaim looks up a persistent volume claim in the index, returning a NotFound error
+// like the API server if it isn't there.
+func (index PersistentVolumeClaimIndex) GetPersistentVolumeClaim(ctx context.Context, name string) (*corev1.PersistentVolumeClaim, error) {
+	if result, ok := index[name]; ok {
+		return result, nil
+	}
+
+	return nil, apierrors.NewNotFound(corev1.Resource("persistentvolumeclaims"), name)
+}
+
+func (p *PersistentVolumeClaim) GetPersistentVolumeClaim(ctx context.Context, name string) (*corev1.PersistentVolumeClaim, error) {
+	claim, err := p.client.Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	return claim, nil
+}
+
+func (p *PersistentVolumeClaim) CreatePersistentVolumeClaim(ctx context.Context, claim *corev1.PersistentVolumeClaim) error {
+	_, err := p.client.Create(ctx, claim, metav1.CreateOptions{})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (p *PersistentVolumeClaim) UpdatePersistentVolumeClaim(ctx context.Context, claim *corev1.PersistentVolumeClaim) error {
+	_, err := p.client.Update(ctx, claim, metav1.UpdateOptions{})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ApplyPersistentVolumeClaim creates a claim, or grows the storage request of
+// an existing one since the rest of a bound claim's spec is immutable. Conflicts and transient
+// API errors are retried according to the options of ctx.
+func (p *PersistentVolumeClaim) ApplyPersistentVolumeClaim(ctx context.Context, claim *corev1.PersistentVolumeClaim) (Operation, error) {
+	return retryApply(ctx, "persistent volume claim "+claim.Name, func() (Operation, error) {
+		return p.applyPersistentVolumeClaim(ctx, claim)
+	})
+}
+
+func (p *PersistentVolumeClaim) applyPersistentVolumeClaim(ctx context.Context, claim *corev1.PersistentVolumeClaim) (Operation, error) {
+	result, err := p.GetPersistentVolumeClaim(ctx, claim.Name)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return "", err
+	}
+
+	if result != nil {
+		err = Admit(ctx, corev1.SchemeGroupVersion.WithKind("PersistentVolumeClaim"), p.namespace, result.Name, result.Labels, claim.Labels)
+	} else {
+		err = Admit(ctx, corev1.SchemeGroupVersion.WithKind("PersistentVolumeClaim"), p.namespace, claim.Name, claim.Labels)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if result != nil {
+		request := claim.Spec.Resources.Requests[corev1.ResourceStorage]
+		current := result.Spec.Resources.Requests[corev1.ResourceStorage]
+		if request.Cmp(current) <= 0 {
+			return OperationUnchanged, nil
+		}
+		if IsDryRun(ctx) {
+			return OperationUpdated, nil
+		}
+
+		if err := Snapshot(ctx, corev1.SchemeGroupVersion.WithKind("PersistentVolumeClaim"), p.namespace, result.Name, result); err != nil {
+			return "", err
+		}
+
+		if result.Spec.Resources.Requests == nil {
+			result.Spec.Resources.Requests = corev1.ResourceList{}
+		}
+		result.Spec.Resources.Requests[corev1.ResourceStorage] = request
+		err := p.UpdatePersistentVolumeClaim(ctx, result)
+		if err != nil {
+			return "", err
+		}
+
+		return OperationUpdated, nil
+	}
+
+	if IsDryRun(ctx) {
+		return OperationCreated, nil
+	}
+	if err := Snapshot(ctx, corev1.SchemeGroupVersion.WithKind("PersistentVolumeClaim"), p.namespace, claim.Name, nil); err != nil {
+		return "", err
+	}
+
+	err = p.CreatePersistentVolumeClaim(ctx, claim)
+	if err != nil {
+		return "", err
+	}
+
+	return OperationCreated, nil
+}
@@ -0,0 +1,54 @@
+package k8s_resources
+
+import (
+	"context"
+	"io"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	typedv1 "k8s.io/client-go/kubernetes/typed/core/v1"
+
+	"k8s.io/client-go/rest"
+)
+
+type Pod struct {
+	client typedv1.PodInterface
+}
+
+func NewPod(config *rest.Config, namespace string) (*Pod, error) {
+	cluster, err := ClusterFor(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Pod{
+		client: cluster.Clientset.CoreV1().Pods(namespace),
+	}, nil
+}
+
+func (p *Pod) ListPods(ctx context.Context, labelSelector string) (*corev1.PodList, error) {
+	list, err := p.client.List(ctx, metav1.ListOptions{LabelSelector: labelSelector})
+	if err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+func (p *Pod) GetPod(ctx context.Context, name string) (*corev1.Pod, error) {
+	pod, err := p.client.Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	return pod, nil
+}
+
+// StreamPodLogs follows the logs of a pod's container until it terminates.
+func (p *Pod) StreamPodLogs(ctx context.Context, name, container string) (io.ReadCloser, error) {
+	return p.client.GetLogs(name, &corev1.PodLogOptions{
+		Container: container,
+		Follow:    true,
+	}).Stream(ctx)
+}
@@ -0,0 +1,84 @@
+package k8s_resources
+
+import (
+	"context"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+)
+
+// DefaultRetryBackoff is the backoff between the attempts of Retry when the
+// options of its context have none. Steps is the maximum number of attempts.
+var DefaultRetryBackoff = wait.Backoff{
+	Steps:    5,
+	Duration: 500 * time.Millisecond,
+	Factor:   2,
+	Jitter:   0.1,
+	Cap:      30 * time.Second,
+}
+
+// Retriable reports whether err is worth retrying: a resourceVersion
+// conflict, a create racing with another writer, throttling, or a server
+// side or network error that is likely transient.
+func Retriable(err error) bool {
+	switch {
+	case apierrors.IsConflict(err), apierrors.IsAlreadyExists(err):
+		return true
+	case apierrors.IsTooManyRequests(err), apierrors.IsServerTimeout(err), apierrors.IsTimeout(err):
+		return true
+	case apierrors.IsInternalError(err), apierrors.IsServiceUnavailable(err), apierrors.IsUnexpectedServerError(err):
+		return true
+	case utilnet.IsConnectionReset(err), utilnet.IsProbableEOF(err):
+		return true
+	}
+
+	return false
+}
+
+// Retry calls fn until it succeeds, returns an error that isn't Retriable,
+// or the RetryBackoff of the options of ctx runs out of steps. fn must
+// re-read the object it changes, so that a retry after a conflict merges
+// into the latest version.
+func Retry(ctx context.Context, description string, fn func() error) error {
+	backoff := OptionsFrom(ctx).RetryBackoff
+	attempts := backoff.Steps
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = fn()
+		if err == nil || !Retriable(err) || attempt >= attempts {
+			return err
+		}
+
+		delay := backoff.Step()
+		klog.Warningf("Failed to apply %s (attempt %d/%d), retrying in %s. Err was: %s", description, attempt, attempts, delay, err)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+func retryApply(ctx context.Context, description string, apply func() (Operation, error)) (Operation, error) {
+	var op Operation
+	err := Retry(ctx, description, func() error {
+		var err error
+		op, err = apply()
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return op, nil
+}
@@ -0,0 +1,165 @@
+package k8s_resources
+
+import (
+	"context"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	typedv1 "k8s.io/client-go/kubernetes/typed/rbac/v1"
+
+	"k8s.io/client-go/rest"
+)
+
+type Role struct {
+	client    typedv1.RoleInterface
+	namespace string
+}
+
+func NewRole(config *rest.Config, namespace string) (*Role, error) {
+	cluster, err := ClusterFor(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Role{
+		client:    cluster.Clientset.RbacV1().Roles(namespace),
+		namespace: namespace,
+	}, nil
+}
+
+// ListRoles lists all roles in pages of ListPageSize.
+func (r *Role) ListRoles(ctx context.Context) (*rbacv1.RoleList, error) {
+	result := &rbacv1.RoleList{}
+	err := listPages(func(opts metav1.ListOptions) (string, error) {
+		list, err := r.client.List(ctx, opts)
+		if err != nil {
+			return "", err
+		}
+
+		result.Items = append(result.Items, list.Items...)
+		return list.Continue, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// RoleIndex holds the roles of one List, indexed by name.
+type RoleIndex map[string]*rbacv1.Role
+
+// IndexRoles lists all roles and indexes them by name.
+func (r *Role) IndexRoles(ctx context.Context) (RoleIndex, error) {
+	list, err := r.ListRoles(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	index := RoleIndex{}
+	for i := range list.Items {
+		index[list.Items[i].Name] = &list.Items[i]
+	}
+
+	return index, nil
+}
+
+// GetRole looks up a role in the index, returning a NotFound error
+// like the API server if it isn't there.
+func (index RoleIndex) GetRole(ctx context.Context, name string) (*rbacv1.Role, error) {
+	if result, ok := index[name]; ok {
+		return result, nil
+	}
+
+	return nil, apierrors.NewNotFound(rbacv1.Resource("roles"), name)
+}
+
+func (r *Role) GetRole(ctx context.Context, name string) (*rbacv1.Role, error) {
+	role, err := r.client.Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	return role, nil
+}
+
+func (r *Role) CreateRole(ctx context.Context, role *rbacv1.Role) error {
+	_, err := r.client.Create(ctx, role, metav1.CreateOptions{})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *Role) UpdateRole(ctx context.Context, role *rbacv1.Role) error {
+	_, err := r.client.Update(ctx, role, metav1.UpdateOptions{})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ApplyRole creates or updates a role. Conflicts and transient
+// API errors are retried according to the options of ctx.
+func (r *Role) ApplyRole(ctx context.Context, role *rbacv1.Role) (Operation, error) {
+	return retryApply(ctx, "role "+role.Name, func() (Operation, error) {
+		return r.applyRole(ctx, role)
+	})
+}
+
+func (r *Role) applyRole(ctx context.Context, role *rbacv1.Role) (Operation, error) {
+	result, err := r.GetRole(ctx, role.Name)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return "", err
+	}
+
+	if result != nil {
+		err = Admit(ctx, rbacv1.SchemeGroupVersion.WithKind("Role"), r.namespace, result.Name, result.Labels, role.Labels)
+	} else {
+		err = Admit(ctx, rbacv1.SchemeGroupVersion.WithKind("Role"), r.namespace, role.Name, role.Labels)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if result != nil {
+		before := result.DeepCopy()
+
+		result.Rules = role.Rules
+		if apiequality.Semantic.DeepEqual(before, result) {
+			return OperationUnchanged, nil
+		}
+		if IsDryRun(ctx) {
+			return OperationUpdated, nil
+		}
+		if err := Snapshot(ctx, rbacv1.SchemeGroupVersion.WithKind("Role"), r.namespace, result.Name, before); err != nil {
+			return "", err
+		}
+
+		err := r.UpdateRole(ctx, result)
+		if err != nil {
+			return "", err
+		}
+
+		return OperationUpdated, nil
+	}
+
+	if IsDryRun(ctx) {
+		return OperationCreated, nil
+	}
+	if err := Snapshot(ctx, rbacv1.SchemeGroupVersion.WithKind("Role"), r.namespace, role.Name, nil); err != nil {
+		return "", err
+	}
+
+	err = r.CreateRole(ctx, role)
+	if err != nil {
+		return "", err
+	}
+
+	return OperationCreated, nil
+}
@@ -0,0 +1,166 @@
+package k8s_resources
+
+import (
+	"context"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	typedv1 "k8s.io/client-go/kubernetes/typed/rbac/v1"
+
+	"k8s.io/client-go/rest"
+)
+
+type RoleBinding struct {
+	client    typedv1.RoleBindingInterface
+	namespace string
+}
+
+func NewRoleBinding(config *rest.Config, namespace string) (*RoleBinding, error) {
+	cluster, err := ClusterFor(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RoleBinding{
+		client:    cluster.Clientset.RbacV1().RoleBindings(namespace),
+		namespace: namespace,
+	}, nil
+}
+
+// ListRoleBindings lists all role bindings in pages of ListPageSize.
+func (rb *RoleBinding) ListRoleBindings(ctx context.Context) (*rbacv1.RoleBindingList, error) {
+	result := &rbacv1.RoleBindingList{}
+	err := listPages(func(opts metav1.ListOptions) (string, error) {
+		list, err := rb.client.List(ctx, opts)
+		if err != nil {
+			return "", err
+		}
+
+		result.Items = append(result.Items, list.Items...)
+		return list.Continue, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// RoleBindingIndex holds the role bindings of one List, indexed by name.
+type RoleBindingIndex map[string]*rbacv1.RoleBinding
+
+// IndexRoleBindings lists all role bindings and indexes them by name.
+func (rb *RoleBinding) IndexRoleBindings(ctx context.Context) (RoleBindingIndex, error) {
+	list, err := rb.ListRoleBindings(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	index := RoleBindingIndex{}
+	for i := range list.Items {
+		index[list.Items[i].Name] = &list.Items[i]
+	}
+
+	return index, nil
+}
+
+// GetRoleBinding looks up a role binding in the index, returning a NotFound error
+// like the API server if it isn't there.
+func (index RoleBindingIndex) GetRoleBinding(ctx context.Context, name string) (*rbacv1.RoleBinding, error) {
+	if result, ok := index[name]; ok {
+		return result, nil
+	}
+
+	return nil, apierrors.NewNotFound(rbacv1.Resource("rolebindings"), name)
+}
+
+func (rb *RoleBinding) GetRoleBinding(ctx context.Context, name string) (*rbacv1.RoleBinding, error) {
+	roleBinding, err := rb.client.Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	return roleBinding, nil
+}
+
+func (rb *RoleBinding) CreateRoleBinding(ctx context.Context, roleBinding *rbacv1.RoleBinding) error {
+	_, err := rb.client.Create(ctx, roleBinding, metav1.CreateOptions{})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (rb *RoleBinding) UpdateRoleBinding(ctx context.Context, roleBinding *rbacv1.RoleBinding) error {
+	_, err := rb.client.Update(ctx, roleBinding, metav1.UpdateOptions{})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ApplyRoleBinding creates or updates a role binding. Conflicts and transient
+// API errors are retried according to the options of ctx.
+func (rb *RoleBinding) ApplyRoleBinding(ctx context.Context, roleBinding *rbacv1.RoleBinding) (Operation, error) {
+	return retryApply(ctx, "role binding "+roleBinding.Name, func() (Operation, error) {
+		return rb.applyRoleBinding(ctx, roleBinding)
+	})
+}
+
+func (rb *RoleBinding) applyRoleBinding(ctx context.Context, roleBinding *rbacv1.RoleBinding) (Operation, error) {
+	result, err := rb.GetRoleBinding(ctx, roleBinding.Name)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return "", err
+	}
+
+	if result != nil {
+		err = Admit(ctx, rbacv1.SchemeGroupVersion.WithKind("RoleBinding"), rb.namespace, result.Name, result.Labels, roleBinding.Labels)
+	} else {
+		err = Admit(ctx, rbacv1.SchemeGroupVersion.WithKind("RoleBinding"), rb.namespace, roleBinding.Name, roleBinding.Labels)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if result != nil {
+		before := result.DeepCopy()
+
+		result.Subjects = roleBinding.Subjects
+		result.RoleRef = roleBinding.RoleRef
+		if apiequality.Semantic.DeepEqual(before, result) {
+			return OperationUnchanged, nil
+		}
+		if IsDryRun(ctx) {
+			return OperationUpdated, nil
+		}
+		if err := Snapshot(ctx, rbacv1.SchemeGroupVersion.WithKind("RoleBinding"), rb.namespace, result.Name, before); err != nil {
+			return "", err
+		}
+
+		err := rb.UpdateRoleBinding(ctx, result)
+		if err != nil {
+			return "", err
+		}
+
+		return OperationUpdated, nil
+	}
+
+	if IsDryRun(ctx) {
+		return OperationCreated, nil
+	}
+	if err := Snapshot(ctx, rbacv1.SchemeGroupVersion.WithKind("RoleBinding"), rb.namespace, roleBinding.Name, nil); err != nil {
+		return "", err
+	}
+
+	err = rb.CreateRoleBinding(ctx, roleBinding)
+	if err != nil {
+		return "", err
+	}
+
+	return OperationCreated, nil
+}
@@ -1 +1,36 @@
 package k8s_resources
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	typedv1 "k8s.io/client-go/kubernetes/typed/core/v1"
+
+	"k8s.io/client-go/rest"
+)
+
+type Secret struct {
+	client typedv1.SecretInterface
+}
+
+func NewSecret(config *rest.Config, namespace string) (*Secret, error) {
+	cluster, err := ClusterFor(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Secret{
+		client: cluster.Clientset.CoreV1().Secrets(namespace),
+	}, nil
+}
+
+func (s *Secret) GetSecret(ctx context.Context, name string) (*corev1.Secret, error) {
+	secret, err := s.client.Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	return secret, nil
+}
@@ -4,40 +4,81 @@ import (
 	"context"
 
 	corev1 "k8s.io/api/core/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	typedv1 "k8s.io/client-go/kubernetes/typed/core/v1"
 
-	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 )
 
 type Service struct {
-	client typedv1.ServiceInterface
+	client    typedv1.ServiceInterface
+	namespace string
 }
 
 func NewService(config *rest.Config, namespace string) (*Service, error) {
-	clientset, err := kubernetes.NewForConfig(config)
+	cluster, err := ClusterFor(config)
 	if err != nil {
 		return nil, err
 	}
 
 	return &Service{
-		client: clientset.CoreV1().Services(namespace),
+		client:    cluster.Clientset.CoreV1().Services(namespace),
+		namespace: namespace,
 	}, nil
 }
 
-func (s *Service) ListServices() (*corev1.ServiceList, error) {
-	list, err := s.client.List(context.TODO(), metav1.ListOptions{})
+// ListServices lists all services in pages of ListPageSize.
+func (s *Service) ListServices(ctx context.Context) (*corev1.ServiceList, error) {
+	result := &corev1.ServiceList{}
+	err := listPages(func(opts metav1.ListOptions) (string, error) {
+		list, err := s.client.List(ctx, opts)
+		if err != nil {
+			return "", err
+		}
+
+		result.Items = append(result.Items, list.Items...)
+		return list.Continue, nil
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	return list, nil
+	return result, nil
 }
 
-func (s *Service) GetService(name string) (*corev1.Service, error) {
-	service, err := s.client.Get(context.TODO(), name, metav1.GetOptions{})
+// ServiceIndex holds the services of one List, indexed by name.
+type ServiceIndex map[string]*corev1.Service
+
+// IndexServices lists all services and indexes them by name.
+func (s *Service) IndexServices(ctx context.Context) (ServiceIndex, error) {
+	list, err := s.ListServices(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	index := ServiceIndex{}
+	for i := range list.Items {
+		index[list.Items[i].Name] = &list.Items[i]
+	}
+
+	return index, nil
+}
+
+// GetService looks up a service in the index, returning a NotFound error
+// like the API server if it isn't there.
+func (index ServiceIndex) GetService(ctx context.Context, name string) (*corev1.Service, error) {
+	if result, ok := index[name]; ok {
+		return result, nil
+	}
+
+	return nil, apierrors.NewNotFound(corev1.Resource("services"), name)
+}
+
+func (s *Service) GetService(ctx context.Context, name string) (*corev1.Service, error) {
+	service, err := s.client.Get(ctx, name, metav1.GetOptions{})
 	if err != nil {
 		return nil, err
 	}
@@ -45,8 +86,8 @@ func (s *Service) GetService(name string) (*corev1.Service, error) {
 	return service, nil
 }
 
-func (s *Service) CreateService(service *corev1.Service) error {
-	_, err := s.client.Create(context.TODO(), service, metav1.CreateOptions{})
+func (s *Service) CreateService(ctx context.Context, service *corev1.Service) error {
+	_, err := s.client.Create(ctx, service, metav1.CreateOptions{})
 	if err != nil {
 		return err
 	}
@@ -54,8 +95,8 @@ func (s *Service) CreateService(service *corev1.Service) error {
 	return nil
 }
 
-func (s *Service) UpdateService(service *corev1.Service) error {
-	_, err := s.client.Update(context.TODO(), service, metav1.UpdateOptions{})
+func (s *Service) UpdateService(ctx context.Context, service *corev1.Service) error {
+	_, err := s.client.Update(ctx, service, metav1.UpdateOptions{})
 	if err != nil {
 		return err
 	}
@@ -63,25 +104,67 @@ func (s *Service) UpdateService(service *corev1.Service) error {
 	return nil
 }
 
-func (s *Service) ApplyService(service *corev1.Service) error {
-	result, _ := s.GetService(service.Name)
+// ApplyService creates or updates a service. Conflicts and transient
+// API errors are retried according to the options of ctx.
+func (s *Service) ApplyService(ctx context.Context, service *corev1.Service) (Operation, error) {
+	return retryApply(ctx, "service "+service.Name, func() (Operation, error) {
+		return s.applyService(ctx, service)
+	})
+}
+
+func (s *Service) applyService(ctx context.Context, service *corev1.Service) (Operation, error) {
+	result, err := s.GetService(ctx, service.Name)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return "", err
+	}
+
 	if result != nil {
+		err = Admit(ctx, corev1.SchemeGroupVersion.WithKind("Service"), s.namespace, result.Name, result.Labels, service.Labels)
+	} else {
+		err = Admit(ctx, corev1.SchemeGroupVersion.WithKind("Service"), s.namespace, service.Name, service.Labels)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if result != nil {
+		before := result.DeepCopy()
+
 		//version, _ := strconv.ParseInt(result.GetResourceVersion(), 10, 32)
 		//service.SetResourceVersion(fmt.Sprintf("%d", (version + 1)))
 		//service.Spec.ClusterIP = result.Spec.ClusterIP
 		result.SetAnnotations(service.GetAnnotations())
-		err := s.UpdateService(result)
-		if err != nil {
-			return err
+		if apiequality.Semantic.DeepEqual(before, result) {
+			return OperationUnchanged, nil
 		}
-	} else {
-		err := s.CreateService(service)
+		if IsDryRun(ctx) {
+			return OperationUpdated, nil
+		}
+		if err := Snapshot(ctx, corev1.SchemeGroupVersion.WithKind("Service"), s.namespace, result.Name, before); err != nil {
+			return "", err
+		}
+
+		err := s.UpdateService(ctx, result)
 		if err != nil {
-			return err
+			return "", err
 		}
+
+		return OperationUpdated, nil
 	}
 
-	return nil
+	if IsDryRun(ctx) {
+		return OperationCreated, nil
+	}
+	if err := Snapshot(ctx, corev1.SchemeGroupVersion.WithKind("Service"), s.namespace, service.Name, nil); err != nil {
+		return "", err
+	}
+
+	err = s.CreateService(ctx, service)
+	if err != nil {
+		return "", err
+	}
+
+	return OperationCreated, nil
 }
 
 /* Experimental
@@ -4,40 +4,81 @@ import (
 	"context"
 
 	corev1 "k8s.io/api/core/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	typedv1 "k8s.io/client-go/kubernetes/typed/core/v1"
 
-	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 )
 
 type ServiceAccount struct {
-	client typedv1.ServiceAccountInterface
+	client    typedv1.ServiceAccountInterface
+	namespace string
 }
 
 func NewServiceAccount(config *rest.Config, namespace string) (*ServiceAccount, error) {
-	clientset, err := kubernetes.NewForConfig(config)
+	cluster, err := ClusterFor(config)
 	if err != nil {
 		return nil, err
 	}
 
 	return &ServiceAccount{
-		client: clientset.CoreV1().ServiceAccounts(namespace),
+		client:    cluster.Clientset.CoreV1().ServiceAccounts(namespace),
+		namespace: namespace,
 	}, nil
 }
 
-func (s *ServiceAccount) ListServiceAccounts() (*corev1.ServiceAccountList, error) {
-	list, err := s.client.List(context.TODO(), metav1.ListOptions{})
+// ListServiceAccounts lists all service accounts in pages of ListPageSize.
+func (s *ServiceAccount) ListServiceAccounts(ctx context.Context) (*corev1.ServiceAccountList, error) {
+	result := &corev1.ServiceAccountList{}
+	err := listPages(func(opts metav1.ListOptions) (string, error) {
+		list, err := s.client.List(ctx, opts)
+		if err != nil {
+			return "", err
+		}
+
+		result.Items = append(result.Items, list.Items...)
+		return list.Continue, nil
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	return list, nil
+	return result, nil
+}
+
+// ServiceAccountIndex holds the service accounts of one List, indexed by name.
+type ServiceAccountIndex map[string]*corev1.ServiceAccount
+
+// IndexServiceAccounts lists all service accounts and indexes them by name.
+func (s *ServiceAccount) IndexServiceAccounts(ctx context.Context) (ServiceAccountIndex, error) {
+	list, err := s.ListServiceAccounts(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	index := ServiceAccountIndex{}
+	for i := range list.Items {
+		index[list.Items[i].Name] = &list.Items[i]
+	}
+
+	return index, nil
+}
+
+// GetServiceAccount looks up a service account in the index, returning a NotFound error
+// like the API server if it isn't there.
+func (index ServiceAccountIndex) GetServiceAccount(ctx context.Context, name string) (*corev1.ServiceAccount, error) {
+	if result, ok := index[name]; ok {
+		return result, nil
+	}
+
+	return nil, apierrors.NewNotFound(corev1.Resource("serviceaccounts"), name)
 }
 
-func (s *ServiceAccount) GetServiceAccount(name string) (*corev1.ServiceAccount, error) {
-	account, err := s.client.Get(context.TODO(), name, metav1.GetOptions{})
+func (s *ServiceAccount) GetServiceAccount(ctx context.Context, name string) (*corev1.ServiceAccount, error) {
+	account, err := s.client.Get(ctx, name, metav1.GetOptions{})
 	if err != nil {
 		return nil, err
 	}
@@ -45,8 +86,8 @@ func (s *ServiceAccount) GetServiceAccount(name string) (*corev1.ServiceAccount,
 	return account, nil
 }
 
-func (s *ServiceAccount) CreateServiceAccount(serviceAccount *corev1.ServiceAccount) error {
-	_, err := s.client.Create(context.TODO(), serviceAccount, metav1.CreateOptions{})
+func (s *ServiceAccount) CreateServiceAccount(ctx context.Context, serviceAccount *corev1.ServiceAccount) error {
+	_, err := s.client.Create(ctx, serviceAccount, metav1.CreateOptions{})
 	if err != nil {
 		return err
 	}
@@ -54,8 +95,8 @@ func (s *ServiceAccount) CreateServiceAccount(serviceAccount *corev1.ServiceAcco
 	return nil
 }
 
-func (s *ServiceAccount) UpdateServiceAccount(serviceAccount *corev1.ServiceAccount) error {
-	_, err := s.client.Update(context.TODO(), serviceAccount, metav1.UpdateOptions{})
+func (s *ServiceAccount) UpdateServiceAccount(ctx context.Context, serviceAccount *corev1.ServiceAccount) error {
+	_, err := s.client.Update(ctx, serviceAccount, metav1.UpdateOptions{})
 	if err != nil {
 		return err
 	}
@@ -63,21 +104,72 @@ func (s *ServiceAccount) UpdateServiceAccount(serviceAccount *corev1.ServiceAcco
 	return nil
 }
 
-func (s *ServiceAccount) ApplyServiceAccount(serviceAccount *corev1.ServiceAccount) error {
-	result, _ := s.GetServiceAccount(serviceAccount.Name)
+// ApplyServiceAccount creates or updates a service account. Conflicts and transient
+// API errors are retried according to the options of ctx.
+func (s *ServiceAccount) ApplyServiceAccount(ctx context.Context, serviceAccount *corev1.ServiceAccount) (Operation, error) {
+	return retryApply(ctx, "service account "+serviceAccount.Name, func() (Operation, error) {
+		return s.applyServiceAccount(ctx, serviceAccount)
+	})
+}
+
+func (s *ServiceAccount) applyServiceAccount(ctx context.Context, serviceAccount *corev1.ServiceAccount) (Operation, error) {
+	result, err := s.GetServiceAccount(ctx, serviceAccount.Name)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return "", err
+	}
+
 	if result != nil {
-		serviceAccount.ObjectMeta.UID = ""
-		err := s.UpdateServiceAccount(serviceAccount)
-		if err != nil {
-			return err
-		}
+		err = Admit(ctx, corev1.SchemeGroupVersion.WithKind("ServiceAccount"), s.namespace, result.Name, result.Labels, serviceAccount.Labels)
 	} else {
-		serviceAccount.ResourceVersion = ""
-		err := s.CreateServiceAccount(serviceAccount)
+		err = Admit(ctx, corev1.SchemeGroupVersion.WithKind("ServiceAccount"), s.namespace, serviceAccount.Name, serviceAccount.Labels)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if result != nil {
+		if serviceAccountUnchanged(result, serviceAccount) {
+			return OperationUnchanged, nil
+		}
+		if IsDryRun(ctx) {
+			return OperationUpdated, nil
+		}
+		if err := Snapshot(ctx, corev1.SchemeGroupVersion.WithKind("ServiceAccount"), s.namespace, result.Name, result); err != nil {
+			return "", err
+		}
+
+		serviceAccount.ObjectMeta.UID = ""
+		err := s.UpdateServiceAccount(ctx, serviceAccount)
 		if err != nil {
-			return err
+			return "", err
 		}
+
+		return OperationUpdated, nil
 	}
 
-	return nil
+	if IsDryRun(ctx) {
+		return OperationCreated, nil
+	}
+
+	serviceAccount.ResourceVersion = ""
+	if err := Snapshot(ctx, corev1.SchemeGroupVersion.WithKind("ServiceAccount"), s.namespace, serviceAccount.Name, nil); err != nil {
+		return "", err
+	}
+
+	err = s.CreateServiceAccount(ctx, serviceAccount)
+	if err != nil {
+		return "", err
+	}
+
+	return OperationCreated, nil
+}
+
+// serviceAccountUnchanged reports whether updating current with the manifest
+// of serviceAccount would leave it as it is.
+func serviceAccountUnchanged(current, serviceAccount *corev1.ServiceAccount) bool {
+	return apiequality.Semantic.DeepEqual(current.Labels, serviceAccount.Labels) &&
+		apiequality.Semantic.DeepEqual(current.Annotations, serviceAccount.Annotations) &&
+		apiequality.Semantic.DeepEqual(current.Secrets, serviceAccount.Secrets) &&
+		apiequality.Semantic.DeepEqual(current.ImagePullSecrets, serviceAccount.ImagePullSecrets) &&
+		apiequality.Semantic.DeepEqual(current.AutomountServiceAccountToken, serviceAccount.AutomountServiceAccountToken)
 }
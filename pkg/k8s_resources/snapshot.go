@@ -0,0 +1,34 @@
+package k8s_resources
+
+import (
+	"context"
+	"errors"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// Snapshotter records the state of target objects before they are changed,
+// e.g. to back them up.
+type Snapshotter interface {
+	// Snapshot is called with the current state of an object about to be
+	// updated or replaced, or with a nil current if it is about to be
+	// created. An error aborts the change.
+	Snapshot(gvk schema.GroupVersionKind, namespace, name string, current runtime.Object) error
+}
+
+// ErrDeclined is returned by a Snapshotter that was told not to make a
+// change, the object is left as it is.
+var ErrDeclined = errors.New("declined")
+
+// Snapshot passes the current state of an object to the Snapshots of the
+// options of ctx. It is called by the Apply* methods, and must be called by
+// any other code changing the target cluster.
+func Snapshot(ctx context.Context, gvk schema.GroupVersionKind, namespace, name string, current runtime.Object) error {
+	snapshots := OptionsFrom(ctx).Snapshots
+	if snapshots == nil {
+		return nil
+	}
+
+	return snapshots.Snapshot(gvk, namespace, name, current)
+}
@@ -0,0 +1,177 @@
+package k8s_resources
+
+import (
+	"context"
+
+	appsv1 "k8s.io/api/apps/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	typedv1 "k8s.io/client-go/kubernetes/typed/apps/v1"
+
+	"k8s.io/client-go/rest"
+)
+
+type StatefulSet struct {
+	client    typedv1.StatefulSetInterface
+	namespace string
+}
+
+func NewStatefulSet(config *rest.Config, namespace string) (*StatefulSet, error) {
+	cluster, err := ClusterFor(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &StatefulSet{
+		client:    cluster.Clientset.AppsV1().StatefulSets(namespace),
+		namespace: namespace,
+	}, nil
+}
+
+// ListStatefulSets lists all stateful sets in pages of ListPageSize.
+func (s *StatefulSet) ListStatefulSets(ctx context.Context) (*appsv1.StatefulSetList, error) {
+	result := &appsv1.StatefulSetList{}
+	err := listPages(func(opts metav1.ListOptions) (string, error) {
+		list, err := s.client.List(ctx, opts)
+		if err != nil {
+			return "", err
+		}
+
+		result.Items = append(result.Items, list.Items...)
+		return list.Continue, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// StatefulSetIndex holds the stateful sets of one List, indexed by name.
+type StatefulSetIndex map[string]*appsv1.StatefulSet
+
+// IndexStatefulSets lists all stateful sets and indexes them by name.
+func (s *StatefulSet) IndexStatefulSets(ctx context.Context) (StatefulSetIndex, error) {
+	list, err := s.ListStatefulSets(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	index := StatefulSetIndex{}
+	for i := range list.Items {
+		index[list.Items[i].Name] = &list.Items[i]
+	}
+
+	return index, nil
+}
+
+// GetStatefulSet looks up a stateful set in the index, returning a NotFound error
+// like the API server if it isn't there.
+func (index StatefulSetIndex) GetStatefulSet(ctx context.Context, name string) (*appsv1.StatefulSet, error) {
+	if result, ok := index[name]; ok {
+		return result, nil
+	}
+
+	return nil, apierrors.NewNotFound(appsv1.Resource("statefulsets"), name)
+}
+
+func (s *StatefulSet) GetStatefulSet(ctx context.Context, name string) (*appsv1.StatefulSet, error) {
+	statefulSet, err := s.client.Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	return statefulSet, nil
+}
+
+func (s *StatefulSet) CreateStatefulSet(ctx context.Context, statefulSet *appsv1.StatefulSet) error {
+	_, err := s.client.Create(ctx, statefulSet, metav1.CreateOptions{})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *StatefulSet) UpdateStatefulSet(ctx context.Context, statefulSet *appsv1.StatefulSet) error {
+	_, err := s.client.Update(ctx, statefulSet, metav1.UpdateOptions{})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ApplyStatefulSet creates or updates a stateful set. Conflicts and transient
+// API errors are retried according to the options of ctx.
+func (s *StatefulSet) ApplyStatefulSet(ctx context.Context, statefulSet *appsv1.StatefulSet) (Operation, error) {
+	return retryApply(ctx, "stateful set "+statefulSet.Name, func() (Operation, error) {
+		return s.applyStatefulSet(ctx, statefulSet)
+	})
+}
+
+func (s *StatefulSet) applyStatefulSet(ctx context.Context, statefulSet *appsv1.StatefulSet) (Operation, error) {
+	result, err := s.GetStatefulSet(ctx, statefulSet.Name)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return "", err
+	}
+
+	if result != nil {
+		err = Admit(ctx, appsv1.SchemeGroupVersion.WithKind("StatefulSet"), s.namespace, result.Name, result.Labels, statefulSet.Labels)
+	} else {
+		err = Admit(ctx, appsv1.SchemeGroupVersion.WithKind("StatefulSet"), s.namespace, statefulSet.Name, statefulSet.Labels)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if result != nil {
+		before := result.DeepCopy()
+
+		containerImageMap := map[string]string{}
+		for _, c := range statefulSet.Spec.Template.Spec.Containers {
+			containerImageMap[c.Name] = c.Image
+		}
+
+		for i, c := range result.Spec.Template.Spec.Containers {
+			result.Spec.Template.Spec.Containers[i].Image = containerImageMap[c.Name]
+		}
+		copyInitContainerImages(&result.Spec.Template.Spec, &statefulSet.Spec.Template.Spec)
+
+		result.Spec.Replicas = statefulSet.Spec.Replicas
+		copyAnnotation(&result.ObjectMeta, &statefulSet.ObjectMeta, PinnedImagesAnnotation)
+
+		if apiequality.Semantic.DeepEqual(before, result) {
+			return OperationUnchanged, nil
+		}
+		if IsDryRun(ctx) {
+			return OperationUpdated, nil
+		}
+		if err := Snapshot(ctx, appsv1.SchemeGroupVersion.WithKind("StatefulSet"), s.namespace, result.Name, before); err != nil {
+			return "", err
+		}
+
+		err := s.UpdateStatefulSet(ctx, result)
+		if err != nil {
+			return "", err
+		}
+
+		return OperationUpdated, nil
+	}
+
+	if IsDryRun(ctx) {
+		return OperationCreated, nil
+	}
+	if err := Snapshot(ctx, appsv1.SchemeGroupVersion.WithKind("StatefulSet"), s.namespace, statefulSet.Name, nil); err != nil {
+		return "", err
+	}
+
+	err = s.CreateStatefulSet(ctx, statefulSet)
+	if err != nil {
+		return "", err
+	}
+
+	return OperationCreated, nil
+}
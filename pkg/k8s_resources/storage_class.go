@@ -0,0 +1,174 @@
+package k8s_resources
+
+import (
+	"context"
+
+	storagev1 "k8s.io/api/storage/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	typedv1 "k8s.io/client-go/kubernetes/typed/storage/v1"
+
+	"k8s.io/client-go/rest"
+	"k8s.io/klog/v2"
+)
+
+type StorageClass struct {
+	client    typedv1.StorageClassInterface
+	namespace string
+}
+
+func NewStorageClass(config *rest.Config) (*StorageClass, error) {
+	cluster, err := ClusterFor(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &StorageClass{
+		client:    cluster.Clientset.StorageV1().StorageClasses(),
+		namespace: "",
+	}, nil
+}
+
+// ListStorageClasses lists all storage classes in pages of ListPageSize.
+func (sc *StorageClass) ListStorageClasses(ctx context.Context) (*storagev1.StorageClassList, error) {
+	result := &storagev1.StorageClassList{}
+	err := listPages(func(opts metav1.ListOptions) (string, error) {
+		list, err := sc.client.List(ctx, opts)
+		if err != nil {
+			return "", err
+		}
+
+		result.Items = append(result.Items, list.Items...)
+		return list.Continue, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// StorageClassIndex holds the storage classes of one List, indexed by name.
+type StorageClassIndex map[string]*storagev1.StorageClass
+
+// IndexStorageClasses lists all storage classes and indexes them by name.
+func (sc *StorageClass) IndexStorageClasses(ctx context.Context) (StorageClassIndex, error) {
+	list, err := sc.ListStorageClasses(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	index := StorageClassIndex{}
+	for i := range list.Items {
+		index[list.Items[i].Name] = &list.Items[i]
+	}
+
+	return index, nil
+}
+
+// GetStorageClass looks up a storage class in the index, returning a NotFound error
+// like the API server if it isn't there.
+func (index StorageClassIndex) GetStorageClass(ctx context.Context, name string) (*storagev1.StorageClass, error) {
+	if result, ok := index[name]; ok {
+		return result, nil
+	}
+
+	return nil, apierrors.NewNotFound(storagev1.Resource("storageclasses"), name)
+}
+
+func (sc *StorageClass) GetStorageClass(ctx context.Context, name string) (*storagev1.StorageClass, error) {
+	role, err := sc.client.Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	return role, nil
+}
+
+func (sc *StorageClass) CreateStorageClass(ctx context.Context, storageClass *storagev1.StorageClass) error {
+	_, err := sc.client.Create(ctx, storageClass, metav1.CreateOptions{})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (sc *StorageClass) UpdateStorageClass(ctx context.Context, storageClass *storagev1.StorageClass) error {
+	_, err := sc.client.Update(ctx, storageClass, metav1.UpdateOptions{})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ApplyStorageClass creates or updates a storage class. Conflicts and transient
+// API errors are retried according to the options of ctx.
+func (sc *StorageClass) ApplyStorageClass(ctx context.Context, storageClass *storagev1.StorageClass) (Operation, error) {
+	return retryApply(ctx, "storage class "+storageClass.Name, func() (Operation, error) {
+		return sc.applyStorageClass(ctx, storageClass)
+	})
+}
+
+func (sc *StorageClass) applyStorageClass(ctx context.Context, storageClass *storagev1.StorageClass) (Operation, error) {
+	result, err := sc.GetStorageClass(ctx, storageClass.Name)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return "", err
+	}
+
+	if result != nil {
+		err = Admit(ctx, storagev1.SchemeGroupVersion.WithKind("StorageClass"), sc.namespace, result.Name, result.Labels, storageClass.Labels)
+	} else {
+		err = Admit(ctx, storagev1.SchemeGroupVersion.WithKind("StorageClass"), sc.namespace, storageClass.Name, storageClass.Labels)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if result != nil {
+		before := result.DeepCopy()
+
+		// Provisioner, parameters, reclaim policy and binding mode of a
+		// storage class are immutable, only the mutable fields are synced.
+		if result.Provisioner != storageClass.Provisioner {
+			klog.Warningf("Storage class %s: provisioner %s differs from %s and can't be updated",
+				storageClass.Name, result.Provisioner, storageClass.Provisioner)
+		}
+		result.AllowVolumeExpansion = storageClass.AllowVolumeExpansion
+		result.SetLabels(storageClass.GetLabels())
+		result.SetAnnotations(storageClass.GetAnnotations())
+		if apiequality.Semantic.DeepEqual(before, result) {
+			return OperationUnchanged, nil
+		}
+		if IsDryRun(ctx) {
+			return OperationUpdated, nil
+		}
+		if err := Snapshot(ctx, storagev1.SchemeGroupVersion.WithKind("StorageClass"), sc.namespace, result.Name, before); err != nil {
+			return "", err
+		}
+
+		err := sc.UpdateStorageClass(ctx, result)
+		if err != nil {
+			return "", err
+		}
+
+		return OperationUpdated, nil
+	}
+
+	if IsDryRun(ctx) {
+		return OperationCreated, nil
+	}
+	if err := Snapshot(ctx, storagev1.SchemeGroupVersion.WithKind("StorageClass"), sc.namespace, storageClass.Name, nil); err != nil {
+		return "", err
+	}
+
+	err = sc.CreateStorageClass(ctx, storageClass)
+	if err != nil {
+		return "", err
+	}
+
+	return OperationCreated, nil
+}
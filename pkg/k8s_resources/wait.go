@@ -0,0 +1,21 @@
+package k8s_resources
+
+import (
+	"context"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// Poll checks condition every interval until it is done, the timeout
+// expires or ctx is cancelled. A zero timeout waits for as long as ctx
+// allows.
+func Poll(ctx context.Context, interval, timeout time.Duration, condition wait.ConditionFunc) error {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	return wait.PollImmediateUntil(interval, condition, ctx.Done())
+}
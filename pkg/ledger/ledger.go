@@ -0,0 +1,208 @@
+package ledger
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const runFile = "run.yaml"
+
+const (
+	OutcomeSucceeded   = "succeeded"
+	OutcomeFailed      = "failed"
+	OutcomeInterrupted = "interrupted"
+)
+
+// Object is an object touched by a run, with hashes of its state before
+// and after the run. An empty hash means the object didn't exist.
+type Object struct {
+	APIVersion string `yaml:"apiVersion"`
+	Kind       string `yaml:"kind"`
+	Namespace  string `yaml:"namespace,omitempty"`
+	Name       string `yaml:"name"`
+	Before     string `yaml:"before,omitempty"`
+	After      string `yaml:"after,omitempty"`
+	Status     string `yaml:"status,omitempty"`
+	Reason     string `yaml:"reason,omitempty"`
+}
+
+func (o Object) String() string {
+	if len(o.Namespace) > 0 {
+		return fmt.Sprintf("%s %s/%s", o.Kind, o.Namespace, o.Name)
+	}
+	return fmt.Sprintf("%s %s", o.Kind, o.Name)
+}
+
+// Run is the ledger record of a sync run. It is saved as run.yaml next to
+// the backup of the run, both are named by the run ID.
+type Run struct {
+	ID       string    `yaml:"id"`
+	Started  time.Time `yaml:"started"`
+	Finished time.Time `yaml:"finished"`
+	Args     []string  `yaml:"args"`
+	Source   string    `yaml:"source"`
+	Target   string    `yaml:"target"`
+	Outcome  string    `yaml:"outcome"`
+	Objects  []Object  `yaml:"objects"`
+}
+
+// Save writes run to runsDir.
+func Save(runsDir string, run *Run) error {
+	data, err := yaml.Marshal(run)
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(runsDir, run.ID, runFile)
+	if err := ioutil.WriteFile(path+".tmp", data, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(path+".tmp", path)
+}
+
+// Load reads the run id from runsDir.
+func Load(runsDir, id string) (*Run, error) {
+	path := filepath.Join(runsDir, id, runFile)
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	run := &Run{}
+	if err := yaml.Unmarshal(data, run); err != nil {
+		return nil, fmt.Errorf("invalid run record %s: %s", path, err)
+	}
+
+	return run, nil
+}
+
+// List reads every run in runsDir, oldest first. Directories without a run
+// record, e.g. of runs that died, are left out.
+func List(runsDir string) ([]*Run, error) {
+	infos, err := ioutil.ReadDir(runsDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	runs := []*Run{}
+	for _, info := range infos {
+		if !info.IsDir() {
+			continue
+		}
+
+		run, err := Load(runsDir, info.Name())
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+	sort.Slice(runs, func(i, j int) bool { return runs[i].ID < runs[j].ID })
+
+	return runs, nil
+}
+
+// RedactArgs hides the values of the flags carrying secrets, so that the
+// arguments of a run can be recorded.
+func RedactArgs(args []string) []string {
+	redacted := make([]string, 0, len(args))
+	hideNext := false
+	for _, arg := range args {
+		if hideNext {
+			redacted = append(redacted, "<redacted>")
+			hideNext = false
+			continue
+		}
+
+		name := strings.TrimLeft(arg, "-")
+		if strings.HasPrefix(arg, "-") && strings.HasSuffix(strings.SplitN(name, "=", 2)[0], "token") {
+			if strings.Contains(name, "=") {
+				arg = arg[:strings.Index(arg, "=")+1] + "<redacted>"
+			} else {
+				hideNext = true
+			}
+		}
+		redacted = append(redacted, arg)
+	}
+
+	return redacted
+}
+
+// volatileAnnotations are maintained by controllers and don't reflect a
+// change by anyone.
+var volatileAnnotations = []string{
+	"deployment.kubernetes.io/revision",
+	"kubectl.kubernetes.io/last-applied-configuration",
+	// Set by the PV controller when a claim is bound.
+	"pv.kubernetes.io/bind-completed",
+	"pv.kubernetes.io/bound-by-controller",
+	"volume.beta.kubernetes.io/storage-provisioner",
+	"volume.kubernetes.io/storage-provisioner",
+	"volume.kubernetes.io/selected-node",
+}
+
+// volatileFields are the fields controllers set after an object is applied,
+// by kind, e.g. the volume a claim gets bound to.
+var volatileFields = map[schema.GroupKind][][]string{
+	{Kind: "PersistentVolumeClaim"}: {{"spec", "volumeName"}},
+	{Kind: "ServiceAccount"}:        {{"secrets"}},
+}
+
+// Hash returns a hash of the parts of obj people change: everything but the
+// status, the metadata maintained by the API server and controllers, and
+// the volatileFields of its kind.
+func Hash(obj *unstructured.Unstructured) string {
+	if obj == nil {
+		return ""
+	}
+
+	content := obj.DeepCopy().Object
+	delete(content, "status")
+	for _, field := range volatileFields[obj.GroupVersionKind().GroupKind()] {
+		unstructured.RemoveNestedField(content, field...)
+	}
+	metadata, _ := content["metadata"].(map[string]interface{})
+	for field := range metadata {
+		switch field {
+		case "name", "namespace", "labels", "annotations":
+		default:
+			delete(metadata, field)
+		}
+	}
+	if annotations, ok := metadata["annotations"].(map[string]interface{}); ok {
+		for _, annotation := range volatileAnnotations {
+			delete(annotations, annotation)
+		}
+		if len(annotations) == 0 {
+			delete(metadata, "annotations")
+		}
+	}
+
+	// encoding/json sorts map keys, which makes the hash stable.
+	data, err := json.Marshal(content)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,73 @@
+package ledger
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func claim(volumeName string, annotations map[string]interface{}, storage string) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "PersistentVolumeClaim",
+		"metadata": map[string]interface{}{
+			"name":            "data",
+			"namespace":       "apps",
+			"resourceVersion": "1",
+		},
+		"spec": map[string]interface{}{
+			"accessModes": []interface{}{"ReadWriteOnce"},
+			"resources":   map[string]interface{}{"requests": map[string]interface{}{"storage": storage}},
+		},
+	}}
+	if len(volumeName) > 0 {
+		unstructured.SetNestedField(obj.Object, volumeName, "spec", "volumeName")
+		unstructured.SetNestedField(obj.Object, "Bound", "status", "phase")
+		obj.SetResourceVersion("2")
+	}
+	if annotations != nil {
+		unstructured.SetNestedMap(obj.Object, annotations, "metadata", "annotations")
+	}
+
+	return obj
+}
+
+func TestHashIgnoresBinding(t *testing.T) {
+	created := claim("", nil, "10Gi")
+	bound := claim("pvc-1234", map[string]interface{}{
+		"pv.kubernetes.io/bind-completed":               "yes",
+		"pv.kubernetes.io/bound-by-controller":          "yes",
+		"volume.beta.kubernetes.io/storage-provisioner": "ebs.csi.aws.com",
+		"volume.kubernetes.io/storage-provisioner":      "ebs.csi.aws.com",
+	}, "10Gi")
+
+	if Hash(created) != Hash(bound) {
+		t.Errorf("binding a claim changed its hash")
+	}
+
+	if Hash(claim("pvc-1234", nil, "20Gi")) == Hash(created) {
+		t.Errorf("resizing a claim didn't change its hash")
+	}
+	if Hash(claim("", map[string]interface{}{"team": "data"}, "10Gi")) == Hash(created) {
+		t.Errorf("annotating a claim didn't change its hash")
+	}
+}
+
+func TestHashVolatileFieldsByKind(t *testing.T) {
+	volume := func(volumeName string) *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "example.com/v1",
+			"kind":       "Volume",
+			"metadata":   map[string]interface{}{"name": "data"},
+			"spec":       map[string]interface{}{"volumeName": volumeName},
+		}}
+	}
+
+	// spec.volumeName is only volatile in claims.
+	if Hash(volume("a")) == Hash(volume("b")) {
+		t.Errorf("spec.volumeName of a custom resource is ignored")
+	}
+	if Hash(nil) != "" {
+		t.Errorf("Hash(nil) = %q, want empty", Hash(nil))
+	}
+}
@@ -0,0 +1,148 @@
+package openapi
+
+import (
+	"strings"
+)
+
+// yamlLine is a non-empty, non-comment line of a YAML document.
+type yamlLine struct {
+	number int
+	// column of the dash of a list item, or -1.
+	dash int
+	// column and name of the key of a mapping entry, if any.
+	column int
+	key    string
+}
+
+// LineOf returns the 1-based line of the field at path in a YAML document
+// in block style. When the field can't be located, e.g. in flow style, the
+// line of its closest located parent is returned, or 0.
+func LineOf(data []byte, path Path) int {
+	lines := parseLines(string(data))
+
+	found := 0
+	start, end := 0, len(lines)
+	for _, elem := range path {
+		var i int
+		switch e := elem.(type) {
+		case string:
+			i = findKey(lines[start:end], e)
+		case int:
+			i = findItem(lines[start:end], e)
+		default:
+			i = -1
+		}
+		if i < 0 {
+			break
+		}
+
+		i += start
+		found = lines[i].number
+		start, end = scope(lines, i, end, elem)
+	}
+
+	return found
+}
+
+func parseLines(doc string) []yamlLine {
+	lines := []yamlLine{}
+	for n, text := range strings.Split(doc, "\n") {
+		content := strings.TrimLeft(text, " ")
+		if len(content) == 0 || strings.HasPrefix(content, "#") || content == "---" {
+			continue
+		}
+
+		l := yamlLine{number: n + 1, dash: -1}
+		column := len(text) - len(content)
+		if content == "-" || strings.HasPrefix(content, "- ") {
+			l.dash = column
+			rest := strings.TrimLeft(content[1:], " ")
+			column += len(content) - len(rest)
+			content = rest
+		}
+
+		l.column = column
+		if i := keyEnd(content); i > 0 {
+			l.key = strings.Trim(content[:i], `"'`)
+		}
+		lines = append(lines, l)
+	}
+
+	return lines
+}
+
+// keyEnd returns the length of the key of a mapping entry in content, or -1.
+func keyEnd(content string) int {
+	for i := 0; i < len(content); i++ {
+		if content[i] == ':' && (i+1 == len(content) || content[i+1] == ' ') {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// findKey returns the index of the entry key among the direct entries of
+// lines, the ones at the column of the first entry.
+func findKey(lines []yamlLine, key string) int {
+	if len(lines) == 0 {
+		return -1
+	}
+
+	column := lines[0].column
+	for i, l := range lines {
+		if l.column == column && l.key == key {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// findItem returns the index of the line starting the item index of the list
+// in lines.
+func findItem(lines []yamlLine, index int) int {
+	if len(lines) == 0 || lines[0].dash < 0 {
+		return -1
+	}
+
+	dash := lines[0].dash
+	for i, l := range lines {
+		if l.dash == dash {
+			if index == 0 {
+				return i
+			}
+			index--
+		}
+	}
+
+	return -1
+}
+
+// scope returns the range of lines holding the value of the entry or item
+// found at line i.
+func scope(lines []yamlLine, i, end int, elem interface{}) (int, int) {
+	l := lines[i]
+	if _, item := elem.(int); item {
+		// The entries of an item start on its own line.
+		for j := i + 1; j < end; j++ {
+			if lines[j].dash == l.dash || (lines[j].dash < 0 && lines[j].column <= l.dash) || (lines[j].dash >= 0 && lines[j].dash < l.dash) {
+				return i, j
+			}
+		}
+		return i, end
+	}
+
+	// The value of a key is indented further, or is a list at the same
+	// column.
+	for j := i + 1; j < end; j++ {
+		indent := lines[j].column
+		if lines[j].dash >= 0 {
+			indent = lines[j].dash
+		}
+		if indent < l.column || (indent == l.column && lines[j].dash < 0) {
+			return i + 1, j
+		}
+	}
+	return i + 1, end
+}
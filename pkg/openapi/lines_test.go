@@ -0,0 +1,70 @@
+package openapi
+
+import (
+	"testing"
+)
+
+const testManifest = `# The app.
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+  labels:
+    app: web
+spec:
+  template:
+    spec:
+      containers:
+      - name: web
+        image: nginx
+        ports:
+        - containerPort: 80
+          name: http
+        - containerPort: 443
+      - name: sidecar
+
+        # The sidecar has no ports.
+        image: envoy
+        args:
+          - --config
+          - /etc/envoy.yaml
+  selector: {matchLabels: {app: web}}
+`
+
+func TestLineOf(t *testing.T) {
+	tests := []struct {
+		path Path
+		want int
+	}{
+		{Path{"kind"}, 3},
+		{Path{"metadata", "name"}, 5},
+		{Path{"metadata", "labels", "app"}, 7},
+		{Path{"spec", "template", "spec", "containers"}, 11},
+		{Path{"spec", "template", "spec", "containers", 0}, 12},
+		{Path{"spec", "template", "spec", "containers", 0, "image"}, 13},
+		{Path{"spec", "template", "spec", "containers", 0, "ports", 1, "containerPort"}, 17},
+		{Path{"spec", "template", "spec", "containers", 0, "ports", 0, "name"}, 16},
+		{Path{"spec", "template", "spec", "containers", 1, "name"}, 18},
+		{Path{"spec", "template", "spec", "containers", 1, "image"}, 21},
+		{Path{"spec", "template", "spec", "containers", 1, "args", 1}, 24},
+		// Not found: the closest located parent.
+		{Path{"spec", "template", "spec", "containers", 2}, 11},
+		{Path{"metadata", "namespace"}, 4},
+		// Flow style.
+		{Path{"spec", "selector", "matchLabels"}, 25},
+		{Path{"status"}, 0},
+	}
+
+	for _, test := range tests {
+		if got := LineOf([]byte(testManifest), test.path); got != test.want {
+			t.Errorf("LineOf(%s) = %d, want %d", test.path, got, test.want)
+		}
+	}
+}
+
+func TestLineOfDocumentStart(t *testing.T) {
+	data := "---\n# comment\nkind: Service\nspec:\n  ports:\n  - port: 80\n"
+	if got := LineOf([]byte(data), Path{"spec", "ports", 0, "port"}); got != 6 {
+		t.Errorf("LineOf() = %d, want 6", got)
+	}
+}
@@ -0,0 +1,159 @@
+package openapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/rest"
+)
+
+// ErrNotServed is returned by NewClient when the cluster doesn't serve
+// OpenAPI v3, e.g. before Kubernetes 1.24.
+var ErrNotServed = errors.New("the cluster doesn't serve OpenAPI v3")
+
+// Schema is a node of an OpenAPI v3 schema, with the Kubernetes extensions
+// that matter for validation.
+type Schema struct {
+	Ref                  string                `json:"$ref"`
+	Type                 string                `json:"type"`
+	Format               string                `json:"format"`
+	Properties           map[string]*Schema    `json:"properties"`
+	AdditionalProperties *AdditionalProperties `json:"additionalProperties"`
+	Items                *Schema               `json:"items"`
+	Required             []string              `json:"required"`
+	AllOf                []*Schema             `json:"allOf"`
+	OneOf                []*Schema             `json:"oneOf"`
+	AnyOf                []*Schema             `json:"anyOf"`
+	Enum                 []interface{}         `json:"enum"`
+
+	PreserveUnknownFields bool                      `json:"x-kubernetes-preserve-unknown-fields"`
+	IntOrString           bool                      `json:"x-kubernetes-int-or-string"`
+	GroupVersionKinds     []schema.GroupVersionKind `json:"x-kubernetes-group-version-kind"`
+}
+
+// AdditionalProperties is either a boolean or the schema of the values of
+// the fields not listed in Properties.
+type AdditionalProperties struct {
+	Allowed bool
+	Schema  *Schema
+}
+
+func (a *AdditionalProperties) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &a.Allowed); err == nil {
+		return nil
+	}
+
+	a.Allowed = true
+	a.Schema = &Schema{}
+	return json.Unmarshal(data, a.Schema)
+}
+
+// Document is the OpenAPI v3 document of one group version.
+type Document struct {
+	Components struct {
+		Schemas map[string]*Schema `json:"schemas"`
+	} `json:"components"`
+}
+
+// KindSchema returns the schema of kind in d, or nil if d doesn't have it.
+func (d *Document) KindSchema(gvk schema.GroupVersionKind) *Schema {
+	for _, s := range d.Components.Schemas {
+		for _, k := range s.GroupVersionKinds {
+			if k == gvk {
+				return s
+			}
+		}
+	}
+
+	return nil
+}
+
+// Client fetches the OpenAPI v3 documents of a cluster, one per group
+// version, on first use.
+type Client struct {
+	client rest.Interface
+	paths  map[string]string
+
+	lock sync.Mutex
+	docs map[string]*Document
+}
+
+// NewClient lists the OpenAPI v3 documents served by the cluster of client,
+// which is usually the REST client of a discovery client.
+func NewClient(ctx context.Context, client rest.Interface) (*Client, error) {
+	data, err := client.Get().AbsPath("/openapi/v3").Do(ctx).Raw()
+	if apierrors.IsNotFound(err) {
+		return nil, ErrNotServed
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	index := struct {
+		Paths map[string]struct {
+			ServerRelativeURL string `json:"serverRelativeURL"`
+		} `json:"paths"`
+	}{}
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, fmt.Errorf("invalid OpenAPI v3 index: %s", err)
+	}
+
+	c := &Client{client: client, paths: map[string]string{}, docs: map[string]*Document{}}
+	for path, p := range index.Paths {
+		c.paths[path] = p.ServerRelativeURL
+	}
+
+	return c, nil
+}
+
+// Document returns the document of the group version gv, or nil if the
+// cluster doesn't serve gv.
+func (c *Client) Document(ctx context.Context, gv schema.GroupVersion) (*Document, error) {
+	path := "apis/" + gv.String()
+	if len(gv.Group) == 0 {
+		path = "api/" + gv.Version
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if doc, ok := c.docs[path]; ok {
+		return doc, nil
+	}
+
+	url, ok := c.paths[path]
+	if !ok {
+		return nil, nil
+	}
+
+	// The server relative URL carries a query with the hash of the document.
+	req := c.client.Get()
+	if i := strings.Index(url, "?"); i >= 0 {
+		for _, param := range strings.Split(url[i+1:], "&") {
+			kv := strings.SplitN(param, "=", 2)
+			if len(kv) == 2 {
+				req = req.Param(kv[0], kv[1])
+			}
+		}
+		url = url[:i]
+	}
+
+	data, err := req.AbsPath(url).Do(ctx).Raw()
+	if err != nil {
+		return nil, err
+	}
+
+	doc := &Document{}
+	if err := json.Unmarshal(data, doc); err != nil {
+		return nil, fmt.Errorf("invalid OpenAPI v3 document %s: %s", path, err)
+	}
+	c.docs[path] = doc
+
+	return doc, nil
+}
@@ -0,0 +1,243 @@
+package openapi
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+const (
+	refPrefix   = "#/components/schemas/"
+	quantityRef = refPrefix + "io.k8s.apimachinery.pkg.api.resource.Quantity"
+	// intOrStringFormat is the format apimachinery publishes
+	// intstr.IntOrString with.
+	intOrStringFormat = "int-or-string"
+)
+
+// Path is the location of a field in an object: map keys are strings and
+// list indexes ints.
+type Path []interface{}
+
+func (p Path) String() string {
+	var b strings.Builder
+	for _, elem := range p {
+		switch e := elem.(type) {
+		case int:
+			fmt.Fprintf(&b, "[%d]", e)
+		default:
+			if b.Len() > 0 {
+				b.WriteString(".")
+			}
+			fmt.Fprint(&b, e)
+		}
+	}
+
+	return b.String()
+}
+
+func (p Path) child(elem interface{}) Path {
+	child := make(Path, len(p), len(p)+1)
+	copy(child, p)
+	return append(child, elem)
+}
+
+// FieldError is a violation of a schema by the field at Path.
+type FieldError struct {
+	Path    Path
+	Message string
+}
+
+func (e FieldError) Error() string {
+	if len(e.Path) == 0 {
+		return e.Message
+	}
+	return fmt.Sprintf("%s: %s", e.Path, e.Message)
+}
+
+// Validate checks obj, as decoded from JSON, against the schema s of d. It
+// reports unknown fields, values of the wrong type or outside of an enum,
+// and missing required fields.
+func (d *Document) Validate(s *Schema, obj interface{}) []FieldError {
+	v := &validator{doc: d}
+	v.validate(s, obj, Path{})
+
+	return v.errors
+}
+
+type validator struct {
+	doc    *Document
+	errors []FieldError
+}
+
+func (v *validator) fail(path Path, format string, args ...interface{}) {
+	v.errors = append(v.errors, FieldError{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) validate(s *Schema, value interface{}, path Path) {
+	if s == nil || value == nil {
+		return
+	}
+
+	if len(s.Ref) > 0 {
+		// Quantities are strings in the schema, but numbers are accepted
+		// as well.
+		if s.Ref == quantityRef {
+			s = &Schema{IntOrString: true}
+		} else if ref, ok := v.doc.Components.Schemas[strings.TrimPrefix(s.Ref, refPrefix)]; ok {
+			s = ref
+		} else {
+			return
+		}
+	}
+
+	for _, sub := range s.AllOf {
+		v.validate(sub, value, path)
+	}
+	// Values matching more than one schema of a oneOf are accepted, e.g.
+	// when its schemas only differ by their required fields.
+	for _, alternatives := range [][]*Schema{s.OneOf, s.AnyOf} {
+		if len(alternatives) > 0 && !v.matchesAny(alternatives, value, path) {
+			v.fail(path, "%s doesn't match any of the %d allowed schemas", describe(value), len(alternatives))
+		}
+	}
+
+	if len(s.Enum) > 0 && !inEnum(s.Enum, value) {
+		v.fail(path, "unsupported value %s, expected one of %s", describe(value), enumString(s.Enum))
+	}
+
+	if s.IntOrString || s.Format == intOrStringFormat {
+		if _, ok := value.(string); !ok && !isInteger(value) {
+			v.fail(path, "expected integer or string, got %s", describe(value))
+		}
+		return
+	}
+
+	switch s.Type {
+	case "object":
+		v.validateObject(s, value, path)
+	case "array":
+		items, ok := value.([]interface{})
+		if !ok {
+			v.fail(path, "expected array, got %s", describe(value))
+			return
+		}
+		for i, item := range items {
+			v.validate(s.Items, item, path.child(i))
+		}
+	case "string":
+		if _, ok := value.(string); !ok {
+			v.fail(path, "expected string, got %s", describe(value))
+		}
+	case "integer":
+		if !isInteger(value) {
+			v.fail(path, "expected integer, got %s", describe(value))
+		}
+	case "number":
+		if _, ok := value.(float64); !ok {
+			v.fail(path, "expected number, got %s", describe(value))
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			v.fail(path, "expected boolean, got %s", describe(value))
+		}
+	case "":
+		if len(s.Properties) > 0 {
+			v.validateObject(s, value, path)
+		}
+	}
+}
+
+// matchesAny returns whether value is valid against one of the schemas.
+func (v *validator) matchesAny(schemas []*Schema, value interface{}, path Path) bool {
+	for _, s := range schemas {
+		sub := &validator{doc: v.doc}
+		sub.validate(s, value, path)
+		if len(sub.errors) == 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (v *validator) validateObject(s *Schema, value interface{}, path Path) {
+	obj, ok := value.(map[string]interface{})
+	if !ok {
+		v.fail(path, "expected object, got %s", describe(value))
+		return
+	}
+
+	for _, field := range s.Required {
+		if _, ok := obj[field]; !ok {
+			v.fail(path, "missing required field %q", field)
+		}
+	}
+
+	// Objects without properties, e.g. RawExtension, take any field.
+	open := s.PreserveUnknownFields || len(s.Properties) == 0 ||
+		(s.AdditionalProperties != nil && s.AdditionalProperties.Allowed)
+
+	fields := make([]string, 0, len(obj))
+	for field := range obj {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	for _, field := range fields {
+		if prop, ok := s.Properties[field]; ok {
+			v.validate(prop, obj[field], path.child(field))
+			continue
+		}
+
+		if s.AdditionalProperties != nil && s.AdditionalProperties.Schema != nil {
+			v.validate(s.AdditionalProperties.Schema, obj[field], path.child(field))
+			continue
+		}
+
+		if !open {
+			v.fail(path.child(field), "unknown field %q", field)
+		}
+	}
+}
+
+func isInteger(value interface{}) bool {
+	f, ok := value.(float64)
+	return ok && f == math.Trunc(f)
+}
+
+func inEnum(enum []interface{}, value interface{}) bool {
+	for _, e := range enum {
+		if fmt.Sprint(e) == fmt.Sprint(value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func enumString(enum []interface{}) string {
+	values := make([]string, len(enum))
+	for i, e := range enum {
+		values[i] = fmt.Sprintf("%q", fmt.Sprint(e))
+	}
+
+	return strings.Join(values, ", ")
+}
+
+func describe(value interface{}) string {
+	switch value.(type) {
+	case string:
+		return fmt.Sprintf("string %q", value)
+	case float64:
+		return fmt.Sprintf("number %v", value)
+	case bool:
+		return fmt.Sprintf("boolean %v", value)
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+
+	return fmt.Sprintf("%v", value)
+}
@@ -0,0 +1,148 @@
+package openapi
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// testDocument has the schemas of a deployment-like kind, in the shapes the
+// API servers publish them.
+const testDocument = `{
+	"components": {
+		"schemas": {
+			"test.App": {
+				"type": "object",
+				"required": ["spec"],
+				"properties": {
+					"apiVersion": {"type": "string"},
+					"kind": {"type": "string"},
+					"metadata": {"allOf": [{"$ref": "#/components/schemas/test.ObjectMeta"}]},
+					"spec": {"$ref": "#/components/schemas/test.AppSpec"}
+				},
+				"x-kubernetes-group-version-kind": [{"group": "test.io", "version": "v1", "kind": "App"}]
+			},
+			"test.ObjectMeta": {
+				"type": "object",
+				"properties": {
+					"name": {"type": "string"},
+					"labels": {"type": "object", "additionalProperties": {"type": "string"}}
+				}
+			},
+			"test.AppSpec": {
+				"type": "object",
+				"properties": {
+					"replicas": {"type": "integer"},
+					"paused": {"type": "boolean"},
+					"ratio": {"type": "number"},
+					"policy": {"type": "string", "enum": ["Always", "Never"]},
+					"port": {"$ref": "#/components/schemas/io.k8s.apimachinery.pkg.util.intstr.IntOrString"},
+					"maxSurge": {"oneOf": [{"type": "integer"}, {"type": "string"}]},
+					"maxUnavailable": {"x-kubernetes-int-or-string": true},
+					"memory": {"$ref": "#/components/schemas/io.k8s.apimachinery.pkg.api.resource.Quantity"},
+					"args": {"type": "array", "items": {"type": "string"}},
+					"selector": {"anyOf": [
+						{"type": "object", "properties": {"name": {"type": "string"}}},
+						{"type": "string"}
+					]},
+					"config": {"type": "object", "x-kubernetes-preserve-unknown-fields": true}
+				}
+			},
+			"io.k8s.apimachinery.pkg.util.intstr.IntOrString": {"type": "string", "format": "int-or-string"}
+		}
+	}
+}`
+
+func TestValidate(t *testing.T) {
+	doc := &Document{}
+	if err := json.Unmarshal([]byte(testDocument), doc); err != nil {
+		t.Fatal(err)
+	}
+	s := doc.KindSchema(schema.GroupVersionKind{Group: "test.io", Version: "v1", Kind: "App"})
+	if s == nil {
+		t.Fatal("KindSchema(App) = nil")
+	}
+
+	tests := []struct {
+		name   string
+		spec   string
+		errors []string
+	}{
+		{"valid", `{"replicas": 3, "paused": false, "ratio": 0.5, "policy": "Always", "args": ["a"]}`, nil},
+		{"integer", `{"replicas": "3"}`, []string{`spec.replicas: expected integer, got string "3"`}},
+		{"fraction", `{"replicas": 1.5}`, []string{"spec.replicas: expected integer, got number 1.5"}},
+		{"boolean", `{"paused": "yes"}`, []string{`spec.paused: expected boolean, got string "yes"`}},
+		{"number", `{"ratio": true}`, []string{"spec.ratio: expected number, got boolean true"}},
+		{"array", `{"args": "a"}`, []string{`spec.args: expected array, got string "a"`}},
+		{"item", `{"args": ["a", 1]}`, []string{"spec.args[1]: expected string, got number 1"}},
+		{"enum", `{"policy": "Sometimes"}`, []string{`spec.policy: unsupported value string "Sometimes", expected one of "Always", "Never"`}},
+		{"int-or-string format", `{"port": 8080}`, nil},
+		{"int-or-string format string", `{"port": "http"}`, nil},
+		{"int-or-string format mismatch", `{"port": true}`, []string{"spec.port: expected integer or string, got boolean true"}},
+		{"int-or-string oneOf", `{"maxSurge": 1}`, nil},
+		{"int-or-string oneOf string", `{"maxSurge": "25%"}`, nil},
+		{"int-or-string oneOf mismatch", `{"maxSurge": [1]}`, []string{"spec.maxSurge: array doesn't match any of the 2 allowed schemas"}},
+		{"int-or-string extension", `{"maxUnavailable": 0}`, nil},
+		{"int-or-string extension mismatch", `{"maxUnavailable": 0.5}`, []string{"spec.maxUnavailable: expected integer or string, got number 0.5"}},
+		{"quantity", `{"memory": 512}`, nil},
+		{"quantity string", `{"memory": "512Mi"}`, nil},
+		{"anyOf", `{"selector": {"name": "a"}}`, nil},
+		{"anyOf mismatch", `{"selector": {"name": 1}}`, []string{"spec.selector: object doesn't match any of the 2 allowed schemas"}},
+		{"unknown field", `{"replica": 3}`, []string{`spec.replica: unknown field "replica"`}},
+		{"preserved unknown fields", `{"config": {"anything": [1, "a"]}}`, nil},
+	}
+
+	for _, test := range tests {
+		obj := map[string]interface{}{}
+		data := `{"apiVersion": "test.io/v1", "kind": "App", "metadata": {"name": "app"}, "spec": ` + test.spec + `}`
+		if err := json.Unmarshal([]byte(data), &obj); err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+
+		if got := errorStrings(doc.Validate(s, obj)); strings.Join(got, "; ") != strings.Join(test.errors, "; ") {
+			t.Errorf("%s: Validate() = %q, want %q", test.name, got, test.errors)
+		}
+	}
+}
+
+func TestValidateObject(t *testing.T) {
+	doc := &Document{}
+	if err := json.Unmarshal([]byte(testDocument), doc); err != nil {
+		t.Fatal(err)
+	}
+	s := doc.KindSchema(schema.GroupVersionKind{Group: "test.io", Version: "v1", Kind: "App"})
+
+	tests := []struct {
+		name   string
+		obj    string
+		errors []string
+	}{
+		{"required", `{"metadata": {"name": "app"}}`, []string{`missing required field "spec"`}},
+		{"allOf", `{"metadata": {"name": 1}, "spec": {}}`, []string{"metadata.name: expected string, got number 1"}},
+		{"allOf unknown field", `{"metadata": {"nmae": "app"}, "spec": {}}`, []string{`metadata.nmae: unknown field "nmae"`}},
+		{"additionalProperties", `{"metadata": {"labels": {"app": 1}}, "spec": {}}`, []string{"metadata.labels.app: expected string, got number 1"}},
+		{"not an object", `{"spec": []}`, []string{"spec: expected object, got array"}},
+	}
+
+	for _, test := range tests {
+		obj := map[string]interface{}{}
+		if err := json.Unmarshal([]byte(test.obj), &obj); err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+
+		if got := errorStrings(doc.Validate(s, obj)); strings.Join(got, "; ") != strings.Join(test.errors, "; ") {
+			t.Errorf("%s: Validate() = %q, want %q", test.name, got, test.errors)
+		}
+	}
+}
+
+func errorStrings(errs []FieldError) []string {
+	strs := []string{}
+	for _, err := range errs {
+		strs = append(strs, err.Error())
+	}
+
+	return strs
+}
@@ -0,0 +1,283 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+var (
+	// ErrNotFound is returned when the registry doesn't have the repository
+	// or the tag or digest of an image.
+	ErrNotFound = errors.New("not found")
+	// ErrUnauthorized is returned when the registry refuses to serve an
+	// image with the credentials at hand, or without credentials.
+	ErrUnauthorized = errors.New("unauthorized")
+)
+
+// manifestTypes are the manifest media types accepted when resolving an
+// image, multi-platform indexes first so that their digest is returned.
+var manifestTypes = []string{
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}
+
+// Client resolves images with the Docker Registry v2 API.
+type Client struct {
+	// HTTPClient sends the requests, http.DefaultClient if nil.
+	HTTPClient *http.Client
+	// Insecure lists the registry hosts reached over plain HTTP. Registries
+	// on the loopback interface, like a local registry:2 stand-in, always
+	// are.
+	Insecure map[string]bool
+
+	lock   sync.Mutex
+	tokens map[string]string
+}
+
+// Resolve returns the digest of the manifest of ref, authenticating with the
+// credentials of its registry in keychain, if any.
+func (c *Client) Resolve(ctx context.Context, ref Reference, keychain Keychain) (string, error) {
+	manifestURL := fmt.Sprintf("%s://%s/v2/%s/manifests/%s", c.scheme(ref.Registry), ref.apiHost(), ref.Repository, ref.Version())
+	creds, hasCreds, err := keychain.Lookup(ref.Registry)
+	if err != nil {
+		return "", err
+	}
+	scope := "repository:" + ref.Repository + ":pull"
+	// Tokens are cached per registry, scope and user, as workloads may pull
+	// with different secrets.
+	tokenKey := ref.Registry + " " + scope + " " + creds.Username
+
+	resp, err := c.manifest(ctx, http.MethodHead, manifestURL, c.token(tokenKey))
+	if err != nil {
+		return "", err
+	}
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		challenge := resp.Header.Get("WWW-Authenticate")
+		authorization, err := c.authorize(ctx, challenge, scope, creds, hasCreds)
+		if err != nil {
+			return "", err
+		}
+		c.setToken(tokenKey, authorization)
+
+		resp, err = c.manifest(ctx, http.MethodHead, manifestURL, authorization)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	// Some registries don't support HEAD on manifests.
+	if resp.StatusCode == http.StatusMethodNotAllowed {
+		resp, err = c.manifest(ctx, http.MethodGet, manifestURL, c.token(tokenKey))
+		if err != nil {
+			return "", err
+		}
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return "", ErrNotFound
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return "", ErrUnauthorized
+	default:
+		return "", fmt.Errorf("unexpected status %s from %s", resp.Status, manifestURL)
+	}
+
+	digest := resp.Header.Get("Docker-Content-Digest")
+	if len(digest) == 0 && len(ref.Digest) > 0 {
+		digest = ref.Digest
+	}
+	if len(digest) == 0 {
+		return "", fmt.Errorf("no digest in the response of %s", manifestURL)
+	}
+
+	return digest, nil
+}
+
+func (c *Client) manifest(ctx context.Context, method, manifestURL, authorization string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, manifestURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", strings.Join(manifestTypes, ", "))
+	if len(authorization) > 0 {
+		req.Header.Set("Authorization", authorization)
+	}
+
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+
+	return resp, nil
+}
+
+// authorize answers the authentication challenge of a registry, with HTTP
+// basic authentication or a bearer token from its token service, and
+// returns the Authorization header to send.
+func (c *Client) authorize(ctx context.Context, challenge, scope string, creds Credentials, hasCreds bool) (string, error) {
+	authScheme, params := parseChallenge(challenge)
+	switch strings.ToLower(authScheme) {
+	case "basic":
+		if !hasCreds {
+			return "", ErrUnauthorized
+		}
+		req := &http.Request{Header: http.Header{}}
+		req.SetBasicAuth(creds.Username, creds.Password)
+		return req.Header.Get("Authorization"), nil
+	case "bearer":
+	default:
+		return "", fmt.Errorf("unsupported authentication challenge %q", challenge)
+	}
+
+	realm, err := url.Parse(params["realm"])
+	if err != nil || len(params["realm"]) == 0 {
+		return "", fmt.Errorf("invalid realm in authentication challenge %q", challenge)
+	}
+	query := realm.Query()
+	if service, ok := params["service"]; ok {
+		query.Set("service", service)
+	}
+	query.Set("scope", scope)
+	realm.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	if hasCreds {
+		if len(creds.IdentityToken) > 0 {
+			req.Header.Set("Authorization", "Bearer "+creds.IdentityToken)
+		} else {
+			req.SetBasicAuth(creds.Username, creds.Password)
+		}
+	}
+
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return "", ErrUnauthorized
+	default:
+		return "", fmt.Errorf("unexpected status %s from the token service %s", resp.Status, realm.Host)
+	}
+
+	token := struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("invalid response from the token service %s: %s", realm.Host, err)
+	}
+	if len(token.Token) == 0 {
+		token.Token = token.AccessToken
+	}
+	if len(token.Token) == 0 {
+		return "", fmt.Errorf("no token in the response of the token service %s", realm.Host)
+	}
+
+	return "Bearer " + token.Token, nil
+}
+
+// parseChallenge splits a WWW-Authenticate header, e.g.
+// Bearer realm="https://auth.docker.io/token",service="registry.docker.io",
+// into its scheme and parameters.
+func parseChallenge(challenge string) (string, map[string]string) {
+	params := map[string]string{}
+	challenge = strings.TrimSpace(challenge)
+	i := strings.Index(challenge, " ")
+	if i < 0 {
+		return challenge, params
+	}
+
+	authScheme, rest := challenge[:i], challenge[i+1:]
+	for len(rest) > 0 {
+		rest = strings.TrimLeft(rest, " ,")
+		eq := strings.Index(rest, "=")
+		if eq < 0 {
+			break
+		}
+		key := strings.ToLower(strings.TrimSpace(rest[:eq]))
+		rest = rest[eq+1:]
+
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				value, rest = rest[1:], ""
+			} else {
+				value, rest = rest[1:end+1], rest[end+2:]
+			}
+		} else if comma := strings.Index(rest, ","); comma >= 0 {
+			value, rest = rest[:comma], rest[comma:]
+		} else {
+			value, rest = rest, ""
+		}
+		params[key] = value
+	}
+
+	return authScheme, params
+}
+
+func (c *Client) scheme(registry string) string {
+	if c.Insecure[registry] {
+		return "http"
+	}
+
+	host := registry
+	if h, _, err := net.SplitHostPort(registry); err == nil {
+		host = h
+	}
+	if host == "localhost" {
+		return "http"
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return "http"
+	}
+
+	return "https"
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+
+	return http.DefaultClient
+}
+
+func (c *Client) token(key string) string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.tokens[key]
+}
+
+func (c *Client) setToken(key, authorization string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.tokens == nil {
+		c.tokens = map[string]string{}
+	}
+	c.tokens[key] = authorization
+}
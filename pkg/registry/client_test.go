@@ -0,0 +1,245 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testDigest = "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+// testRegistry is a Registry v2 API with a token service, serving the tags of
+// its repositories to the clients with a token for their pull scope.
+type testRegistry struct {
+	server *httptest.Server
+	// tags are the tags served, by repository.
+	tags map[string][]string
+	// users are the passwords of the users allowed to pull, anonymous pulls
+	// are allowed when empty.
+	users map[string]string
+	// noHead answers HEAD requests of manifests with 405.
+	noHead bool
+	// basic asks for HTTP basic authentication instead of bearer tokens.
+	basic bool
+
+	tokenRequests int
+}
+
+func newTestRegistry(t *testing.T) *testRegistry {
+	r := &testRegistry{tags: map[string][]string{}, users: map[string]string{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", r.token)
+	mux.HandleFunc("/v2/", r.manifest)
+	r.server = httptest.NewServer(mux)
+	t.Cleanup(r.server.Close)
+
+	return r
+}
+
+// host is the registry host of r, on the loopback interface.
+func (r *testRegistry) host() string {
+	return strings.TrimPrefix(r.server.URL, "http://")
+}
+
+func (r *testRegistry) token(w http.ResponseWriter, req *http.Request) {
+	r.tokenRequests++
+	if req.URL.Query().Get("service") != "test-registry" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if len(r.users) > 0 {
+		user, password, ok := req.BasicAuth()
+		if !ok || r.users[user] != password {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{"access_token": "token " + req.URL.Query().Get("scope")})
+}
+
+func (r *testRegistry) manifest(w http.ResponseWriter, req *http.Request) {
+	path := strings.TrimPrefix(req.URL.Path, "/v2/")
+	i := strings.LastIndex(path, "/manifests/")
+	if i < 0 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	repository, version := path[:i], path[i+len("/manifests/"):]
+
+	if r.basic {
+		user, password, ok := req.BasicAuth()
+		if !ok || r.users[user] != password {
+			w.Header().Set("WWW-Authenticate", `Basic realm="test-registry"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+	} else if req.Header.Get("Authorization") != "Bearer token repository:"+repository+":pull" {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="`+r.server.URL+`/token",service="test-registry",scope="repository:`+repository+`:pull"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	if r.noHead && req.Method == http.MethodHead {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if !strings.Contains(req.Header.Get("Accept"), "application/vnd.oci.image.index.v1+json") {
+		w.WriteHeader(http.StatusNotAcceptable)
+		return
+	}
+
+	for _, tag := range r.tags[repository] {
+		if tag == version || version == testDigest {
+			w.Header().Set("Docker-Content-Digest", testDigest)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNotFound)
+}
+
+func resolve(t *testing.T, client *Client, image string, keychain Keychain) (string, error) {
+	ref, err := ParseReference(image)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return client.Resolve(context.Background(), ref, keychain)
+}
+
+func TestResolveBearer(t *testing.T) {
+	r := newTestRegistry(t)
+	r.tags["team/app"] = []string{"1.0"}
+	client := &Client{}
+
+	digest, err := resolve(t, client, r.host()+"/team/app:1.0", Keychain{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if digest != testDigest {
+		t.Errorf("digest = %q, want %q", digest, testDigest)
+	}
+
+	// The token of the scope is reused.
+	if _, err := resolve(t, client, r.host()+"/team/app:1.0", Keychain{}); err != nil {
+		t.Fatal(err)
+	}
+	if r.tokenRequests != 1 {
+		t.Errorf("requested %d tokens, want 1", r.tokenRequests)
+	}
+
+	if _, err := resolve(t, client, r.host()+"/team/app:2.0", Keychain{}); err != ErrNotFound {
+		t.Errorf("err = %v, want ErrNotFound", err)
+	}
+	if _, err := resolve(t, client, r.host()+"/team/other:1.0", Keychain{}); err != ErrNotFound {
+		t.Errorf("err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestResolveCredentials(t *testing.T) {
+	r := newTestRegistry(t)
+	r.tags["team/app"] = []string{"1.0"}
+	r.users["puller"] = "secret"
+	image := r.host() + "/team/app:1.0"
+
+	if _, err := resolve(t, &Client{}, image, Keychain{}); err != ErrUnauthorized {
+		t.Errorf("anonymous: err = %v, want ErrUnauthorized", err)
+	}
+
+	wrong := Keychain{auths: map[string]Credentials{r.host(): {Username: "puller", Password: "wrong"}}}
+	if _, err := resolve(t, &Client{}, image, wrong); err != ErrUnauthorized {
+		t.Errorf("wrong password: err = %v, want ErrUnauthorized", err)
+	}
+
+	right := Keychain{auths: map[string]Credentials{r.host(): {Username: "puller", Password: "secret"}}}
+	if digest, err := resolve(t, &Client{}, image, right); err != nil || digest != testDigest {
+		t.Errorf("digest, err = %q, %v, want %q", digest, err, testDigest)
+	}
+}
+
+func TestResolveBasic(t *testing.T) {
+	r := newTestRegistry(t)
+	r.tags["app"] = []string{"1.0"}
+	r.users["puller"] = "secret"
+	r.basic = true
+
+	if _, err := resolve(t, &Client{}, r.host()+"/app:1.0", Keychain{}); err != ErrUnauthorized {
+		t.Errorf("anonymous: err = %v, want ErrUnauthorized", err)
+	}
+
+	keychain := Keychain{auths: map[string]Credentials{r.host(): {Username: "puller", Password: "secret"}}}
+	if digest, err := resolve(t, &Client{}, r.host()+"/app:1.0", keychain); err != nil || digest != testDigest {
+		t.Errorf("digest, err = %q, %v, want %q", digest, err, testDigest)
+	}
+}
+
+func TestResolveWithoutHead(t *testing.T) {
+	r := newTestRegistry(t)
+	r.tags["app"] = []string{"1.0"}
+	r.noHead = true
+
+	if digest, err := resolve(t, &Client{}, r.host()+"/app:1.0", Keychain{}); err != nil || digest != testDigest {
+		t.Errorf("digest, err = %q, %v, want %q", digest, err, testDigest)
+	}
+}
+
+func TestParseChallenge(t *testing.T) {
+	tests := []struct {
+		challenge string
+		scheme    string
+		params    map[string]string
+	}{
+		{
+			challenge: `Bearer realm="https://auth.docker.io/token",service="registry.docker.io"`,
+			scheme:    "Bearer",
+			params:    map[string]string{"realm": "https://auth.docker.io/token", "service": "registry.docker.io"},
+		},
+		{
+			challenge: `Bearer realm="https://example.com/token", service="example.com", scope="repository:a/b:pull,push"`,
+			scheme:    "Bearer",
+			params:    map[string]string{"realm": "https://example.com/token", "service": "example.com", "scope": "repository:a/b:pull,push"},
+		},
+		{
+			challenge: `Basic realm=registry`,
+			scheme:    "Basic",
+			params:    map[string]string{"realm": "registry"},
+		},
+		{
+			challenge: `Basic`,
+			scheme:    "Basic",
+			params:    map[string]string{},
+		},
+		{
+			challenge: `Bearer Realm="unterminated`,
+			scheme:    "Bearer",
+			params:    map[string]string{"realm": "unterminated"},
+		},
+	}
+
+	for _, test := range tests {
+		scheme, params := parseChallenge(test.challenge)
+		if scheme != test.scheme || !reflect.DeepEqual(params, test.params) {
+			t.Errorf("parseChallenge(%q) = %q, %v, want %q, %v", test.challenge, scheme, params, test.scheme, test.params)
+		}
+	}
+}
+
+func TestScheme(t *testing.T) {
+	client := &Client{Insecure: map[string]bool{"registry.local:5000": true}}
+	for registry, want := range map[string]string{
+		"registry.local:5000": "http",
+		"localhost:5000":      "http",
+		"127.0.0.1:5000":      "http",
+		"[::1]:5000":          "http",
+		"registry.local":      "https",
+		"docker.io":           "https",
+	} {
+		if got := client.scheme(registry); got != want {
+			t.Errorf("scheme(%q) = %q, want %q", registry, got, want)
+		}
+	}
+}
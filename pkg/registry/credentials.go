@@ -0,0 +1,279 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// helperTimeout bounds a run of a docker credential helper.
+	helperTimeout = 30 * time.Second
+
+	// helperTokenUsername is the user name a credential helper returns
+	// with an identity token instead of a password.
+	helperTokenUsername = "<token>"
+
+	// dockerHubServer is the server the credentials of DockerHub are
+	// stored under.
+	dockerHubServer = "https://index.docker.io/v1/"
+)
+
+// Credentials authenticate to a registry, with a user name and password or
+// an identity token.
+type Credentials struct {
+	Username      string
+	Password      string
+	IdentityToken string
+}
+
+// Keychain holds the credentials of registries, by registry host, and the
+// docker credential helpers asked for the registries it has none for.
+type Keychain struct {
+	auths   map[string]Credentials
+	helpers *credentialHelpers
+}
+
+// dockerAuth is an entry of a docker config file.
+type dockerAuth struct {
+	Auth          string `json:"auth"`
+	Username      string `json:"username"`
+	Password      string `json:"password"`
+	IdentityToken string `json:"identitytoken"`
+}
+
+// dockerConfig is a docker config file.
+type dockerConfig struct {
+	Auths       map[string]dockerAuth `json:"auths"`
+	CredHelpers map[string]string     `json:"credHelpers"`
+	CredsStore  string                `json:"credsStore"`
+}
+
+// ParseDockerConfig parses the credentials of a docker config file, either
+// ~/.docker/config.json and the .dockerconfigjson of image pull secrets, or
+// the legacy .dockercfg format without the auths key. Credential helpers
+// are ignored, like the kubelet does, see LoadDockerConfig.
+func ParseDockerConfig(data []byte) (Keychain, error) {
+	config, err := parseDockerConfig(data)
+	if err != nil {
+		return Keychain{}, err
+	}
+
+	return config.keychain()
+}
+
+func parseDockerConfig(data []byte) (*dockerConfig, error) {
+	config := &dockerConfig{}
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("invalid docker config: %s", err)
+	}
+
+	if config.Auths == nil && len(config.CredHelpers) == 0 && len(config.CredsStore) == 0 {
+		if err := json.Unmarshal(data, &config.Auths); err != nil {
+			return nil, fmt.Errorf("invalid docker config: %s", err)
+		}
+	}
+
+	return config, nil
+}
+
+// keychain returns the credentials of the auths of config. Entries without
+// credentials, like the ones docker login leaves when the credentials are
+// in a credential helper, are skipped.
+func (config *dockerConfig) keychain() (Keychain, error) {
+	keychain := Keychain{auths: map[string]Credentials{}}
+	for server, auth := range config.Auths {
+		creds := Credentials{Username: auth.Username, Password: auth.Password, IdentityToken: auth.IdentityToken}
+		if len(auth.Auth) > 0 {
+			decoded, err := base64.StdEncoding.DecodeString(auth.Auth)
+			if err != nil {
+				return Keychain{}, fmt.Errorf("invalid auth of %s in docker config: %s", server, err)
+			}
+			userPass := strings.SplitN(string(decoded), ":", 2)
+			if len(userPass) != 2 {
+				return Keychain{}, fmt.Errorf("invalid auth of %s in docker config", server)
+			}
+			creds.Username, creds.Password = userPass[0], userPass[1]
+		}
+		if creds == (Credentials{}) {
+			continue
+		}
+		keychain.auths[registryHost(server)] = creds
+	}
+
+	return keychain, nil
+}
+
+// LoadDockerConfig reads the credentials of the docker config file at path,
+// together with its credential helpers: the docker-credential-<name> helper
+// of a registry in credHelpers is asked for its credentials first, then its
+// entry in auths is used, and otherwise the helper of credsStore is asked.
+func LoadDockerConfig(path string) (Keychain, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Keychain{}, err
+	}
+
+	config, err := parseDockerConfig(data)
+	if err != nil {
+		return Keychain{}, err
+	}
+	keychain, err := config.keychain()
+	if err != nil {
+		return Keychain{}, err
+	}
+
+	if len(config.CredHelpers) == 0 && len(config.CredsStore) == 0 {
+		return keychain, nil
+	}
+
+	helpers := &credentialHelpers{
+		registries: map[string]string{},
+		store:      config.CredsStore,
+		cache:      map[string]helperCredentials{},
+	}
+	for server, helper := range config.CredHelpers {
+		host := registryHost(server)
+		helpers.registries[host] = helper
+		delete(keychain.auths, host)
+	}
+	keychain.helpers = helpers
+
+	return keychain, nil
+}
+
+// registryHost normalizes the server of a docker config entry, which may be
+// a URL like https://index.docker.io/v1/, to a registry host.
+func registryHost(server string) string {
+	host := strings.TrimPrefix(strings.TrimPrefix(server, "https://"), "http://")
+	if i := strings.Index(host, "/"); i >= 0 {
+		host = host[:i]
+	}
+
+	switch host {
+	case "index.docker.io", dockerHubAPI:
+		return DockerHub
+	}
+
+	return host
+}
+
+// Merge returns a keychain with the credentials of k and other, where the
+// ones of k win. The credential helpers of k, or else those of other, are
+// asked for the registries neither has credentials for.
+func (k Keychain) Merge(other Keychain) Keychain {
+	merged := Keychain{auths: map[string]Credentials{}, helpers: k.helpers}
+	for host, creds := range other.auths {
+		merged.auths[host] = creds
+	}
+	for host, creds := range k.auths {
+		merged.auths[host] = creds
+	}
+	if merged.helpers == nil {
+		merged.helpers = other.helpers
+	}
+
+	return merged
+}
+
+// Lookup returns the credentials of registry, if any. It fails when a
+// credential helper fails for another reason than having no credentials
+// for registry.
+func (k Keychain) Lookup(registry string) (Credentials, bool, error) {
+	if creds, ok := k.auths[registry]; ok {
+		return creds, true, nil
+	}
+	if k.helpers == nil {
+		return Credentials{}, false, nil
+	}
+
+	return k.helpers.get(registry)
+}
+
+// credentialHelpers runs the docker credential helpers of a docker config,
+// once per registry.
+type credentialHelpers struct {
+	registries map[string]string
+	store      string
+
+	lock  sync.Mutex
+	cache map[string]helperCredentials
+}
+
+type helperCredentials struct {
+	creds Credentials
+	found bool
+	err   error
+}
+
+func (h *credentialHelpers) get(registry string) (Credentials, bool, error) {
+	helper, ok := h.registries[registry]
+	if !ok {
+		helper = h.store
+	}
+	if len(helper) == 0 {
+		return Credentials{}, false, nil
+	}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	cached, ok := h.cache[registry]
+	if !ok {
+		cached.creds, cached.found, cached.err = runCredentialHelper(helper, registry)
+		h.cache[registry] = cached
+	}
+
+	return cached.creds, cached.found, cached.err
+}
+
+// runCredentialHelper asks docker-credential-<helper> for the credentials of
+// registry, with the protocol of docker login: the server on the standard
+// input of "get", and the credentials as JSON on its output.
+func runCredentialHelper(helper, registry string) (Credentials, bool, error) {
+	server := registry
+	if registry == DockerHub {
+		server = dockerHubServer
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), helperTimeout)
+	defer cancel()
+
+	name := "docker-credential-" + helper
+	cmd := exec.CommandContext(ctx, name, "get")
+	cmd.Stdin = strings.NewReader(server)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		// Helpers print this when they have no credentials for the server.
+		output := strings.TrimSpace(stdout.String() + stderr.String())
+		if strings.Contains(output, "credentials not found") {
+			return Credentials{}, false, nil
+		}
+		if len(output) > 0 {
+			return Credentials{}, false, fmt.Errorf("%s failed for %s: %s: %s", name, registry, err, output)
+		}
+		return Credentials{}, false, fmt.Errorf("%s failed for %s: %s", name, registry, err)
+	}
+
+	resp := struct {
+		Username string
+		Secret   string
+	}{}
+	if err := json.Unmarshal(stdout.Bytes(), &resp); err != nil {
+		return Credentials{}, false, fmt.Errorf("invalid output of %s for %s: %s", name, registry, err)
+	}
+
+	if resp.Username == helperTokenUsername {
+		return Credentials{IdentityToken: resp.Secret}, true, nil
+	}
+
+	return Credentials{Username: resp.Username, Password: resp.Secret}, true, nil
+}
@@ -0,0 +1,117 @@
+package registry
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseDockerConfig(t *testing.T) {
+	keychain, err := ParseDockerConfig([]byte(`{
+		"auths": {
+			"https://index.docker.io/v1/": {"auth": "dXNlcjpwYXNz"},
+			"registry.local:5000": {"username": "puller", "password": "secret"},
+			"ghcr.io": {"identitytoken": "id-token"},
+			"quay.io": {}
+		},
+		"credsStore": "desktop"
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for registry, want := range map[string]Credentials{
+		"docker.io":           {Username: "user", Password: "pass"},
+		"registry.local:5000": {Username: "puller", Password: "secret"},
+		"ghcr.io":             {IdentityToken: "id-token"},
+	} {
+		if creds, ok, err := keychain.Lookup(registry); err != nil || !ok || creds != want {
+			t.Errorf("Lookup(%q) = %+v, %t, %v, want %+v", registry, creds, ok, err, want)
+		}
+	}
+	// Empty entries and, for image pull secrets, credential helpers are
+	// ignored.
+	if _, ok, _ := keychain.Lookup("quay.io"); ok {
+		t.Errorf("Lookup(quay.io) found credentials in an empty entry")
+	}
+}
+
+func TestParseLegacyDockerConfig(t *testing.T) {
+	keychain, err := ParseDockerConfig([]byte(`{"registry.local": {"auth": "dXNlcjpwYXNz"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if creds, ok, _ := keychain.Lookup("registry.local"); !ok || creds.Username != "user" {
+		t.Errorf("Lookup(registry.local) = %+v, %t, want user", creds, ok)
+	}
+}
+
+// installHelper puts a docker-credential-<name> script printing output for
+// server, and failing like the helpers do for the other servers, first on
+// the PATH until the end of the test.
+func installHelper(t *testing.T, dir, name, server, output string) {
+	script := "#!/bin/sh\n" +
+		"read server\n" +
+		"if [ \"$server\" = '" + server + "' ]; then echo '" + output + "'; exit 0; fi\n" +
+		"echo 'credentials not found in native keychain'; exit 1\n"
+	path := filepath.Join(dir, "docker-credential-"+name)
+	if err := ioutil.WriteFile(path, []byte(script), 0700); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadDockerConfigHelpers(t *testing.T) {
+	dir := t.TempDir()
+	installHelper(t, dir, "ecr", "1111.dkr.ecr.us-east-1.amazonaws.com", `{"Username": "AWS", "Secret": "ecr-password"}`)
+	installHelper(t, dir, "store", dockerHubServer, `{"Username": "<token>", "Secret": "hub-token"}`)
+	path := os.Getenv("PATH")
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+path)
+	defer os.Setenv("PATH", path)
+
+	config := filepath.Join(dir, "config.json")
+	err := ioutil.WriteFile(config, []byte(`{
+		"auths": {
+			"1111.dkr.ecr.us-east-1.amazonaws.com": {"auth": "c3RhbGU6c3RhbGU="},
+			"registry.local": {"auth": "dXNlcjpwYXNz"}
+		},
+		"credHelpers": {"1111.dkr.ecr.us-east-1.amazonaws.com": "ecr", "broken.local": "missing"},
+		"credsStore": "store"
+	}`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keychain, err := LoadDockerConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for registry, want := range map[string]Credentials{
+		// The helper of a registry wins over its auths.
+		"1111.dkr.ecr.us-east-1.amazonaws.com": {Username: "AWS", Password: "ecr-password"},
+		"registry.local":                       {Username: "user", Password: "pass"},
+		"docker.io":                            {IdentityToken: "hub-token"},
+	} {
+		if creds, ok, err := keychain.Lookup(registry); err != nil || !ok || creds != want {
+			t.Errorf("Lookup(%q) = %+v, %t, %v, want %+v", registry, creds, ok, err, want)
+		}
+	}
+
+	if _, ok, err := keychain.Lookup("quay.io"); ok || err != nil {
+		t.Errorf("Lookup(quay.io) = %t, %v, want no credentials", ok, err)
+	}
+	if _, _, err := keychain.Lookup("broken.local"); err == nil || !strings.Contains(err.Error(), "docker-credential-missing") {
+		t.Errorf("Lookup(broken.local) err = %v, want the failure of the helper", err)
+	}
+
+	// Image pull secrets win over the helpers of the docker config.
+	secrets := Keychain{auths: map[string]Credentials{"docker.io": {Username: "secret", Password: "secret"}}}
+	if creds, _, _ := secrets.Merge(keychain).Lookup("docker.io"); creds.Username != "secret" {
+		t.Errorf("merged Lookup(docker.io) = %+v, want the credentials of the secret", creds)
+	}
+	if creds, _, _ := secrets.Merge(keychain).Lookup("1111.dkr.ecr.us-east-1.amazonaws.com"); creds.Password != "ecr-password" {
+		t.Errorf("merged Lookup(ecr) = %+v, want the credentials of the helper", creds)
+	}
+}
@@ -0,0 +1,50 @@
+package registry
+
+import (
+	"strings"
+)
+
+// Mapping maps the registries of images to other ones, e.g.
+// 1111.dkr.ecr.us-east-1 to 2222.dkr.ecr.us-west-2 for images replicated
+// across accounts or regions. A source is a prefix of image names: a
+// registry host, or the start of one when followed by a dot, optionally with
+// repository path components.
+type Mapping map[string]string
+
+// Rewrite returns image with its registry mapped, and whether a source of m
+// matched it. The longest matching source wins.
+func (m Mapping) Rewrite(image string) (string, bool) {
+	match, prefix := "", ""
+	for source := range m {
+		trimmed := strings.TrimSuffix(source, "/")
+		if len(trimmed) > len(prefix) && matchesPrefix(image, trimmed) {
+			match, prefix = source, trimmed
+		}
+	}
+	if len(prefix) == 0 {
+		return image, false
+	}
+
+	return strings.TrimSuffix(m[match], "/") + image[len(prefix):], true
+}
+
+// matchesPrefix reports whether source is a prefix of image ending at a
+// boundary of its name: a path separator, a tag or digest, or a dot of the
+// registry host.
+func matchesPrefix(image, source string) bool {
+	if !strings.HasPrefix(image, source) {
+		return false
+	}
+	if len(image) == len(source) {
+		return true
+	}
+
+	switch image[len(source)] {
+	case '/', ':', '@':
+		return true
+	case '.':
+		return !strings.Contains(source, "/")
+	}
+
+	return false
+}
@@ -0,0 +1,33 @@
+package registry
+
+import (
+	"testing"
+)
+
+func TestMappingRewrite(t *testing.T) {
+	m := Mapping{
+		"1111.dkr.ecr.us-east-1":                         "2222.dkr.ecr.us-west-2",
+		"1111.dkr.ecr.us-east-1.amazonaws.com/platform/": "registry.local/platform",
+		"docker.io": "mirror.local/hub",
+	}
+
+	tests := []struct {
+		image   string
+		want    string
+		matched bool
+	}{
+		{"1111.dkr.ecr.us-east-1.amazonaws.com/app:1.0", "2222.dkr.ecr.us-west-2.amazonaws.com/app:1.0", true},
+		{"1111.dkr.ecr.us-east-1.amazonaws.com/platform/api@sha256:abc", "registry.local/platform/api@sha256:abc", true},
+		{"1111.dkr.ecr.us-east-1.amazonaws.com/platformer:1", "2222.dkr.ecr.us-west-2.amazonaws.com/platformer:1", true},
+		{"docker.io/library/nginx", "mirror.local/hub/library/nginx", true},
+		{"1111.dkr.ecr.us-east-10.amazonaws.com/app", "1111.dkr.ecr.us-east-10.amazonaws.com/app", false},
+		{"nginx:1.21", "nginx:1.21", false},
+	}
+
+	for _, test := range tests {
+		got, matched := m.Rewrite(test.image)
+		if got != test.want || matched != test.matched {
+			t.Errorf("Rewrite(%q) = %q, %t, want %q, %t", test.image, got, matched, test.want, test.matched)
+		}
+	}
+}
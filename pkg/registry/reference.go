@@ -0,0 +1,112 @@
+package registry
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// DockerHub is the registry of image names without a registry host.
+	DockerHub = "docker.io"
+	// dockerHubAPI is the host serving the Registry v2 API of DockerHub.
+	dockerHubAPI = "registry-1.docker.io"
+
+	defaultTag = "latest"
+)
+
+// Reference is a parsed container image name, e.g.
+// 1111.dkr.ecr.us-east-1.amazonaws.com/app:1.2 or nginx@sha256:....
+type Reference struct {
+	Registry   string
+	Repository string
+	Tag        string
+	Digest     string
+}
+
+// ParseReference parses image like the container runtimes do: the first
+// path component is the registry when it looks like a host, i.e. has a dot
+// or a port or is localhost, else the image is on DockerHub, where single
+// component names are in the library namespace. The tag defaults to latest
+// unless the image is pinned to a digest.
+func ParseReference(image string) (Reference, error) {
+	ref := Reference{}
+	name := image
+
+	if i := strings.Index(name, "@"); i >= 0 {
+		ref.Digest = name[i+1:]
+		name = name[:i]
+		if !strings.Contains(ref.Digest, ":") {
+			return Reference{}, fmt.Errorf("invalid digest in image %q", image)
+		}
+	}
+
+	// A colon after the last slash starts the tag, one before is a port.
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		ref.Tag = name[i+1:]
+		name = name[:i]
+	}
+
+	if i := strings.Index(name, "/"); i >= 0 && isHost(name[:i]) {
+		ref.Registry = name[:i]
+		name = name[i+1:]
+	} else {
+		ref.Registry = DockerHub
+		if !strings.Contains(name, "/") {
+			name = "library/" + name
+		}
+	}
+	if ref.Registry == "index.docker.io" {
+		ref.Registry = DockerHub
+	}
+
+	if len(name) == 0 || name != strings.ToLower(name) || strings.HasSuffix(name, "/") || strings.Contains(name, "//") {
+		return Reference{}, fmt.Errorf("invalid repository in image %q", image)
+	}
+	ref.Repository = name
+
+	if len(ref.Tag) == 0 && len(ref.Digest) == 0 {
+		ref.Tag = defaultTag
+	}
+
+	return ref, nil
+}
+
+func isHost(component string) bool {
+	return strings.ContainsAny(component, ".:") || component == "localhost"
+}
+
+// Name returns the image name, without tag nor digest.
+func (r Reference) Name() string {
+	return r.Registry + "/" + r.Repository
+}
+
+// Version returns the digest of r if pinned to one, else its tag, as used in
+// the manifest URLs of the Registry v2 API.
+func (r Reference) Version() string {
+	if len(r.Digest) > 0 {
+		return r.Digest
+	}
+
+	return r.Tag
+}
+
+func (r Reference) String() string {
+	s := r.Name()
+	if len(r.Tag) > 0 {
+		s += ":" + r.Tag
+	}
+	if len(r.Digest) > 0 {
+		s += "@" + r.Digest
+	}
+
+	return s
+}
+
+// apiHost returns the host serving the Registry v2 API of the registry of r.
+func (r Reference) apiHost() string {
+	if r.Registry == DockerHub {
+		return dockerHubAPI
+	}
+
+	return r.Registry
+}
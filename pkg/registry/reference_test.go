@@ -0,0 +1,64 @@
+package registry
+
+import (
+	"testing"
+)
+
+func TestParseReference(t *testing.T) {
+	digest := "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+	tests := []struct {
+		image string
+		want  Reference
+		str   string
+	}{
+		{"nginx", Reference{Registry: "docker.io", Repository: "library/nginx", Tag: "latest"}, "docker.io/library/nginx:latest"},
+		{"nginx:1.21", Reference{Registry: "docker.io", Repository: "library/nginx", Tag: "1.21"}, "docker.io/library/nginx:1.21"},
+		{"bitnami/redis:6", Reference{Registry: "docker.io", Repository: "bitnami/redis", Tag: "6"}, "docker.io/bitnami/redis:6"},
+		{"index.docker.io/library/nginx", Reference{Registry: "docker.io", Repository: "library/nginx", Tag: "latest"}, "docker.io/library/nginx:latest"},
+		{"localhost/app", Reference{Registry: "localhost", Repository: "app", Tag: "latest"}, "localhost/app:latest"},
+		{"localhost:5000/team/app:2", Reference{Registry: "localhost:5000", Repository: "team/app", Tag: "2"}, "localhost:5000/team/app:2"},
+		{
+			"1111.dkr.ecr.us-east-1.amazonaws.com/app:1.2",
+			Reference{Registry: "1111.dkr.ecr.us-east-1.amazonaws.com", Repository: "app", Tag: "1.2"},
+			"1111.dkr.ecr.us-east-1.amazonaws.com/app:1.2",
+		},
+		{"nginx@" + digest, Reference{Registry: "docker.io", Repository: "library/nginx", Digest: digest}, "docker.io/library/nginx@" + digest},
+		{
+			"quay.io/org/app:1.0@" + digest,
+			Reference{Registry: "quay.io", Repository: "org/app", Tag: "1.0", Digest: digest},
+			"quay.io/org/app:1.0@" + digest,
+		},
+	}
+
+	for _, test := range tests {
+		ref, err := ParseReference(test.image)
+		if err != nil {
+			t.Errorf("ParseReference(%q) failed: %s", test.image, err)
+			continue
+		}
+		if ref != test.want {
+			t.Errorf("ParseReference(%q) = %+v, want %+v", test.image, ref, test.want)
+		}
+		if ref.String() != test.str {
+			t.Errorf("ParseReference(%q).String() = %q, want %q", test.image, ref.String(), test.str)
+		}
+	}
+}
+
+func TestParseReferenceInvalid(t *testing.T) {
+	for _, image := range []string{"", "Nginx", "registry.local/App:1", "nginx@latest", "registry.local/", "team//app"} {
+		if ref, err := ParseReference(image); err == nil {
+			t.Errorf("ParseReference(%q) = %+v, want an error", image, ref)
+		}
+	}
+}
+
+func TestReferenceVersion(t *testing.T) {
+	ref, _ := ParseReference("app:1.0@sha256:abc")
+	if ref.Version() != "sha256:abc" {
+		t.Errorf("Version() = %q, want the digest", ref.Version())
+	}
+	if ref.apiHost() != "registry-1.docker.io" {
+		t.Errorf("apiHost() = %q, want registry-1.docker.io", ref.apiHost())
+	}
+}
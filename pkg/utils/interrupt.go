@@ -0,0 +1,62 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+type interruptKey struct{}
+
+// WithInterrupt returns a context for a run that can be stopped with
+// SIGINT or SIGTERM. The first signal only marks the context as interrupted,
+// see Interrupted, so that the object in flight can be finished before the
+// run stops. A second signal cancels the context, aborting any request in
+// flight.
+func WithInterrupt(parent context.Context) (context.Context, context.CancelFunc) {
+	interrupted := make(chan struct{})
+	ctx, cancel := context.WithCancel(context.WithValue(parent, interruptKey{}, interrupted))
+
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		defer signal.Stop(signals)
+
+		select {
+		case <-signals:
+			fmt.Fprintln(os.Stderr, "\nInterrupted, stopping after the objects in flight. Interrupt again to abort.")
+			close(interrupted)
+		case <-ctx.Done():
+			return
+		}
+
+		select {
+		case <-signals:
+			fmt.Fprintln(os.Stderr, "\nAborting.")
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, cancel
+}
+
+// Interrupted reports whether the run of ctx has been asked to stop, either
+// by a signal or because ctx is done.
+func Interrupted(ctx context.Context) bool {
+	if ctx.Err() != nil {
+		return true
+	}
+
+	if interrupted, ok := ctx.Value(interruptKey{}).(chan struct{}); ok {
+		select {
+		case <-interrupted:
+			return true
+		default:
+		}
+	}
+
+	return false
+}
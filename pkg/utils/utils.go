@@ -3,6 +3,7 @@ package utils
 import (
 	"bufio"
 	"fmt"
+	"io"
 	"os"
 	"os/user"
 	"path/filepath"
@@ -34,14 +35,50 @@ func FileExists(filename string) bool {
 
 func Int32Ptr(i int32) *int32 { return &i }
 
-func Prompt() {
-	fmt.Printf("-> Press Return key to continue.")
-	scanner := bufio.NewScanner(os.Stdin)
-	for scanner.Scan() {
-		break
+var stdin = bufio.NewReader(os.Stdin)
+
+// Prompt prints message and returns the line typed in answer, without
+// surrounding white space. An error is returned when stdin is closed before
+// a line could be read, e.g. when it isn't a terminal.
+func Prompt(message string) (string, error) {
+	fmt.Print(message)
+	line, err := stdin.ReadString('\n')
+	if err != nil && (err != io.EOF || len(line) == 0) {
+		fmt.Println()
+		return "", err
 	}
-	if err := scanner.Err(); err != nil {
-		panic(err)
+
+	return strings.TrimSpace(line), nil
+}
+
+// ParseMapping parses a comma separated list of key=value pairs,
+// e.g. "default=apps,kube-public=public", into a map.
+func ParseMapping(s string) (map[string]string, error) {
+	mapping := map[string]string{}
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if len(pair) == 0 {
+			continue
+		}
+
+		tokens := strings.SplitN(pair, "=", 2)
+		if len(tokens) != 2 || len(tokens[0]) == 0 || len(tokens[1]) == 0 {
+			return nil, fmt.Errorf("invalid mapping entry: %q, expected key=value", pair)
+		}
+		mapping[strings.TrimSpace(tokens[0])] = strings.TrimSpace(tokens[1])
 	}
-	fmt.Println()
+
+	return mapping, nil
+}
+
+// StringList is a flag.Value collecting the values of a repeatable flag.
+type StringList []string
+
+func (l *StringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *StringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
 }
@@ -0,0 +1,351 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/klog/v2"
+
+	"github.com/mwlng/k8s_resources_sync/pkg/helpers"
+	"github.com/mwlng/k8s_resources_sync/pkg/k8s_resources"
+)
+
+// syncRun holds the settings of a single sync run and the report of every
+// object it has touched so far.
+type syncRun struct {
+	source   *rest.Config
+	target   *rest.Config
+	rootPath string
+	environ  string
+
+	namespaceMap    map[string]string
+	storageClassMap map[string]string
+	cidrTranslator  *helpers.CIDRTranslator
+	mergeRules      *helpers.MergeRules
+	filter          *helpers.Filter
+	customResources helpers.CustomResourceKinds
+	pvcCopyHook     helpers.DataCopyHook
+	jobOptions      helpers.JobOptions
+	images          *helpers.ImageRewriter
+	crdTimeout      time.Duration
+
+	report helpers.Results
+}
+
+// syncStep syncs a single kind, it is only run when enabled.
+type syncStep struct {
+	enabled bool
+	sync    func(ctx context.Context) error
+}
+
+func (r *syncRun) record(results helpers.Results) {
+	r.report = append(r.report, results...)
+}
+
+func (r *syncRun) syncCustomResourceDefinitions(ctx context.Context) error {
+	klog.Infof("Syncing k8s custom resource definitions to %s ...", r.target.Host)
+	crds := helpers.LoadCustomResourceDefinitionYamlFiles(r.rootPath)
+	for _, crd := range crds {
+		klog.Infof("* custom resource definition: %s\n", crd.GetName())
+	}
+	crds, results, err := helpers.SyncCustomResourceDefinitions(ctx, r.source, crds, r.filter)
+	r.record(results)
+	if err != nil {
+		return err
+	}
+	//PrintCustomResources(crds)
+	results, err = helpers.ApplyCustomResourceDefinitions(ctx, r.target, crds, r.crdTimeout)
+	r.record(results)
+	return err
+}
+
+func (r *syncRun) syncClusterRoles(ctx context.Context) error {
+	klog.Infof("Syncing k8s cluster roles to %s ...", r.target.Host)
+	clusterRoles := helpers.LoadClusterRoleYamlFiles(r.rootPath)
+	for _, role := range clusterRoles {
+		klog.Infof("* cluster role: %s\n", role.ObjectMeta.Name)
+	}
+	clusterRoles, results, err := helpers.SyncClusterRoles(ctx, r.source, clusterRoles, r.filter)
+	r.record(results)
+	if err != nil {
+		return err
+	}
+	//PrintClusterRoles(clusterRoles)
+	results, err = helpers.ApplyClusterRoles(ctx, r.target, clusterRoles)
+	r.record(results)
+	return err
+}
+
+func (r *syncRun) syncClusterRoleBindings(ctx context.Context) error {
+	klog.Infof("Syncing k8s cluster role bindings to %s ...", r.target.Host)
+	clusterRoleBindings := helpers.LoadClusterRoleBindingYamlFiles(r.rootPath)
+	for _, roleBinding := range clusterRoleBindings {
+		klog.Infof("* cluster role binding: %s\n", roleBinding.ObjectMeta.Name)
+	}
+	clusterRoleBindings, results, err := helpers.SyncClusterRoleBindings(ctx, r.source, clusterRoleBindings, r.filter)
+	r.record(results)
+	if err != nil {
+		return err
+	}
+	//PrintClusterRoleBindings(clusterRoleBindings)
+	results, err = helpers.ApplyClusterRoleBindings(ctx, r.target, clusterRoleBindings)
+	r.record(results)
+	return err
+}
+
+func (r *syncRun) syncServiceAccounts(ctx context.Context) error {
+	klog.Infof("Syncing k8s service accounts to %s ...", r.target.Host)
+	serviceAccounts := helpers.LoadServiceAccountYamlFiles(r.rootPath)
+	for _, account := range serviceAccounts {
+		klog.Infof("* service account: %s\n", account.ObjectMeta.Name)
+	}
+	serviceAccounts, results, err := helpers.SyncServiceAccounts(ctx, r.source, serviceAccounts, r.filter)
+	r.record(results)
+	if err != nil {
+		return err
+	}
+	results, err = helpers.ApplyServiceAccounts(ctx, r.target, serviceAccounts)
+	r.record(results)
+	return err
+}
+
+func (r *syncRun) syncRoles(ctx context.Context) error {
+	klog.Infof("Syncing k8s roles to %s ...", r.target.Host)
+	roles := helpers.LoadRoleYamlFiles(r.rootPath)
+	for _, role := range roles {
+		klog.Infof("* role: %s/%s\n", role.ObjectMeta.Namespace, role.ObjectMeta.Name)
+	}
+	roles, results, err := helpers.SyncRoles(ctx, r.source, roles, r.namespaceMap, r.filter)
+	r.record(results)
+	if err != nil {
+		return err
+	}
+	//PrintRoles(roles)
+	results, err = helpers.ApplyRoles(ctx, r.target, roles)
+	r.record(results)
+	return err
+}
+
+func (r *syncRun) syncRoleBindings(ctx context.Context) error {
+	klog.Infof("Syncing k8s role bindings to %s ...", r.target.Host)
+	roleBindings := helpers.LoadRoleBindingYamlFiles(r.rootPath)
+	for _, roleBinding := range roleBindings {
+		klog.Infof("* role binding: %s/%s\n", roleBinding.ObjectMeta.Namespace, roleBinding.ObjectMeta.Name)
+	}
+	roleBindings, results, err := helpers.SyncRoleBindings(ctx, r.source, roleBindings, r.namespaceMap, r.filter)
+	r.record(results)
+	if err != nil {
+		return err
+	}
+	//PrintRoleBindings(roleBindings)
+	results, err = helpers.ApplyRoleBindings(ctx, r.target, roleBindings)
+	r.record(results)
+	return err
+}
+
+func (r *syncRun) syncNetworkPolicies(ctx context.Context) error {
+	klog.Infof("Syncing k8s network policies to %s ...", r.target.Host)
+	policies := helpers.LoadNetworkPolicyYamlFiles(r.rootPath)
+	for _, policy := range policies {
+		klog.Infof("* network policy: %s/%s\n", policy.ObjectMeta.Namespace, policy.ObjectMeta.Name)
+	}
+	policies, results, err := helpers.SyncNetworkPolicies(ctx, r.source, policies, r.namespaceMap, r.cidrTranslator, r.filter)
+	r.record(results)
+	if err != nil {
+		return err
+	}
+	err = helpers.CheckNetworkPolicySelectors(ctx, r.target, policies)
+	if err != nil {
+		klog.Errorf("Failed to check network policy selectors. Err was: %s", err)
+	}
+	//PrintNetworkPolicies(policies)
+	results, err = helpers.ApplyNetworkPolicies(ctx, r.target, policies)
+	r.record(results)
+	return err
+}
+
+func (r *syncRun) syncServices(ctx context.Context) error {
+	klog.Infof("Syncing k8s service resources to %s ...", r.target.Host)
+	services := helpers.LoadServiceYamlFiles(r.rootPath)
+	for _, s := range services {
+		klog.Infof("* Service: %s\n", s.ObjectMeta.Name)
+	}
+	services, results, err := helpers.SyncServices(ctx, r.source, services, r.environ, r.filter)
+	r.record(results)
+	if err != nil {
+		return err
+	}
+	//PrintServices(services)
+	results, err = helpers.ApplyServices(ctx, r.target, services)
+	r.record(results)
+	return err
+}
+
+func (r *syncRun) syncStorageClasses(ctx context.Context) error {
+	klog.Infof("Syncing k8s storage classes to %s ...", r.target.Host)
+	storageClasses := helpers.LoadStorageClassYamlFiles(r.rootPath)
+	for _, class := range storageClasses {
+		klog.Infof("* storage class: %s\n", class.ObjectMeta.Name)
+	}
+	storageClasses, results, err := helpers.SyncStorageClasses(ctx, r.source, storageClasses, r.filter)
+	r.record(results)
+	if err != nil {
+		return err
+	}
+	//PrintStorageClasses(storageClasses)
+	results, err = helpers.ApplyStorageClasses(ctx, r.target, storageClasses)
+	r.record(results)
+	return err
+}
+
+func (r *syncRun) syncPersistentVolumeClaims(ctx context.Context) error {
+	klog.Infof("Syncing k8s persistent volume claims to %s ...", r.target.Host)
+	claims := helpers.LoadPersistentVolumeClaimYamlFiles(r.rootPath)
+	for _, claim := range claims {
+		klog.Infof("* persistent volume claim: %s/%s\n", claim.ObjectMeta.Namespace, claim.ObjectMeta.Name)
+	}
+	claims, sources, results, err := helpers.SyncPersistentVolumeClaims(ctx, r.source, claims, r.namespaceMap, r.storageClassMap, r.filter)
+	r.record(results)
+	if err != nil {
+		return err
+	}
+	//PrintPersistentVolumeClaims(claims)
+	createdClaims, results, err := helpers.ApplyPersistentVolumeClaims(ctx, r.target, claims)
+	if err == nil && r.pvcCopyHook != nil && !k8s_resources.IsDryRun(ctx) {
+		results = helpers.CopyPersistentVolumeClaimData(ctx, createdClaims, sources, r.pvcCopyHook, results)
+	}
+	r.record(results)
+	return err
+}
+
+func (r *syncRun) syncCustomResources(ctx context.Context) error {
+	klog.Infof("Syncing k8s custom resources to %s ...", r.target.Host)
+	objs := helpers.LoadCustomResourceYamlFiles(r.rootPath, r.customResources)
+	for _, obj := range objs {
+		klog.Infof("* %s: %s/%s\n", obj.GetKind(), obj.GetNamespace(), obj.GetName())
+	}
+	objs, results, err := helpers.SyncCustomResources(ctx, r.source, objs, r.namespaceMap, r.mergeRules, r.filter)
+	r.record(results)
+	if err != nil {
+		return err
+	}
+	//PrintCustomResources(objs)
+	results, err = helpers.ApplyCustomResources(ctx, r.target, objs)
+	r.record(results)
+	return err
+}
+
+func (r *syncRun) syncJobs(ctx context.Context) error {
+	klog.Infof("Syncing k8s jobs to %s ...", r.target.Host)
+	jobs := helpers.LoadJobYamlFiles(r.rootPath)
+	for _, job := range jobs {
+		klog.Infof("* job: %s\n", job.ObjectMeta.Name)
+	}
+	jobs, results, err := helpers.SyncJobs(ctx, r.source, jobs, r.images, r.filter)
+	r.record(results)
+	if err != nil {
+		return err
+	}
+	//PrintJobs(jobs)
+	results, err = helpers.ApplyJobs(ctx, r.target, jobs, r.jobOptions)
+	r.record(results)
+	return err
+}
+
+func (r *syncRun) syncCronJobs(ctx context.Context) error {
+	klog.Infof("Syncing k8s cron jobs to %s ...", r.target.Host)
+	cronJobs := helpers.LoadCronJobYamlFiles(r.rootPath)
+	for _, job := range cronJobs {
+		klog.Infof("* cron job: %s\n", job.ObjectMeta.Name)
+	}
+	cronJobs, results, err := helpers.SyncCronJobs(ctx, r.source, cronJobs, r.images, r.filter)
+	r.record(results)
+	if err != nil {
+		return err
+	}
+	//PrintCronJobs(cronJobs)
+	results, err = helpers.ApplyCronJobs(ctx, r.target, cronJobs)
+	r.record(results)
+	return err
+}
+
+func (r *syncRun) syncStatefulSets(ctx context.Context) error {
+	klog.Infof("Syncing k8s stateful set resources to %s ...", r.target.Host)
+	statefulSets := helpers.LoadStatefulSetYamlFiles(r.rootPath)
+	for _, s := range statefulSets {
+		klog.Infof("* StatefulSet: %s\n", s.ObjectMeta.Name)
+	}
+	statefulSets, results, err := helpers.SyncStatefulSets(ctx, r.source, statefulSets, r.images, r.filter)
+	r.record(results)
+	if err != nil {
+		return err
+	}
+	//PrintStatefulSets(statefulSets)
+	results, err = helpers.ApplyStatefulSets(ctx, r.target, statefulSets)
+	r.record(results)
+	return err
+}
+
+func (r *syncRun) syncDeployments(ctx context.Context) error {
+	klog.Infof("Syncing k8s deployment resources to %s ...", r.target.Host)
+	deployments := helpers.LoadDeploymentYamlFiles(r.rootPath)
+	for _, d := range deployments {
+		klog.Infof("* Deployment: %s\n", d.ObjectMeta.Name)
+	}
+	deployments, results, err := helpers.SyncDeployments(ctx, r.source, deployments, r.images, r.filter)
+	r.record(results)
+	if err != nil {
+		return err
+	}
+	//PrintDeployments(deployments)
+	results, err = helpers.ApplyDeployments(ctx, r.target, deployments)
+	r.record(results)
+	return err
+}
+
+// workloadImages reads the enabled workloads from the source cluster, like
+// their sync steps do, and returns the images the target cluster will pull.
+func (r *syncRun) workloadImages(ctx context.Context, deployments, statefulSets, cronJobs, jobs bool) ([]helpers.ImageUse, error) {
+	uses := []helpers.ImageUse{}
+	if jobs {
+		synced, _, err := helpers.SyncJobs(ctx, r.source, helpers.LoadJobYamlFiles(r.rootPath), r.images, r.filter)
+		if err != nil {
+			return nil, err
+		}
+		for _, j := range synced {
+			uses = append(uses, helpers.PodImages("Job", corev1.NamespaceDefault, j.Name, &j.Spec.Template.Spec)...)
+		}
+	}
+	if cronJobs {
+		synced, _, err := helpers.SyncCronJobs(ctx, r.source, helpers.LoadCronJobYamlFiles(r.rootPath), r.images, r.filter)
+		if err != nil {
+			return nil, err
+		}
+		for _, job := range synced {
+			uses = append(uses, helpers.PodImages("CronJob", corev1.NamespaceDefault, job.Name, &job.Spec.JobTemplate.Spec.Template.Spec)...)
+		}
+	}
+	if deployments {
+		synced, _, err := helpers.SyncDeployments(ctx, r.source, helpers.LoadDeploymentYamlFiles(r.rootPath), r.images, r.filter)
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range synced {
+			uses = append(uses, helpers.PodImages("Deployment", corev1.NamespaceDefault, d.Name, &d.Spec.Template.Spec)...)
+		}
+	}
+
+	if statefulSets {
+		synced, _, err := helpers.SyncStatefulSets(ctx, r.source, helpers.LoadStatefulSetYamlFiles(r.rootPath), r.images, r.filter)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range synced {
+			uses = append(uses, helpers.PodImages("StatefulSet", corev1.NamespaceDefault, s.Name, &s.Spec.Template.Spec)...)
+		}
+	}
+
+	return uses, nil
+}